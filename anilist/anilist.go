@@ -2,22 +2,31 @@ package anilist
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"ipmanlk/saika/database"
+	"ipmanlk/saika/search"
 	"ipmanlk/saika/structs"
 	"log"
 	"net/http"
 	"regexp"
 )
 
-func SearchMedia(searchText string, mediaType string) ([]structs.AnilistMedia, error) {
+func SearchMedia(ctx context.Context, searchQuery *search.Query, mediaType string) ([]structs.AnilistMedia, error) {
 	apiURL := "https://graphql.anilist.co"
 
 	query := `
-	query ($search: String, $type: MediaType) {
+	query (
+		$search: String, $type: MediaType, $genres: [String], $tags: [String], $startDate: String,
+		$format: MediaFormat, $scoreGreater: Int, $scoreLesser: Int
+	) {
 		Page(perPage: 20) {
-			media(search: $search, type: $type) {
+			media(
+				search: $search, type: $type, genre_in: $genres, tag_in: $tags, startDate_like: $startDate,
+				format: $format, averageScore_greater: $scoreGreater, averageScore_lesser: $scoreLesser
+			) {
 				id
 				idMal
 				title {
@@ -81,7 +90,30 @@ func SearchMedia(searchText string, mediaType string) ([]structs.AnilistMedia, e
 		}
 	}`
 
-	variables := map[string]interface{}{"search": searchText, "type": mediaType}
+	// variables left out are null, which AniList treats as "no filter"
+	variables := map[string]interface{}{"type": mediaType}
+
+	if searchQuery.HasText() {
+		variables["search"] = searchQuery.Text()
+	}
+	if len(searchQuery.Genres) > 0 {
+		variables["genres"] = searchQuery.Genres
+	}
+	if len(searchQuery.Tags) > 0 {
+		variables["tags"] = searchQuery.Tags
+	}
+	if searchQuery.Year > 0 {
+		variables["startDate"] = fmt.Sprintf("%d%%", searchQuery.Year)
+	}
+	if searchQuery.Format != "" {
+		variables["format"] = searchQuery.Format
+	}
+	if searchQuery.ScoreGreater >= 0 {
+		variables["scoreGreater"] = searchQuery.ScoreGreater
+	}
+	if searchQuery.ScoreLesser >= 0 {
+		variables["scoreLesser"] = searchQuery.ScoreLesser
+	}
 
 	reqBody := structs.AnilistGraphQLQuery{Query: query, Variables: variables}
 	reqJSON, err := json.Marshal(reqBody)
@@ -89,7 +121,7 @@ func SearchMedia(searchText string, mediaType string) ([]structs.AnilistMedia, e
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reqJSON))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(reqJSON))
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +158,7 @@ func SearchMedia(searchText string, mediaType string) ([]structs.AnilistMedia, e
 	}
 
 	// save all media in a new goroutine, handle errors in the background
-	err = database.SaveMedia(result.Data.Page.Media)
+	err = database.SaveMedia(ctx, result.Data.Page.Media)
 	if err != nil {
 		log.Printf("Error saving media: %v", err)
 	}
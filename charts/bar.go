@@ -0,0 +1,92 @@
+package charts
+
+import (
+	"image"
+	"math"
+	"strconv"
+)
+
+// A bar of a bar chart, labelled under it and with its value over it.
+type Bar struct {
+	Label string
+	Value int
+}
+
+const (
+	barChartWidth  = 640
+	barChartHeight = 320
+	barChartMargin = 20
+)
+
+// BarChart draws bars left to right, scaled so the highest one fills the chart. Labels
+// that don't fit under their bar are shrunk, and when even that isn't enough only
+// every few of them are drawn.
+func BarChart(bars []Bar) *image.RGBA {
+	img := newCanvas(barChartWidth, barChartHeight)
+	if len(bars) == 0 {
+		return img
+	}
+
+	labels := make([]string, len(bars))
+	values := make([]string, len(bars))
+	maxValue := 0
+	for i, bar := range bars {
+		labels[i] = bar.Label
+		values[i] = strconv.Itoa(bar.Value)
+		if bar.Value > maxValue {
+			maxValue = bar.Value
+		}
+	}
+
+	slot := float64(barChartWidth-2*barChartMargin) / float64(len(bars))
+	labelScale, labelStep := fitLabels(labels, slot)
+	valueScale, valueStep := fitLabels(values, slot)
+
+	top := barChartMargin + glyphHeight*valueScale + 6
+	bottom := barChartHeight - barChartMargin - glyphHeight*labelScale - 6
+	barWidth := math.Min(slot*0.7, 64)
+
+	for i, bar := range bars {
+		centre := float64(barChartMargin) + slot*(float64(i)+0.5)
+
+		height := 0
+		if maxValue > 0 {
+			height = int(math.Round(float64(bar.Value) / float64(maxValue) * float64(bottom-top)))
+		}
+
+		left := int(math.Round(centre - barWidth/2))
+		right := int(math.Round(centre + barWidth/2))
+		fillRect(img, image.Rect(left, bottom-height, right, bottom), Accent)
+
+		if i%valueStep == 0 {
+			width := textWidth(values[i], valueScale)
+			drawText(img, values[i], int(math.Round(centre))-width/2, bottom-height-glyphHeight*valueScale-4, valueScale, foreground)
+		}
+		if i%labelStep == 0 {
+			width := textWidth(labels[i], labelScale)
+			drawText(img, labels[i], int(math.Round(centre))-width/2, bottom+6, labelScale, foreground)
+		}
+	}
+
+	fillRect(img, image.Rect(barChartMargin, bottom, barChartWidth-barChartMargin, bottom+1), gridColour)
+
+	return img
+}
+
+// fitLabels picks the text scale for labels centred in slots slot pixels wide, and
+// draws only every step-th label when they don't fit at the smallest scale.
+func fitLabels(labels []string, slot float64) (scale int, step int) {
+	widest := 0
+	for _, label := range labels {
+		if width := textWidth(label, 1); width > widest {
+			widest = width
+		}
+	}
+
+	// labels need a few pixels between them
+	available := slot - 4
+	if float64(widest*2) <= available {
+		return 2, 1
+	}
+	return 1, int(math.Max(1, math.Ceil(float64(widest+4)/slot)))
+}
@@ -0,0 +1,142 @@
+// Package charts draws the stats charts as PNG images, in pure Go so they can be
+// rendered wherever the bot runs.
+package charts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// A chart colour and the Discord emoji square of about the same colour, so embeds can
+// show which colour stands for what.
+type Colour struct {
+	RGBA  color.RGBA
+	Emoji string
+}
+
+// Palette has the colours of the emoji squares, in the order charts use them.
+var Palette = []Colour{
+	{color.RGBA{0x55, 0xAC, 0xEE, 0xFF}, "🟦"},
+	{color.RGBA{0x78, 0xB1, 0x59, 0xFF}, "🟩"},
+	{color.RGBA{0xF4, 0x90, 0x0C, 0xFF}, "🟧"},
+	{color.RGBA{0xAA, 0x8E, 0xD6, 0xFF}, "🟪"},
+	{color.RGBA{0xDD, 0x2E, 0x44, 0xFF}, "🟥"},
+	{color.RGBA{0xFD, 0xCB, 0x58, 0xFF}, "🟨"},
+	{color.RGBA{0xC1, 0x69, 0x4F, 0xFF}, "🟫"},
+}
+
+// Accent is the colour of single colour charts, the one of the bot's embeds.
+var Accent = color.RGBA{0xFF, 0x40, 0x81, 0xFF}
+
+// Charts are drawn on the background of Discord's dark theme, which also reads fine
+// on the light one.
+var (
+	background = color.RGBA{0x2B, 0x2D, 0x31, 0xFF}
+	foreground = color.RGBA{0xDB, 0xDE, 0xE1, 0xFF}
+	gridColour = color.RGBA{0x4E, 0x50, 0x58, 0xFF}
+)
+
+// Shapes are sampled this many times per pixel in each direction, to smooth their edges.
+const samples = 4
+
+// PNG encodes a chart for uploading.
+func PNG(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func newCanvas(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	return img
+}
+
+func fillRect(img *image.RGBA, rect image.Rectangle, colour color.RGBA) {
+	draw.Draw(img, rect, &image.Uniform{colour}, image.Point{}, draw.Over)
+}
+
+// blend paints colour over the pixel at x, y, coverage being how much of the pixel
+// the shape covers (0 to 1).
+func blend(img *image.RGBA, x int, y int, colour color.RGBA, coverage float64) {
+	if !(image.Point{x, y}.In(img.Bounds())) || coverage <= 0 {
+		return
+	}
+
+	alpha := coverage * float64(colour.A) / 0xFF
+	under := img.RGBAAt(x, y)
+	mix := func(over uint8, under uint8) uint8 {
+		return uint8(math.Round(float64(over)*alpha + float64(under)*(1-alpha)))
+	}
+	img.SetRGBA(x, y, color.RGBA{mix(colour.R, under.R), mix(colour.G, under.G), mix(colour.B, under.B), 0xFF})
+}
+
+// fillShape paints every pixel of bounds by how many of its samples inside reports
+// as covered.
+func fillShape(img *image.RGBA, bounds image.Rectangle, colour color.RGBA, inside func(x float64, y float64) bool) {
+	bounds = bounds.Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			covered := 0
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					if inside(float64(x)+(float64(sx)+0.5)/samples, float64(y)+(float64(sy)+0.5)/samples) {
+						covered++
+					}
+				}
+			}
+			blend(img, x, y, colour, float64(covered)/(samples*samples))
+		}
+	}
+}
+
+// drawLine draws a line width pixels thick from x1, y1 to x2, y2.
+func drawLine(img *image.RGBA, x1 float64, y1 float64, x2 float64, y2 float64, width float64, colour color.RGBA) {
+	bounds := image.Rect(
+		int(math.Floor(math.Min(x1, x2)-width)), int(math.Floor(math.Min(y1, y2)-width)),
+		int(math.Ceil(math.Max(x1, x2)+width)), int(math.Ceil(math.Max(y1, y2)+width)),
+	)
+
+	dx, dy := x2-x1, y2-y1
+	length := dx*dx + dy*dy
+
+	fillShape(img, bounds, colour, func(x float64, y float64) bool {
+		// distance from the point to the closest point of the segment
+		t := 0.0
+		if length > 0 {
+			t = math.Max(0, math.Min(1, ((x-x1)*dx+(y-y1)*dy)/length))
+		}
+		return math.Hypot(x-(x1+t*dx), y-(y1+t*dy)) <= width/2
+	})
+}
+
+// fillPolygon fills the polygon with the corners points, points being x, y pairs.
+func fillPolygon(img *image.RGBA, points [][2]float64, colour color.RGBA) {
+	bounds := image.Rectangle{}
+	for i, point := range points {
+		corner := image.Rect(int(math.Floor(point[0])), int(math.Floor(point[1])), int(math.Ceil(point[0]))+1, int(math.Ceil(point[1]))+1)
+		if i == 0 {
+			bounds = corner
+		} else {
+			bounds = bounds.Union(corner)
+		}
+	}
+
+	fillShape(img, bounds, colour, func(x float64, y float64) bool {
+		// even-odd rule, count the edges a ray to the right crosses
+		inside := false
+		for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+			a, b := points[i], points[j]
+			if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+				inside = !inside
+			}
+		}
+		return inside
+	})
+}
@@ -0,0 +1,198 @@
+package charts
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// Floating point results can differ a little between platforms, so the edges of shapes
+// may be off by a shade.
+const maxChannelDifference = 2
+
+// checkGolden compares a chart with testdata/name.png, or rewrites that file with -update.
+func checkGolden(t *testing.T, name string, img *image.RGBA) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".png")
+
+	if *update {
+		encoded, err := PNG(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, encoded, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", path, err)
+	}
+
+	if !decoded.Bounds().Eq(img.Bounds()) {
+		t.Fatalf("chart is %v, %s is %v", img.Bounds(), path, decoded.Bounds())
+	}
+
+	different := 0
+	var first image.Point
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if !similar(img.At(x, y), decoded.At(x, y)) {
+				if different == 0 {
+					first = image.Pt(x, y)
+				}
+				different++
+			}
+		}
+	}
+
+	if different > 0 {
+		t.Errorf("%d pixels differ from %s, the first at %v: got %v, want %v (run the tests with -update if the change is intended)",
+			different, path, first, img.At(first.X, first.Y), decoded.At(first.X, first.Y))
+	}
+}
+
+func similar(a color.Color, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	for _, pair := range [][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}, {a1, a2}} {
+		// RGBA gives 16 bit channels
+		difference := int(pair[0]>>8) - int(pair[1]>>8)
+		if difference > maxChannelDifference || difference < -maxChannelDifference {
+			return false
+		}
+	}
+	return true
+}
+
+// checkBlank checks whether anything was drawn on a chart.
+func checkBlank(t *testing.T, img *image.RGBA, blank bool) {
+	t.Helper()
+
+	empty := true
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y && empty; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X && empty; x++ {
+			empty = img.RGBAAt(x, y) == background
+		}
+	}
+
+	if empty != blank {
+		t.Errorf("chart is blank = %t, want %t", empty, blank)
+	}
+}
+
+func TestBarChart(t *testing.T) {
+	scores := []Bar{}
+	for i, count := range []int{1, 0, 2, 5, 3, 8, 13, 21, 9, 4} {
+		scores = append(scores, Bar{Label: strconv.Itoa((i + 1) * 10), Value: count})
+	}
+
+	years := []Bar{}
+	for year := 1990; year <= 2023; year++ {
+		years = append(years, Bar{Label: strconv.Itoa(year), Value: year * 7 % 23})
+	}
+
+	tests := []struct {
+		name  string
+		bars  []Bar
+		blank bool
+	}{
+		{"bar_scores", scores, false},
+		// labels too wide for their bars are shrunk and thinned out
+		{"bar_many", years, false},
+		{"bar_single", []Bar{{Label: "2023", Value: 42}}, false},
+		{"bar_empty", nil, true},
+		// the axis and the zero values are still drawn
+		{"bar_all_zero", []Bar{{Label: "TV", Value: 0}, {Label: "MOVIE", Value: 0}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := BarChart(test.bars)
+			checkBlank(t, img, test.blank)
+			checkGolden(t, test.name, img)
+		})
+	}
+}
+
+func TestDonutChart(t *testing.T) {
+	tests := []struct {
+		name   string
+		slices []Slice
+		centre string
+		blank  bool
+	}{
+		{"donut_statuses", []Slice{{5, Palette[0]}, {12, Palette[1]}, {3, Palette[2]}, {1, Palette[3]}}, "21", false},
+		{"donut_single", []Slice{{7, Palette[1]}}, "7", false},
+		{"donut_zero_slice", []Slice{{0, Palette[0]}, {4, Palette[2]}}, "4", false},
+		{"donut_long_centre", []Slice{{1, Palette[0]}, {1, Palette[4]}}, "12345678901234", false},
+		{"donut_empty", nil, "0", true},
+		{"donut_all_zero", []Slice{{0, Palette[0]}, {0, Palette[1]}}, "0", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := DonutChart(test.slices, test.centre)
+			checkBlank(t, img, test.blank)
+			checkGolden(t, test.name, img)
+		})
+	}
+}
+
+func TestRadarChart(t *testing.T) {
+	tests := []struct {
+		name  string
+		axes  []Axis
+		blank bool
+	}{
+		{"radar_genres", []Axis{
+			{"ACTION", 0.9}, {"COMEDY", 0.6}, {"DRAMA", 0.75}, {"FANTASY", 0.3}, {"ROMANCE", 0.5}, {"SCI-FI", 0.2},
+		}, false},
+		{"radar_triangle", []Axis{{"A", 1}, {"B", 0.5}, {"C", 0}}, false},
+		// values are kept between the centre and the edge
+		{"radar_out_of_range", []Axis{{"LOW", -1}, {"HIGH", 3}, {"MID", 0.5}, {"EDGE", 1}}, false},
+		{"radar_all_zero", []Axis{{"A", 0}, {"B", 0}, {"C", 0}, {"D", 0}}, false},
+		{"radar_two_axes", []Axis{{"A", 1}, {"B", 1}}, true},
+		{"radar_empty", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := RadarChart(test.axes)
+			checkBlank(t, img, test.blank)
+			checkGolden(t, test.name, img)
+		})
+	}
+}
+
+func TestPNG(t *testing.T) {
+	img := BarChart([]Bar{{Label: "1", Value: 1}})
+
+	encoded, err := PNG(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("PNG() gave an image that can't be decoded: %v", err)
+	}
+	if !decoded.Bounds().Eq(img.Bounds()) {
+		t.Errorf("decoded image is %v, want %v", decoded.Bounds(), img.Bounds())
+	}
+}
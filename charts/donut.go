@@ -0,0 +1,65 @@
+package charts
+
+import (
+	"image"
+	"math"
+)
+
+// A slice of a donut chart.
+type Slice struct {
+	Value  int
+	Colour Colour
+}
+
+const (
+	donutSize        = 320
+	donutOuterRadius = 150
+	donutInnerRadius = 92
+)
+
+// DonutChart draws slices clockwise from the top, each as big as its share of the
+// total, with centre written in the hole.
+func DonutChart(slices []Slice, centre string) *image.RGBA {
+	img := newCanvas(donutSize, donutSize)
+
+	total := 0
+	for _, slice := range slices {
+		total += slice.Value
+	}
+	if total == 0 {
+		return img
+	}
+
+	middle := float64(donutSize) / 2
+	bounds := image.Rect(0, 0, donutSize, donutSize)
+
+	start := 0.0
+	for _, slice := range slices {
+		end := start + float64(slice.Value)/float64(total)*2*math.Pi
+		from, to := start, end
+
+		fillShape(img, bounds, slice.Colour.RGBA, func(x float64, y float64) bool {
+			distance := math.Hypot(x-middle, y-middle)
+			if distance > donutOuterRadius || distance < donutInnerRadius {
+				return false
+			}
+
+			// clockwise from the top
+			angle := math.Atan2(x-middle, middle-y)
+			if angle < 0 {
+				angle += 2 * math.Pi
+			}
+			return angle >= from && angle < to
+		})
+
+		start = end
+	}
+
+	scale := 3
+	for scale > 1 && textWidth(centre, scale) > 2*donutInnerRadius-16 {
+		scale--
+	}
+	drawText(img, centre, int(middle)-textWidth(centre, scale)/2, int(middle)-glyphHeight*scale/2, scale, foreground)
+
+	return img
+}
@@ -0,0 +1,96 @@
+package charts
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+)
+
+// Glyphs are 5x7, each row a byte with the leftmost pixel in bit 4. Lowercase letters
+// are drawn as uppercase ones and anything else missing as a question mark.
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+var glyphs = map[rune][glyphHeight]byte{
+	' ':  {},
+	'0':  {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1':  {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3':  {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4':  {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5':  {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6':  {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9':  {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'A':  {0x0E, 0x11, 0x11, 0x11, 0x1F, 0x11, 0x11},
+	'B':  {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C':  {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D':  {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G':  {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H':  {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I':  {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M':  {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P':  {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q':  {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R':  {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S':  {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T':  {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X':  {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	'-':  {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	':':  {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'|':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'&':  {0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D},
+	'\'': {0x0C, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'?':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
+
+// textWidth is the width of text drawn at scale, without the space after the last glyph.
+func textWidth(text string, scale int) int {
+	length := len([]rune(text))
+	if length == 0 {
+		return 0
+	}
+	return (length*(glyphWidth+1) - 1) * scale
+}
+
+// drawText draws text with its top left corner at x, y, every font pixel scale pixels wide.
+func drawText(img *image.RGBA, text string, x int, y int, scale int, colour color.RGBA) {
+	for _, char := range strings.ToUpper(text) {
+		glyph, ok := glyphs[unicode.ToUpper(char)]
+		if !ok {
+			glyph = glyphs['?']
+		}
+
+		for row := 0; row < glyphHeight; row++ {
+			for column := 0; column < glyphWidth; column++ {
+				if glyph[row]&(0x10>>column) == 0 {
+					continue
+				}
+				fillRect(img, image.Rect(x+column*scale, y+row*scale, x+(column+1)*scale, y+(row+1)*scale), colour)
+			}
+		}
+
+		x += (glyphWidth + 1) * scale
+	}
+}
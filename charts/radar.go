@@ -0,0 +1,81 @@
+package charts
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// An axis of a radar chart, Value goes from 0 in the centre to 1 at the edge.
+type Axis struct {
+	Label string
+	Value float64
+}
+
+const (
+	radarWidth  = 560
+	radarHeight = 440
+	radarRadius = 150
+	radarRings  = 4
+)
+
+// RadarChart draws the axes clockwise from the top, with the shape joining their
+// values filled in. It needs at least three axes to have a shape.
+func RadarChart(axes []Axis) *image.RGBA {
+	img := newCanvas(radarWidth, radarHeight)
+	if len(axes) < 3 {
+		return img
+	}
+
+	centreX, centreY := float64(radarWidth)/2, float64(radarHeight)/2
+
+	// point is where the axis'th axis is value of the way out
+	point := func(axis int, value float64) [2]float64 {
+		angle := float64(axis) / float64(len(axes)) * 2 * math.Pi
+		return [2]float64{centreX + math.Sin(angle)*value*radarRadius, centreY - math.Cos(angle)*value*radarRadius}
+	}
+
+	for ring := 1; ring <= radarRings; ring++ {
+		value := float64(ring) / radarRings
+		for i := range axes {
+			from, to := point(i, value), point((i+1)%len(axes), value)
+			drawLine(img, from[0], from[1], to[0], to[1], 1.5, gridColour)
+		}
+	}
+
+	shape := make([][2]float64, len(axes))
+	for i, axis := range axes {
+		edge := point(i, 1)
+		drawLine(img, centreX, centreY, edge[0], edge[1], 1.5, gridColour)
+		shape[i] = point(i, math.Max(0, math.Min(1, axis.Value)))
+	}
+
+	fillPolygon(img, shape, color.RGBA{Accent.R, Accent.G, Accent.B, 0x66})
+	for i := range shape {
+		from, to := shape[i], shape[(i+1)%len(shape)]
+		drawLine(img, from[0], from[1], to[0], to[1], 3, Accent)
+	}
+	for _, corner := range shape {
+		drawLine(img, corner[0], corner[1], corner[0], corner[1], 9, Accent)
+	}
+
+	const scale = 2
+	for i, axis := range axes {
+		at := point(i, 1+24.0/radarRadius)
+		width := textWidth(axis.Label, scale)
+
+		// labels lean away from the chart on the sides and are centred at the top and bottom
+		x := at[0] - float64(width)/2
+		if side := at[0] - centreX; side > radarRadius/4 {
+			x = at[0] - 8
+		} else if side < -radarRadius/4 {
+			x = at[0] - float64(width) + 8
+		}
+		y := at[1] - glyphHeight*scale/2
+
+		x = math.Max(4, math.Min(float64(radarWidth-width-4), x))
+		drawText(img, axis.Label, int(math.Round(x)), int(math.Round(y)), scale, foreground)
+	}
+
+	return img
+}
@@ -15,6 +15,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/disgoorg/disgo"
 	"github.com/disgoorg/disgo/bot"
@@ -32,14 +33,26 @@ func main() {
 	log.SetLevel(log.LevelInfo)
 	log.Infof("Bot: [disgo version: %s] Starting....", disgo.Version)
 
-	// Initialize MongoDB
-	database.InitMongoDb()
+	// Initialize the storage backend (MongoDB or SQLite) and bring its schema up to date
+	database.Init()
+
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 15*time.Minute)
+	if _, err := database.MigrateUp(migrateCtx); err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+	cancelMigrate()
+
+	// remove expired search results and other interaction state in the background
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	go database.RunJanitor(janitorCtx)
 
 	token := config.GetEnv("BOT_TOKEN", "")
 	production := config.GetEnv("PRODUCTION", "0") == "1"
 
 	r := handler.New()
 	r.Use(middleware.Logger)
+	r.Use(interactions.RecordGuildMembers)
 
 	r.Group(func(r handler.Router) {
 		r.Use(middleware.Print("slash commands"))
@@ -48,28 +61,76 @@ func main() {
 		r.Command("/manga", commands.HandleMangaCommand)
 		r.Command("/anime-lists", commands.HandleAnimeListCommand)
 		r.Command("/manga-lists", commands.HandleMangaListCommand)
+		r.Command("/reviews", commands.HandleReviewsCommand)
+		r.Command("/stats", commands.HandleStatsCommand)
+		r.Command("/compare", commands.HandleCompareCommand)
+		r.Command("/leaderboard", commands.HandleLeaderboardCommand)
+		r.Command("/server-top", commands.HandleServerTopCommand)
+		r.Command("/lists/create", commands.HandleListsCommand)
+		r.Command("/lists/rename", commands.HandleListsCommand)
+		r.Command("/lists/delete", commands.HandleListsCommand)
+		r.Command("/favourites/view", commands.HandleFavouritesCommand)
+		r.Command("/favourites/move", commands.HandleFavouritesCommand)
+		r.Command("/favourites/remove", commands.HandleFavouritesCommand)
+		r.Command("/settings", commands.HandleSettingsCommand)
 		r.Command("/about", commands.HandleAboutCommand)
 	})
 
+	r.Group(func(r handler.Router) {
+		r.Use(middleware.Print("user commands"))
+
+		r.Command("/View anime list", commands.HandleViewAnimeListCommand)
+		r.Command("/View manga list", commands.HandleViewMangaListCommand)
+	})
+
+	r.Group(func(r handler.Router) {
+		r.Use(middleware.Print("autocomplete"))
+
+		r.Autocomplete("/lists/rename", commands.HandleListsAutocomplete)
+		r.Autocomplete("/lists/delete", commands.HandleListsAutocomplete)
+		r.Autocomplete("/favourites/move", commands.HandleFavouritesAutocomplete)
+		r.Autocomplete("/favourites/remove", commands.HandleFavouritesAutocomplete)
+	})
+
 	r.Group(func(r handler.Router) {
 		r.Use(middleware.Print("components"))
 
-		r.Component("btn_media_results/{ownerID}/{searchQueryID}/pages/{page}", interactions.HandleMediaResultPagination)
-		r.Component("btn_rate/{origin}/{mediaType}/{idAnilist}/{prevPage}", interactions.HandleMediaRateButton)
-		r.Component("btn_delete/{status}/{userMediaID}/{mediaType}/{prevPage}", interactions.HandleMediaListDeleteButton)
+		// custom ids are made by the customid package, routes match on the action
+		// name and the handlers decode (and verify) the rest
+		r.Component("btn_media_results", interactions.HandleMediaResultPagination)
+		r.Component("btn_rate", interactions.HandleMediaRateButton)
+		r.Component("btn_delete", interactions.HandleMediaListDeleteButton)
+		r.Component("btn_progress", interactions.HandleMediaProgressButton)
+		r.Component("btn_set_progress", interactions.HandleMediaSetProgressButton)
+		r.Component("btn_complete", interactions.HandleMediaCompleteButton)
+		r.Component("btn_history", interactions.HandleMediaHistoryButton)
+		r.Component("btn_tags", interactions.HandleMediaTagsButton)
+		r.Component("btn_favourite", interactions.HandleMediaFavouriteButton)
+		r.Component("sm_entry_lists", interactions.HandleMediaEntryListsSelectMenu)
+		r.Component("btn_reviews", interactions.HandleReviewsPagination)
+		r.Component("btn_stats", interactions.HandleStatsPagination)
+		r.Component("btn_compare", interactions.HandleComparePagination)
+		r.Component("sm_compare", interactions.HandleCompareSelectMenu)
+		r.Component("sm_leaderboard", interactions.HandleLeaderboardSelectMenu)
+		r.Component("btn_server_top", interactions.HandleServerTopPagination)
 
 		r.Component("sm_media_action", interactions.HandleMediaResultSelectMenu)
 
 		// select menu for selecting a media list
 		r.Component("sm_media_lists", interactions.HandleMediaListsSelectMenu)
 		// back to lists button
-		r.Component("btn_media_lists/{mediaType}", interactions.HandleMediaListButton)
+		r.Component("btn_media_lists", interactions.HandleMediaListButton)
 		// pagination for a media list (ex, planning list)
-		r.Component("btn_media_list/{mediaType}/{status}/{page}", interactions.HandleMediaListPagination)
+		r.Component("btn_media_list", interactions.HandleMediaListPagination)
 		// media select menu from a media list (anime/manga)
 		r.Component("sm_media_list", interactions.HandleMediaListSelectMenu)
+		// sort and filter select menus of a media list page
+		r.Component("sm_list_view", interactions.HandleMediaListViewSelectMenu)
 
-		r.Modal("model_rate/{origin}/{idAnilist}/{prevPage}", interactions.HandleAnimeRatingModal)
+		r.Modal("model_rate", interactions.HandleAnimeRatingModal)
+		r.Modal("modal_progress", interactions.HandleMediaProgressModal)
+		r.Modal("modal_history", interactions.HandleMediaHistoryModal)
+		r.Modal("modal_tags", interactions.HandleMediaTagsModal)
 	})
 
 	client, err := disgo.New(token,
@@ -86,6 +147,9 @@ func main() {
 				// log bot started and mode (production or not)
 				log.Infof("Bot started successfully! [PRODUCTION: %v]", production)
 			},
+			OnGuildLeave: func(event *events.GuildLeave) {
+				interactions.ForgetGuildMembers(event.GuildID)
+			},
 		}),
 	)
 
@@ -110,7 +174,7 @@ func main() {
 }
 
 func updateCommands(botClient bot.Client, production bool) {
-	registerData := commands.GetSlashCommandRegisterData()
+	registerData := append(commands.GetSlashCommandRegisterData(), commands.GetUserCommandRegisterData()...)
 
 	// check if commands changed
 	commandsChanged := checkCommandsChanged(registerData, production)
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"ipmanlk/saika/anilist"
+	"ipmanlk/saika/search"
 	"os"
 	"os/signal"
 	"runtime"
@@ -12,8 +14,8 @@ import (
 func main() {
 	defer logMemoryUsage()
 
-	searchText := "Naruto"
-	media, err := anilist.SearchMedia(searchText, "ANIME")
+	searchQuery, _ := search.Parse("Naruto")
+	media, err := anilist.SearchMedia(context.Background(), searchQuery, "ANIME")
 	if err != nil {
 		fmt.Printf("Error: %s\n", err)
 		return
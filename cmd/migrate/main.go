@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ipmanlk/saika/database"
+	"log"
+	"os"
+	"time"
+)
+
+// Applies or lists schema migrations for the storage backend selected by STORAGE.
+//
+//	migrate up       apply pending migrations
+//	migrate status   list migrations and when they were applied
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s up|status\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	timeout := flag.Duration("timeout", 30*time.Minute, "give up after this long")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	database.Init()
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := database.MigrateUp(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to migrate the database: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("nothing to apply, the database is up to date")
+		}
+	case "status":
+		statuses, err := database.GetMigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, migration := range statuses {
+			appliedAt := "pending"
+			if migration.Applied() {
+				appliedAt = migration.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-32s %s\n", migration.Version, migration.Name, appliedAt)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
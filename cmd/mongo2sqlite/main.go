@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"ipmanlk/saika/config"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/structs"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// One-shot copy of the MongoDB database (MONGO_URI / MONGO_DATABASE) into a
+// SQLite file, keeping every ObjectID so existing message buttons keep working.
+func main() {
+	sqlitePath := flag.String("out", config.GetEnv("SQLITE_PATH", "ryougi.db"), "path of the sqlite database to write")
+	flag.Parse()
+
+	sqliteStore, err := database.OpenSQLite(*sqlitePath)
+	if err != nil {
+		log.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	defer database.DisconnectMongoClient(database.GetMongoClient())
+
+	ctx := context.Background()
+
+	// documents are copied as they are, so they have to be in the shape the SQLite
+	// migrations leave them in, which is the shape the Mongo migrations leave them in
+	mongoStatuses, err := (&database.MongoStore{}).MigrationStatus(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get mongo migration status: %v", err)
+	}
+	for _, migration := range mongoStatuses {
+		if !migration.Applied() {
+			log.Fatalf("Mongo migration %d (%s) is pending, run `STORAGE=mongo migrate up` before copying the database", migration.Version, migration.Name)
+		}
+	}
+
+	if _, err := sqliteStore.MigrateUp(ctx); err != nil {
+		log.Fatalf("Failed to migrate sqlite database: %v", err)
+	}
+
+	copied, err := copyCollection(ctx, "media", func(cursor decoder) error {
+		var media structs.AnilistMedia
+		if err := cursor.Decode(&media); err != nil {
+			return err
+		}
+		return sqliteStore.ImportMedia(ctx, &media)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy media: %v", err)
+	}
+	log.Printf("Copied %d media", copied)
+
+	copied, err = copyCollection(ctx, "user_media", func(cursor decoder) error {
+		var userMedia structs.UserMedia
+		if err := cursor.Decode(&userMedia); err != nil {
+			return err
+		}
+		return sqliteStore.ImportUserMedia(ctx, &userMedia)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy user media: %v", err)
+	}
+	log.Printf("Copied %d user media", copied)
+
+	copied, err = copyCollection(ctx, "search_queries", func(cursor decoder) error {
+		var query structs.AnilistSearchQuery
+		if err := cursor.Decode(&query); err != nil {
+			return err
+		}
+		return sqliteStore.ImportSearchQuery(ctx, &query)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy search queries: %v", err)
+	}
+	log.Printf("Copied %d search queries", copied)
+
+	copied, err = copyCollection(ctx, "user_lists", func(cursor decoder) error {
+		var list structs.UserList
+		if err := cursor.Decode(&list); err != nil {
+			return err
+		}
+		return sqliteStore.ImportUserList(ctx, &list)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy user lists: %v", err)
+	}
+	log.Printf("Copied %d user lists", copied)
+
+	copied, err = copyCollection(ctx, "favourites", func(cursor decoder) error {
+		var favourite structs.Favourite
+		if err := cursor.Decode(&favourite); err != nil {
+			return err
+		}
+		return sqliteStore.ImportFavourite(ctx, &favourite)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy favourites: %v", err)
+	}
+	log.Printf("Copied %d favourites", copied)
+
+	copied, err = copyCollection(ctx, "user_settings", func(cursor decoder) error {
+		var settings structs.UserSettings
+		if err := cursor.Decode(&settings); err != nil {
+			return err
+		}
+		return sqliteStore.ImportUserSettings(ctx, &settings)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy user settings: %v", err)
+	}
+	log.Printf("Copied %d user settings", copied)
+
+	copied, err = copyCollection(ctx, "guild_members", func(cursor decoder) error {
+		var member structs.GuildMember
+		if err := cursor.Decode(&member); err != nil {
+			return err
+		}
+		return sqliteStore.ImportGuildMember(ctx, &member)
+	})
+	if err != nil {
+		log.Fatalf("Failed to copy guild members: %v", err)
+	}
+	log.Printf("Copied %d guild members", copied)
+}
+
+type decoder interface {
+	Decode(val interface{}) error
+}
+
+func copyCollection(ctx context.Context, name string, copyDocument func(cursor decoder) error) (int, error) {
+	cursor, err := database.GetCollection(name).Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	copied := 0
+	for cursor.Next(ctx) {
+		if err := copyDocument(cursor); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+
+	return copied, cursor.Err()
+}
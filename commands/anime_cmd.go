@@ -5,11 +5,13 @@ import (
 	"ipmanlk/saika/anilist"
 	"ipmanlk/saika/database"
 	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/search"
 	"ipmanlk/saika/structs"
 	"strings"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/handler"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func HandleAnimeCommand(event *handler.CommandEvent) error {
@@ -24,24 +26,37 @@ func HandleAnimeCommand(event *handler.CommandEvent) error {
 		return error
 	}
 
+	parsedQuery, err := search.Parse(searchQuery)
+
+	if err != nil {
+		_, err = event.UpdateInteractionResponse(discord.MessageUpdate{
+			Embeds: helpers.GetErrorEmbed(err.Error()),
+		})
+		return err
+	}
+
 	cachedChannel, _ := event.MessageChannel()
 	isNsfwChannel := cachedChannel.NSFW()
 
+	ctx, cancel := helpers.InteractionContext(event)
+
 	go func() {
+		defer cancel()
+
 		// check if there are any anime with the given name
-		_, err := anilist.SearchMedia(searchQuery, "ANIME")
+		_, err := anilist.SearchMedia(ctx, parsedQuery, "ANIME")
 
 		if err != nil {
 			fmt.Printf("Error while searching for anime from api: %v", err)
 		}
 
-		results, err := database.SearchMedia(searchQuery, "ANIME", isNsfwChannel)
+		results, err := database.SearchMedia(ctx, parsedQuery, "ANIME", isNsfwChannel)
 
 		if err != nil {
 			fmt.Printf("Error while searching for anime from db: %v", err)
 
 			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
-				Embeds: helpers.GetDefaultEmbed("Error occurred while searching for anime"),
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error occurred while searching for anime"),
 			})
 			return
 		}
@@ -53,22 +68,29 @@ func HandleAnimeCommand(event *handler.CommandEvent) error {
 			return
 		}
 
-		// if there are more than one results, store search query
-		searchQuery, err := database.SaveSearchQuery(&structs.AnilistSearchQuery{
+		// store the results so paging through them keeps showing the same media
+		resultIDs := make([]primitive.ObjectID, len(results))
+		for i, media := range results {
+			resultIDs[i] = media.ID
+		}
+
+		searchQuery, err := database.SaveSearchQuery(ctx, &structs.AnilistSearchQuery{
 			SearchText: searchQuery,
 			MediaType:  "ANIME",
+			NSFW:       isNsfwChannel,
+			ResultIDs:  resultIDs,
 		})
 
 		if err != nil {
 			fmt.Printf("Error while saving search query: %v", err)
 
 			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
-				Embeds: helpers.GetDefaultEmbed("Error occurred while searching for anime"),
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error occurred while searching for anime"),
 			})
 			return
 		}
 
-		animeMsg := helpers.GetMediaSearchMessage(&results, 1, searchQuery.ID.Hex(), event.User().ID.String(), "ANIME")
+		animeMsg := helpers.GetMediaSearchMessage(&results[0], 1, len(results), searchQuery.ID, event.User().ID, "ANIME")
 		_, err = event.UpdateInteractionResponse(animeMsg)
 	}()
 
@@ -1,24 +1,22 @@
 package commands
 
 import (
-	"ipmanlk/saika/helpers"
-
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/handler"
 )
 
 func HandleAnimeListCommand(event *handler.CommandEvent) error {
-	event.DeferCreateMessage(true)
-
-	go func() {
-		message := helpers.GetInitialMediaListMessage(event.User(), "ANIME")
-		_, _ = event.UpdateInteractionResponse(message)
-	}()
-
-	return nil
+	return handleMediaListsCommand(event, listOwner(event), "ANIME")
 }
 
 var AnimeListCommandData = discord.SlashCommandCreate{
 	Name:        "anime-lists",
-	Description: "View your anime lists",
+	Description: "View your anime lists, or someone else's",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionUser{
+			Name:        "user",
+			Description: "Whose lists to view, yours by default",
+			Required:    false,
+		},
+	},
 }
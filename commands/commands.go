@@ -31,12 +31,70 @@ var SlashCommandList = map[string]SlashCommand{
 		Handler: HandleMangaListCommand,
 	},
 
+	ReviewsCommandData.Name: {
+		Data:    ReviewsCommandData,
+		Handler: HandleReviewsCommand,
+	},
+
+	FavouritesCommandData.Name: {
+		Data:    FavouritesCommandData,
+		Handler: HandleFavouritesCommand,
+	},
+
+	StatsCommandData.Name: {
+		Data:    StatsCommandData,
+		Handler: HandleStatsCommand,
+	},
+
+	CompareCommandData.Name: {
+		Data:    CompareCommandData,
+		Handler: HandleCompareCommand,
+	},
+
+	LeaderboardCommandData.Name: {
+		Data:    LeaderboardCommandData,
+		Handler: HandleLeaderboardCommand,
+	},
+
+	ServerTopCommandData.Name: {
+		Data:    ServerTopCommandData,
+		Handler: HandleServerTopCommand,
+	},
+
+	ListsCommandData.Name: {
+		Data:    ListsCommandData,
+		Handler: HandleListsCommand,
+	},
+
+	SettingsCommandData.Name: {
+		Data:    SettingsCommandData,
+		Handler: HandleSettingsCommand,
+	},
+
 	AboutCommandData.Name: {
 		Data:    AboutCommandData,
 		Handler: HandleAboutCommand,
 	},
 }
 
+type UserCommand struct {
+	Data    discord.UserCommandCreate
+	Handler func(event *handler.CommandEvent) error
+}
+
+// UserCommandList has the commands of the Apps menu of a user, routed by their name.
+var UserCommandList = map[string]UserCommand{
+	ViewAnimeListCommandData.Name: {
+		Data:    ViewAnimeListCommandData,
+		Handler: HandleViewAnimeListCommand,
+	},
+
+	ViewMangaListCommandData.Name: {
+		Data:    ViewMangaListCommandData,
+		Handler: HandleViewMangaListCommand,
+	},
+}
+
 func GetSlashCommandRegisterData() []discord.ApplicationCommandCreate {
 	registerCommands := make([]discord.ApplicationCommandCreate, 0, len(SlashCommandList))
 	for _, command := range SlashCommandList {
@@ -44,3 +102,11 @@ func GetSlashCommandRegisterData() []discord.ApplicationCommandCreate {
 	}
 	return registerCommands
 }
+
+func GetUserCommandRegisterData() []discord.ApplicationCommandCreate {
+	registerCommands := make([]discord.ApplicationCommandCreate, 0, len(UserCommandList))
+	for _, command := range UserCommandList {
+		registerCommands = append(registerCommands, command.Data)
+	}
+	return registerCommands
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleCompareCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(false)
+
+	data := event.SlashCommandInteractionData()
+	other := data.User("user")
+
+	mediaType := "ANIME"
+	if chosen, ok := data.OptString("type"); ok {
+		mediaType = chosen
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		switch {
+		case other.ID == event.User().ID:
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetErrorEmbed("Pick someone other than yourself to compare with!"),
+			})
+			return
+		case other.Bot:
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetErrorEmbed("Bots don't keep lists."),
+			})
+			return
+		}
+
+		allowed, err := helpers.CanViewUserLists(ctx, event.Client(), event.GuildID(), event.User().ID, other)
+		if err != nil {
+			log.Printf("Error checking list privacy: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error comparing your lists"),
+			})
+			return
+		}
+		if !allowed {
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetListPrivacyErrorEmbed(other),
+			})
+			return
+		}
+
+		comparison, err := database.CompareUserMedia(ctx, event.User().ID, other.ID, mediaType)
+		if err != nil {
+			log.Printf("Error comparing user lists: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error comparing your lists"),
+			})
+			return
+		}
+
+		message := helpers.GetComparisonMessage(event.User(), other, comparison, helpers.CompareDisagreements, 1, helpers.GetScoreFormat(ctx, event.User().ID))
+		_, _ = event.UpdateInteractionResponse(message)
+	}()
+
+	return nil
+}
+
+var CompareCommandData = discord.SlashCommandCreate{
+	Name:        "compare",
+	Description: "Compare your list with someone else's",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionUser{
+			Name:        "user",
+			Description: "Who to compare with",
+			Required:    true,
+		},
+		discord.ApplicationCommandOptionString{
+			Name:        "type",
+			Description: "Compare anime or manga, anime by default",
+			Required:    false,
+			Choices: []discord.ApplicationCommandOptionChoiceString{
+				{Name: "Anime", Value: "ANIME"},
+				{Name: "Manga", Value: "MANGA"},
+			},
+		},
+	},
+}
@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/structs"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func HandleFavouritesCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(true)
+
+	data := event.SlashCommandInteractionData()
+	mediaType := data.String("type")
+	mediaName := data.String("media")
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		var favourites []structs.FavouriteEntry
+		var err error
+
+		switch *data.SubCommandName {
+		case "view":
+			favourites, err = database.GetUserFavourites(ctx, event.User().ID, mediaType)
+		case "move":
+			favourites, err = moveUserFavourite(ctx, event.User().ID, mediaType, mediaName, data.Int("position"))
+		case "remove":
+			favourites, err = removeUserFavourite(ctx, event.User().ID, mediaType, mediaName)
+		}
+
+		if err != nil {
+			log.Printf("Error updating favourites: %s", err.Error())
+
+			embeds := helpers.GetDatabaseErrorEmbed(err, "Error updating your favourites")
+			if errors.Is(err, database.ErrNotFound) {
+				embeds = helpers.GetErrorEmbed(fmt.Sprintf("%q isn't one of your favourites.", mediaName))
+			}
+
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: embeds,
+			})
+			return
+		}
+
+		// every subcommand ends with the favourites as they are now
+		_, _ = event.UpdateInteractionResponse(helpers.GetFavouritesMessage(event.User(), mediaType, favourites))
+	}()
+
+	return nil
+}
+
+func moveUserFavourite(ctx context.Context, userID snowflake.ID, mediaType string, mediaName string, position int) ([]structs.FavouriteEntry, error) {
+	favourite, err := findUserFavourite(ctx, userID, mediaType, mediaName)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.MoveUserFavourite(ctx, userID, mediaType, favourite.IdAnilist, position)
+}
+
+func removeUserFavourite(ctx context.Context, userID snowflake.ID, mediaType string, mediaName string) ([]structs.FavouriteEntry, error) {
+	favourite, err := findUserFavourite(ctx, userID, mediaType, mediaName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.DeleteUserFavourite(ctx, userID, mediaType, favourite.IdAnilist); err != nil {
+		return nil, err
+	}
+
+	return database.GetUserFavourites(ctx, userID, mediaType)
+}
+
+// findUserFavourite looks up one of the user's favourites by the AniList ID autocomplete
+// puts in the option, or by its title when the user typed it out instead.
+func findUserFavourite(ctx context.Context, userID snowflake.ID, mediaType string, mediaName string) (*structs.FavouriteEntry, error) {
+	favourites, err := database.GetUserFavourites(ctx, userID, mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	idAnilist, _ := strconv.Atoi(mediaName)
+	for i := range favourites {
+		if favourites[i].IdAnilist == idAnilist || strings.EqualFold(favourites[i].GetTitle(), strings.TrimSpace(mediaName)) {
+			return &favourites[i], nil
+		}
+	}
+
+	return nil, database.ErrNotFound
+}
+
+// HandleFavouritesAutocomplete suggests the user's favourites of the chosen type whose
+// titles contain what has been typed so far.
+func HandleFavouritesAutocomplete(event *handler.AutocompleteEvent) error {
+	mediaType, ok := event.Data.OptString("type")
+	if !ok {
+		return event.Result([]discord.AutocompleteChoice{})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), autocompleteTimeout)
+	defer cancel()
+
+	favourites, err := database.GetUserFavourites(ctx, event.User().ID, mediaType)
+	if err != nil {
+		log.Printf("Error getting favourites: %s", err.Error())
+		return event.Result([]discord.AutocompleteChoice{})
+	}
+
+	typed := strings.ToLower(strings.TrimSpace(event.Data.String("media")))
+
+	choices := []discord.AutocompleteChoice{}
+	for i, favourite := range favourites {
+		title := favourite.GetTitle()
+		if strings.Contains(strings.ToLower(title), typed) {
+			// choice names are limited to 100 characters
+			name := fmt.Sprintf("%d. %s", i+1, title)
+			if len([]rune(name)) > 100 {
+				name = string([]rune(name)[:99]) + "…"
+			}
+			choices = append(choices, discord.AutocompleteChoiceString{Name: name, Value: strconv.Itoa(favourite.IdAnilist)})
+		}
+	}
+
+	return event.Result(choices)
+}
+
+var favouriteTypeOption = discord.ApplicationCommandOptionString{
+	Name:        "type",
+	Description: "Anime or manga favourites",
+	Required:    true,
+	Choices: []discord.ApplicationCommandOptionChoiceString{
+		{Name: "Anime", Value: "ANIME"},
+		{Name: "Manga", Value: "MANGA"},
+	},
+}
+
+var favouriteMediaOption = discord.ApplicationCommandOptionString{
+	Name:        "media",
+	Description: "One of your favourites",
+	Required:    true,
+	// the choices are the user's own favourites
+	Autocomplete: true,
+}
+
+var (
+	favouritePositionMin = 1
+	favouritePositionMax = database.MaxFavourites
+)
+
+var FavouritesCommandData = discord.SlashCommandCreate{
+	Name:        "favourites",
+	Description: "View and reorder your favourites",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionSubCommand{
+			Name:        "view",
+			Description: "View your favourites",
+			Options: []discord.ApplicationCommandOption{
+				favouriteTypeOption,
+			},
+		},
+		discord.ApplicationCommandOptionSubCommand{
+			Name:        "move",
+			Description: "Move one of your favourites to another position",
+			Options: []discord.ApplicationCommandOption{
+				favouriteTypeOption,
+				favouriteMediaOption,
+				discord.ApplicationCommandOptionInt{
+					Name:        "position",
+					Description: "New position, 1 is the top",
+					Required:    true,
+					MinValue:    &favouritePositionMin,
+					MaxValue:    &favouritePositionMax,
+				},
+			},
+		},
+		discord.ApplicationCommandOptionSubCommand{
+			Name:        "remove",
+			Description: "Remove one of your favourites",
+			Options: []discord.ApplicationCommandOption{
+				favouriteTypeOption,
+				favouriteMediaOption,
+			},
+		},
+	},
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/structs"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleLeaderboardCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(false)
+
+	board := structs.LeaderboardAnimeCompleted
+	if chosen, ok := event.SlashCommandInteractionData().OptString("board"); ok {
+		board = structs.Leaderboard(chosen)
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		guildID := event.GuildID()
+		if guildID == nil {
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetErrorEmbed("Leaderboards only work in a server."),
+			})
+			return
+		}
+
+		message, err := helpers.LoadLeaderboardMessage(ctx, event.Client(), *guildID, event.User(), board)
+		if err != nil {
+			log.Printf("Error getting leaderboard: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting the leaderboard"),
+			})
+			return
+		}
+
+		_, _ = event.UpdateInteractionResponse(message)
+	}()
+
+	return nil
+}
+
+func leaderboardChoices() []discord.ApplicationCommandOptionChoiceString {
+	choices := make([]discord.ApplicationCommandOptionChoiceString, len(structs.Leaderboards))
+	for i, board := range structs.Leaderboards {
+		choices[i] = discord.ApplicationCommandOptionChoiceString{Name: board.Label(), Value: string(board)}
+	}
+	return choices
+}
+
+// guildOnly keeps commands out of DMs, where there is no server to rank.
+var guildOnly = false
+
+var LeaderboardCommandData = discord.SlashCommandCreate{
+	Name:         "leaderboard",
+	Description:  "See who is ahead in this server",
+	DMPermission: &guildOnly,
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionString{
+			Name:        "board",
+			Description: "What to rank members by, anime completed by default",
+			Required:    false,
+			Choices:     leaderboardChoices(),
+		},
+	},
+}
@@ -0,0 +1,246 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/structs"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Longest name of a custom list, names are shown in select menu options.
+const maxListNameLength = 50
+
+// Discord drops autocomplete responses that take longer than this.
+const autocompleteTimeout = 2500 * time.Millisecond
+
+func HandleListsCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(true)
+
+	data := event.SlashCommandInteractionData()
+	mediaType := data.String("type")
+	listName := data.String("list")
+	name := normalizeListName(data.String("name"))
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		var message string
+		var err error
+
+		switch *data.SubCommandName {
+		case "create":
+			message, err = createUserList(ctx, event.User().ID, mediaType, name)
+		case "rename":
+			message, err = renameUserList(ctx, event.User().ID, mediaType, listName, name)
+		case "delete":
+			message, err = deleteUserList(ctx, event.User().ID, mediaType, listName)
+		}
+
+		if err != nil {
+			log.Printf("Error updating custom lists: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: getUserListErrorEmbed(err, listName),
+			})
+			return
+		}
+
+		_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+			Embeds: helpers.GetDefaultEmbed(message),
+		})
+	}()
+
+	return nil
+}
+
+func createUserList(ctx context.Context, userID snowflake.ID, mediaType string, name string) (string, error) {
+	if name == "" {
+		return "", errInvalidListName
+	}
+
+	list, err := database.CreateUserList(ctx, &structs.UserList{
+		UserID:    userID,
+		MediaType: mediaType,
+		Name:      name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Created **%s**. Add entries to it from your %s.", list.Name, listCommandName(mediaType)), nil
+}
+
+func renameUserList(ctx context.Context, userID snowflake.ID, mediaType string, listName string, name string) (string, error) {
+	if name == "" {
+		return "", errInvalidListName
+	}
+
+	list, err := findUserList(ctx, userID, mediaType, listName)
+	if err != nil {
+		return "", err
+	}
+
+	renamed, err := database.RenameUserList(ctx, userID, list.ID, name)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Renamed **%s** to **%s**.", list.Name, renamed.Name), nil
+}
+
+func deleteUserList(ctx context.Context, userID snowflake.ID, mediaType string, listName string) (string, error) {
+	list, err := findUserList(ctx, userID, mediaType, listName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.DeleteUserList(ctx, userID, list.ID); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Deleted **%s**. Its entries are still on your %s.", list.Name, listCommandName(mediaType)), nil
+}
+
+var errInvalidListName = errors.New("invalid list name")
+
+// findUserList looks up one of the user's custom lists by name, ignoring case.
+func findUserList(ctx context.Context, userID snowflake.ID, mediaType string, name string) (*structs.UserList, error) {
+	lists, err := database.GetUserLists(ctx, userID, mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	name = normalizeListName(name)
+	for i := range lists {
+		if strings.EqualFold(lists[i].Name, name) {
+			return &lists[i], nil
+		}
+	}
+
+	return nil, database.ErrNotFound
+}
+
+func getUserListErrorEmbed(err error, listName string) *[]discord.Embed {
+	switch {
+	case errors.Is(err, errInvalidListName):
+		return helpers.GetErrorEmbed("Please provide a name for the list!")
+	case errors.Is(err, database.ErrDuplicate):
+		return helpers.GetErrorEmbed("You already have a list with that name.")
+	case errors.Is(err, database.ErrUserListLimit):
+		return helpers.GetErrorEmbed(fmt.Sprintf("You can have at most %d custom lists of each type.", database.MaxUserLists))
+	case errors.Is(err, database.ErrNotFound):
+		return helpers.GetErrorEmbed(fmt.Sprintf("You don't have a list called %q.", listName))
+	}
+	return helpers.GetDatabaseErrorEmbed(err, "Error updating your lists")
+}
+
+// normalizeListName trims a list name and collapses the whitespace in it.
+func normalizeListName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func listCommandName(mediaType string) string {
+	if mediaType == "MANGA" {
+		return "/manga-lists"
+	}
+	return "/anime-lists"
+}
+
+// HandleListsAutocomplete suggests the user's lists of the chosen type whose names
+// contain what has been typed so far.
+func HandleListsAutocomplete(event *handler.AutocompleteEvent) error {
+	mediaType, ok := event.Data.OptString("type")
+	if !ok {
+		return event.Result([]discord.AutocompleteChoice{})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), autocompleteTimeout)
+	defer cancel()
+
+	lists, err := database.GetUserLists(ctx, event.User().ID, mediaType)
+	if err != nil {
+		log.Printf("Error getting custom lists: %s", err.Error())
+		return event.Result([]discord.AutocompleteChoice{})
+	}
+
+	typed := strings.ToLower(normalizeListName(event.Data.String("list")))
+
+	choices := []discord.AutocompleteChoice{}
+	for _, list := range lists {
+		if strings.Contains(strings.ToLower(list.Name), typed) {
+			choices = append(choices, discord.AutocompleteChoiceString{Name: list.Name, Value: list.Name})
+		}
+	}
+
+	return event.Result(choices)
+}
+
+var listTypeOption = discord.ApplicationCommandOptionString{
+	Name:        "type",
+	Description: "Whether it is an anime or a manga list",
+	Required:    true,
+	Choices: []discord.ApplicationCommandOptionChoiceString{
+		{Name: "Anime", Value: "ANIME"},
+		{Name: "Manga", Value: "MANGA"},
+	},
+}
+
+var listNameOption = discord.ApplicationCommandOptionString{
+	Name:        "list",
+	Description: "One of your custom lists",
+	Required:    true,
+	// the choices are the user's own lists
+	Autocomplete: true,
+}
+
+func newListNameOption(description string) discord.ApplicationCommandOptionString {
+	maxLength := maxListNameLength
+	return discord.ApplicationCommandOptionString{
+		Name:        "name",
+		Description: description,
+		Required:    true,
+		MaxLength:   &maxLength,
+	}
+}
+
+var ListsCommandData = discord.SlashCommandCreate{
+	Name:        "lists",
+	Description: "Manage your custom lists",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionSubCommand{
+			Name:        "create",
+			Description: "Create a custom list",
+			Options: []discord.ApplicationCommandOption{
+				listTypeOption,
+				newListNameOption("Name of the new list"),
+			},
+		},
+		discord.ApplicationCommandOptionSubCommand{
+			Name:        "rename",
+			Description: "Rename one of your custom lists",
+			Options: []discord.ApplicationCommandOption{
+				listTypeOption,
+				listNameOption,
+				newListNameOption("New name of the list"),
+			},
+		},
+		discord.ApplicationCommandOptionSubCommand{
+			Name:        "delete",
+			Description: "Delete one of your custom lists, its entries stay on your lists",
+			Options: []discord.ApplicationCommandOption{
+				listTypeOption,
+				listNameOption,
+			},
+		},
+	},
+}
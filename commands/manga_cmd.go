@@ -5,12 +5,14 @@ import (
 	"ipmanlk/saika/anilist"
 	"ipmanlk/saika/database"
 	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/search"
 	"ipmanlk/saika/structs"
 	"log"
 	"strings"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/handler"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func HandleMangaCommand(event *handler.CommandEvent) error {
@@ -25,25 +27,38 @@ func HandleMangaCommand(event *handler.CommandEvent) error {
 		return error
 	}
 
+	parsedQuery, err := search.Parse(searchQuery)
+
+	if err != nil {
+		_, err = event.UpdateInteractionResponse(discord.MessageUpdate{
+			Embeds: helpers.GetErrorEmbed(err.Error()),
+		})
+		return err
+	}
+
 	cachedChannel, _ := event.MessageChannel()
 	isNsfwChannel := cachedChannel.NSFW()
 
 	log.Println("NSFW Channel: ", isNsfwChannel)
 
+	ctx, cancel := helpers.InteractionContext(event)
+
 	go func() {
-		_, err := anilist.SearchMedia(searchQuery, "MANGA")
+		defer cancel()
+
+		_, err := anilist.SearchMedia(ctx, parsedQuery, "MANGA")
 
 		if err != nil {
 			fmt.Printf("Error while searching for manga from api: %v", err)
 		}
 
-		results, err := database.SearchMedia(searchQuery, "MANGA", isNsfwChannel)
+		results, err := database.SearchMedia(ctx, parsedQuery, "MANGA", isNsfwChannel)
 
 		if err != nil {
 			fmt.Printf("Error while searching for manga from db: %v", err)
 
 			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
-				Embeds: helpers.GetDefaultEmbed("Error occurred while searching for manga"),
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error occurred while searching for manga"),
 			})
 			return
 		}
@@ -55,22 +70,29 @@ func HandleMangaCommand(event *handler.CommandEvent) error {
 			return
 		}
 
-		// if there are more than one results, store search query
-		searchQuery, err := database.SaveSearchQuery(&structs.AnilistSearchQuery{
+		// store the results so paging through them keeps showing the same media
+		resultIDs := make([]primitive.ObjectID, len(results))
+		for i, media := range results {
+			resultIDs[i] = media.ID
+		}
+
+		searchQuery, err := database.SaveSearchQuery(ctx, &structs.AnilistSearchQuery{
 			SearchText: searchQuery,
 			MediaType:  "MANGA",
+			NSFW:       isNsfwChannel,
+			ResultIDs:  resultIDs,
 		})
 
 		if err != nil {
 			fmt.Printf("Error while saving search query: %v", err)
 
 			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
-				Embeds: helpers.GetDefaultEmbed("Error occurred while searching for manga"),
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error occurred while searching for manga"),
 			})
 			return
 		}
 
-		animeMsg := helpers.GetMediaSearchMessage(&results, 1, searchQuery.ID.Hex(), event.User().ID.String(), "MANGA")
+		animeMsg := helpers.GetMediaSearchMessage(&results[0], 1, len(results), searchQuery.ID, event.User().ID, "MANGA")
 		_, err = event.UpdateInteractionResponse(animeMsg)
 	}()
 
@@ -1,25 +1,22 @@
 package commands
 
 import (
-	"ipmanlk/saika/helpers"
-
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/handler"
 )
 
 func HandleMangaListCommand(event *handler.CommandEvent) error {
-	event.DeferCreateMessage(true)
-
-	go func() {
-		message := helpers.GetInitialMediaListMessage(event.User(), "MANGA")
-
-		_, _ = event.UpdateInteractionResponse(message)
-	}()
-
-	return nil
+	return handleMediaListsCommand(event, listOwner(event), "MANGA")
 }
 
 var MangaListCommandData = discord.SlashCommandCreate{
 	Name:        "manga-lists",
-	Description: "View your manga lists",
+	Description: "View your manga lists, or someone else's",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionUser{
+			Name:        "user",
+			Description: "Whose lists to view, yours by default",
+			Required:    false,
+		},
+	},
 }
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+// handleMediaListsCommand shows the list overview of owner to the user who ran the
+// command. Their own lists are only shown to them, someone else's to the channel.
+func handleMediaListsCommand(event *handler.CommandEvent, owner discord.User, mediaType string) error {
+	ownLists := owner.ID == event.User().ID
+	event.DeferCreateMessage(ownLists)
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		// refusals are only shown to the user who asked
+		refuse := func(embeds *[]discord.Embed) {
+			_ = event.DeleteInteractionResponse()
+			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *embeds,
+				Flags:  discord.MessageFlagEphemeral,
+			})
+		}
+
+		if owner.Bot {
+			refuse(helpers.GetErrorEmbed("Bots don't keep lists."))
+			return
+		}
+
+		allowed, err := helpers.CanViewUserLists(ctx, event.Client(), event.GuildID(), event.User().ID, owner)
+		if err != nil {
+			log.Printf("Error checking list privacy: %s", err.Error())
+			refuse(helpers.GetDatabaseErrorEmbed(err, "Error getting user media"))
+			return
+		}
+		if !allowed {
+			refuse(helpers.GetListPrivacyErrorEmbed(owner))
+			return
+		}
+
+		message, err := helpers.LoadInitialMediaListMessage(ctx, owner, event.User().ID, mediaType)
+		if err != nil {
+			log.Printf("Error getting user media: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting user media"),
+			})
+			return
+		}
+
+		_, _ = event.UpdateInteractionResponse(message)
+	}()
+
+	return nil
+}
+
+// listOwner is the user picked with the user option of a list command, or the user who
+// ran it.
+func listOwner(event *handler.CommandEvent) discord.User {
+	if user, ok := event.SlashCommandInteractionData().OptUser("user"); ok {
+		return user
+	}
+	return event.User()
+}
+
+func HandleViewAnimeListCommand(event *handler.CommandEvent) error {
+	return handleMediaListsCommand(event, event.UserCommandInteractionData().TargetUser(), "ANIME")
+}
+
+func HandleViewMangaListCommand(event *handler.CommandEvent) error {
+	return handleMediaListsCommand(event, event.UserCommandInteractionData().TargetUser(), "MANGA")
+}
+
+var ViewAnimeListCommandData = discord.UserCommandCreate{
+	Name: "View anime list",
+}
+
+var ViewMangaListCommandData = discord.UserCommandCreate{
+	Name: "View manga list",
+}
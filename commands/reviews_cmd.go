@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleReviewsCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(false)
+
+	// defaults to the user's own reviews
+	user := event.User()
+	if reviewer, ok := event.SlashCommandInteractionData().OptUser("user"); ok {
+		user = reviewer
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		// reviews are part of the lists, so they are as private as them
+		allowed, err := helpers.CanViewUserLists(ctx, event.Client(), event.GuildID(), event.User().ID, user)
+		if err != nil {
+			log.Printf("Error checking list privacy: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting reviews"),
+			})
+			return
+		}
+		if !allowed {
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetListPrivacyErrorEmbed(user),
+			})
+			return
+		}
+
+		reviewsPage, err := database.GetUserReviewsPage(ctx, user.ID, 1)
+		if err != nil {
+			log.Printf("Error getting user reviews: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting reviews"),
+			})
+			return
+		}
+
+		message := helpers.GetReviewsMessage(user, event.User().ID, reviewsPage, helpers.GetScoreFormat(ctx, event.User().ID))
+		_, _ = event.UpdateInteractionResponse(message)
+	}()
+
+	return nil
+}
+
+var ReviewsCommandData = discord.SlashCommandCreate{
+	Name:        "reviews",
+	Description: "Browse written reviews",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionUser{
+			Name:        "user",
+			Description: "Whose reviews to browse, yours by default",
+			Required:    false,
+		},
+	},
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleServerTopCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(false)
+
+	data := event.SlashCommandInteractionData()
+
+	mediaType := "ANIME"
+	if chosen, ok := data.OptString("type"); ok {
+		mediaType = chosen
+	}
+
+	minRatings := database.MinGuildRatings
+	if chosen, ok := data.OptInt("min_ratings"); ok {
+		minRatings = chosen
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		guildID := event.GuildID()
+		if guildID == nil {
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetErrorEmbed("Server rankings only work in a server."),
+			})
+			return
+		}
+
+		entries, err := helpers.LoadServerTopMedia(ctx, event.Client(), *guildID, mediaType, minRatings)
+		if err != nil {
+			log.Printf("Error getting guild top media: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting the server's top media"),
+			})
+			return
+		}
+
+		message := helpers.GetServerTopMessage(helpers.GetGuildName(event.Client(), *guildID), event.User(), mediaType, entries, minRatings, 1, helpers.GetScoreFormat(ctx, event.User().ID))
+		_, _ = event.UpdateInteractionResponse(message)
+	}()
+
+	return nil
+}
+
+var (
+	serverTopMinRatingsMin = 1
+	serverTopMinRatingsMax = 100
+)
+
+var ServerTopCommandData = discord.SlashCommandCreate{
+	Name:         "server-top",
+	Description:  "See the media this server's members rate best",
+	DMPermission: &guildOnly,
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionString{
+			Name:        "type",
+			Description: "Rank anime or manga, anime by default",
+			Required:    false,
+			Choices: []discord.ApplicationCommandOptionChoiceString{
+				{Name: "Anime", Value: "ANIME"},
+				{Name: "Manga", Value: "MANGA"},
+			},
+		},
+		discord.ApplicationCommandOptionInt{
+			Name:        "min_ratings",
+			Description: "How many members need to have scored a media, 3 by default",
+			Required:    false,
+			MinValue:    &serverTopMinRatingsMin,
+			MaxValue:    &serverTopMinRatingsMax,
+		},
+	},
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"log"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleSettingsCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(true)
+
+	data := event.SlashCommandInteractionData()
+	format, changeFormat := data.OptString("score_format")
+	privacy, changePrivacy := data.OptString("list_privacy")
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		var settings *structs.UserSettings
+		var err error
+
+		// without options the current settings are shown
+		if changeFormat {
+			settings, err = database.SetUserScoreFormat(ctx, event.User().ID, score.Format(format))
+		}
+		if err == nil && changePrivacy {
+			settings, err = database.SetUserListPrivacy(ctx, event.User().ID, structs.ListPrivacy(privacy))
+		}
+		if err == nil && settings == nil {
+			settings, err = database.GetUserSettings(ctx, event.User().ID)
+		}
+
+		if err != nil {
+			log.Printf("Error updating user settings: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error updating your settings"),
+			})
+			return
+		}
+
+		embed := discord.NewEmbedBuilder().
+			SetTitle("Your Settings").
+			SetColor(0x7B1FA2).
+			AddField("Score Format", settings.ScoreFormat.Label(), true).
+			AddField("List Privacy", settings.ListPrivacy.Label(), true).
+			SetFooterText("Change them with the options of /settings")
+
+		changes := []string{}
+		if changeFormat {
+			changes = append(changes, fmt.Sprintf("Your scores will be shown like %s from now on.", settings.ScoreFormat.String(75)))
+		}
+		if changePrivacy {
+			changes = append(changes, listPrivacyDescriptions[settings.ListPrivacy])
+		}
+		if len(changes) > 0 {
+			embed.SetDescription(strings.Join(changes, "\n"))
+		}
+
+		_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+			Embeds: &[]discord.Embed{embed.Build()},
+		})
+	}()
+
+	return nil
+}
+
+func scoreFormatChoices() []discord.ApplicationCommandOptionChoiceString {
+	choices := make([]discord.ApplicationCommandOptionChoiceString, len(score.Formats))
+	for i, format := range score.Formats {
+		choices[i] = discord.ApplicationCommandOptionChoiceString{Name: format.Label(), Value: string(format)}
+	}
+	return choices
+}
+
+func listPrivacyChoices() []discord.ApplicationCommandOptionChoiceString {
+	choices := make([]discord.ApplicationCommandOptionChoiceString, len(structs.ListPrivacies))
+	for i, privacy := range structs.ListPrivacies {
+		choices[i] = discord.ApplicationCommandOptionChoiceString{Name: privacy.Label(), Value: string(privacy)}
+	}
+	return choices
+}
+
+var listPrivacyDescriptions = map[structs.ListPrivacy]string{
+	structs.ListPublic:     "Anyone can look at your lists now.",
+	structs.ListServerOnly: "Only members of servers you are in can look at your lists now.",
+	structs.ListPrivate:    "Only you can look at your lists now.",
+}
+
+var SettingsCommandData = discord.SlashCommandCreate{
+	Name:        "settings",
+	Description: "View or change your settings",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionString{
+			Name:        "score_format",
+			Description: "How your scores are shown and entered",
+			Required:    false,
+			Choices:     scoreFormatChoices(),
+		},
+		discord.ApplicationCommandOptionString{
+			Name:        "list_privacy",
+			Description: "Who can look at your lists",
+			Required:    false,
+			Choices:     listPrivacyChoices(),
+		},
+	},
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleStatsCommand(event *handler.CommandEvent) error {
+	event.DeferCreateMessage(false)
+
+	mediaType := "ANIME"
+	if chosen, ok := event.SlashCommandInteractionData().OptString("type"); ok {
+		mediaType = chosen
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+
+	go func() {
+		defer cancel()
+
+		stats, err := database.GetUserMediaStats(ctx, event.User().ID, mediaType)
+		if err != nil {
+			log.Printf("Error getting user stats: %s", err.Error())
+			_, _ = event.UpdateInteractionResponse(discord.MessageUpdate{
+				Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting your stats"),
+			})
+			return
+		}
+
+		message := helpers.GetStatsMessage(event.User(), stats, helpers.StatsOverviewPage, helpers.GetScoreFormat(ctx, event.User().ID))
+		_, _ = event.UpdateInteractionResponse(message)
+	}()
+
+	return nil
+}
+
+var StatsCommandData = discord.SlashCommandCreate{
+	Name:        "stats",
+	Description: "See the numbers behind your lists",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionString{
+			Name:        "type",
+			Description: "Anime or manga stats, anime by default",
+			Required:    false,
+			Choices: []discord.ApplicationCommandOptionChoiceString{
+				{Name: "Anime", Value: "ANIME"},
+				{Name: "Manga", Value: "MANGA"},
+			},
+		},
+	},
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,3 +21,18 @@ func GetEnv(key string, fallback string) string {
 	}
 	return value
 }
+
+// GetDurationEnv reads a duration such as "90m" or "24h". Invalid values stop
+// the bot, so a typo doesn't silently fall back to the default.
+func GetDurationEnv(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("%s must be a positive duration such as \"24h\", got %q", key, value)
+	}
+	return duration
+}
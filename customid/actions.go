@@ -0,0 +1,713 @@
+package customid
+
+import (
+	"ipmanlk/saika/listview"
+	"math"
+
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	mediaTypes = []string{"ANIME", "MANGA"}
+	statuses   = []string{"PLANNING", "CURRENT", "COMPLETED", "PAUSED", "DROPPED", "REPEATING"}
+	// where a rating or favourite was started from, "list" is the media view of a list entry
+	origins = []string{"list", "search"}
+	// the select menus of a list page, they need their own custom IDs
+	viewControls = []string{"sort", "genre", "filter"}
+	// the pages of /stats
+	statsPages = []string{"overview", "scores", "genres", "formats"}
+	// the lists of /compare, "user" is the user who ran it
+	compareSections = []string{"disagreements", "agreements", "user_completed", "other_completed"}
+	// the rankings of /leaderboard
+	leaderboards = []string{"ANIME_COMPLETED", "MANGA_COMPLETED", "EPISODES", "CHAPTERS", "ACTIVE"}
+)
+
+const (
+	maxPage       = 10000
+	maxIdAnilist  = math.MaxInt32
+	maxMinRatings = 1000
+)
+
+// customList takes the place of the status for custom lists, followed by the list's ID.
+const customList = "LIST"
+
+// list writes a status list, or the custom list listID when status is empty.
+func (w *writer) list(status string, listID primitive.ObjectID) {
+	if status != "" {
+		w.String(status)
+		return
+	}
+	w.String(customList)
+	w.ObjectID(listID)
+}
+
+// list reads a field written by writer.list, giving an empty status for custom lists.
+func (r *reader) list() (string, primitive.ObjectID) {
+	status := r.Enum(append(statuses, customList)...)
+	if status == customList {
+		return "", r.ObjectID()
+	}
+	return status, primitive.NilObjectID
+}
+
+// view writes the sort order and filters of a list page.
+func (w *writer) view(view listview.View) {
+	w.String(view.Encode())
+}
+
+func (r *reader) view() listview.View {
+	field, ok := r.next()
+	if !ok {
+		return listview.View{}
+	}
+
+	view, err := listview.Decode(field)
+	if err != nil {
+		r.fail("invalid list view %q", field)
+	}
+	return view
+}
+
+// ListPosition is the list page a list entry was opened from, so the entry's view can
+// go back to it. ListID is nil for status lists, the list is then the entry's status.
+type ListPosition struct {
+	ListID primitive.ObjectID
+	Page   int
+	View   listview.View
+}
+
+func (w *writer) position(position ListPosition) {
+	w.OptionalObjectID(position.ListID)
+	w.Int(position.Page)
+	w.view(position.View)
+}
+
+func (r *reader) position() ListPosition {
+	listID := r.OptionalObjectID()
+	page := r.Int(1, maxPage)
+	return ListPosition{ListID: listID, Page: page, View: r.view()}
+}
+
+// MediaResultsPage is a Prev/Next button of /anime and /manga results.
+type MediaResultsPage struct {
+	OwnerID       snowflake.ID
+	SearchQueryID primitive.ObjectID
+	Page          int
+}
+
+func (a *MediaResultsPage) Name() string { return "btn_media_results" }
+
+func (a *MediaResultsPage) encode(w *writer) {
+	w.Snowflake(a.OwnerID)
+	w.ObjectID(a.SearchQueryID)
+	w.Int(a.Page)
+}
+
+func (a *MediaResultsPage) decode(r *reader) {
+	a.OwnerID = r.Snowflake()
+	a.SearchQueryID = r.ObjectID()
+	a.Page = r.Int(1, maxPage)
+}
+
+// MediaActionMenu is the "Add to list" select menu of a search result, see MediaActionOption.
+type MediaActionMenu struct{}
+
+func (a *MediaActionMenu) Name() string   { return "sm_media_action" }
+func (a *MediaActionMenu) encode(*writer) {}
+func (a *MediaActionMenu) decode(*reader) {}
+
+// MediaActionOption is an option of MediaActionMenu, adding media to one of the lists.
+type MediaActionOption struct {
+	IdAnilist int
+	Status    string
+}
+
+func (a *MediaActionOption) Name() string { return "opt_media_action" }
+
+func (a *MediaActionOption) encode(w *writer) {
+	w.Int(a.IdAnilist)
+	w.String(a.Status)
+}
+
+func (a *MediaActionOption) decode(r *reader) {
+	a.IdAnilist = r.Int(1, maxIdAnilist)
+	a.Status = r.Enum(statuses...)
+}
+
+// RateButton opens RateModal for a media.
+type RateButton struct {
+	Origin    string
+	MediaType string
+	IdAnilist int
+	Prev      ListPosition
+}
+
+func (a *RateButton) Name() string { return "btn_rate" }
+
+func (a *RateButton) encode(w *writer) {
+	w.String(a.Origin)
+	w.String(a.MediaType)
+	w.Int(a.IdAnilist)
+	w.position(a.Prev)
+}
+
+func (a *RateButton) decode(r *reader) {
+	a.Origin = r.Enum(origins...)
+	a.MediaType = r.Enum(mediaTypes...)
+	a.IdAnilist = r.Int(1, maxIdAnilist)
+	a.Prev = r.position()
+}
+
+// RateModal is the score form opened by RateButton.
+type RateModal struct {
+	Origin    string
+	IdAnilist int
+	Prev      ListPosition
+}
+
+func (a *RateModal) Name() string { return "model_rate" }
+
+func (a *RateModal) encode(w *writer) {
+	w.String(a.Origin)
+	w.Int(a.IdAnilist)
+	w.position(a.Prev)
+}
+
+func (a *RateModal) decode(r *reader) {
+	a.Origin = r.Enum(origins...)
+	a.IdAnilist = r.Int(1, maxIdAnilist)
+	a.Prev = r.position()
+}
+
+// DeleteButton removes a list entry and goes back to the page it was opened from.
+type DeleteButton struct {
+	Status      string
+	UserMediaID primitive.ObjectID
+	MediaType   string
+	Prev        ListPosition
+}
+
+func (a *DeleteButton) Name() string { return "btn_delete" }
+
+func (a *DeleteButton) encode(w *writer) {
+	w.String(a.Status)
+	w.ObjectID(a.UserMediaID)
+	w.String(a.MediaType)
+	w.position(a.Prev)
+}
+
+func (a *DeleteButton) decode(r *reader) {
+	a.Status = r.Enum(statuses...)
+	a.UserMediaID = r.ObjectID()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Prev = r.position()
+}
+
+// MediaListsMenu is the status select menu of the list overview, see MediaListsOption.
+type MediaListsMenu struct{}
+
+func (a *MediaListsMenu) Name() string   { return "sm_media_lists" }
+func (a *MediaListsMenu) encode(*writer) {}
+func (a *MediaListsMenu) decode(*reader) {}
+
+// MediaListsOption is an option of MediaListsMenu, opening one status list or, when
+// Status is empty, the custom list ListID of the user UserID.
+type MediaListsOption struct {
+	UserID    snowflake.ID
+	MediaType string
+	Status    string
+	ListID    primitive.ObjectID
+}
+
+func (a *MediaListsOption) Name() string { return "opt_media_lists" }
+
+func (a *MediaListsOption) encode(w *writer) {
+	w.Snowflake(a.UserID)
+	w.String(a.MediaType)
+	w.list(a.Status, a.ListID)
+}
+
+func (a *MediaListsOption) decode(r *reader) {
+	a.UserID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Status, a.ListID = r.list()
+}
+
+// MediaListsButton goes back to the list overview of the user UserID.
+type MediaListsButton struct {
+	UserID    snowflake.ID
+	MediaType string
+}
+
+func (a *MediaListsButton) Name() string { return "btn_media_lists" }
+
+func (a *MediaListsButton) encode(w *writer) {
+	w.Snowflake(a.UserID)
+	w.String(a.MediaType)
+}
+
+func (a *MediaListsButton) decode(r *reader) {
+	a.UserID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+}
+
+// MediaListPage opens a page of a status or custom list (Prev/Next and "Back to list"),
+// see MediaListsOption.
+type MediaListPage struct {
+	UserID    snowflake.ID
+	MediaType string
+	Status    string
+	ListID    primitive.ObjectID
+	Page      int
+	View      listview.View
+}
+
+func (a *MediaListPage) Name() string { return "btn_media_list" }
+
+func (a *MediaListPage) encode(w *writer) {
+	w.Snowflake(a.UserID)
+	w.String(a.MediaType)
+	w.list(a.Status, a.ListID)
+	w.Int(a.Page)
+	w.view(a.View)
+}
+
+func (a *MediaListPage) decode(r *reader) {
+	a.UserID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Status, a.ListID = r.list()
+	a.Page = r.Int(1, maxPage)
+	a.View = r.view()
+}
+
+// MediaListViewMenu is one of the sort and filter select menus of a list page. Its
+// options are MediaListViewOptions, each the view the page changes to when picked.
+type MediaListViewMenu struct {
+	Control   string
+	UserID    snowflake.ID
+	MediaType string
+	Status    string
+	ListID    primitive.ObjectID
+}
+
+func (a *MediaListViewMenu) Name() string { return "sm_list_view" }
+
+func (a *MediaListViewMenu) encode(w *writer) {
+	w.String(a.Control)
+	w.Snowflake(a.UserID)
+	w.String(a.MediaType)
+	w.list(a.Status, a.ListID)
+}
+
+func (a *MediaListViewMenu) decode(r *reader) {
+	a.Control = r.Enum(viewControls...)
+	a.UserID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Status, a.ListID = r.list()
+}
+
+// MediaListViewOption is an option of MediaListViewMenu.
+type MediaListViewOption struct {
+	View listview.View
+}
+
+func (a *MediaListViewOption) Name() string { return "opt_list_view" }
+
+func (a *MediaListViewOption) encode(w *writer) {
+	w.view(a.View)
+}
+
+func (a *MediaListViewOption) decode(r *reader) {
+	a.View = r.view()
+}
+
+// MediaListMenu is the entry select menu of a status list page, see MediaListOption.
+type MediaListMenu struct{}
+
+func (a *MediaListMenu) Name() string   { return "sm_media_list" }
+func (a *MediaListMenu) encode(*writer) {}
+func (a *MediaListMenu) decode(*reader) {}
+
+// MediaListOption is an option of MediaListMenu, opening one list entry from the list page Prev.
+type MediaListOption struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *MediaListOption) Name() string { return "opt_media_list" }
+
+func (a *MediaListOption) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *MediaListOption) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// ProgressButton adds one to the progress of a list entry ("+1").
+type ProgressButton struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *ProgressButton) Name() string { return "btn_progress" }
+
+func (a *ProgressButton) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *ProgressButton) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// SetProgressButton opens ProgressModal for a list entry.
+type SetProgressButton struct {
+	UserMediaID primitive.ObjectID
+	MediaType   string
+	Prev        ListPosition
+}
+
+func (a *SetProgressButton) Name() string { return "btn_set_progress" }
+
+func (a *SetProgressButton) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.String(a.MediaType)
+	w.position(a.Prev)
+}
+
+func (a *SetProgressButton) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Prev = r.position()
+}
+
+// ProgressModal is the progress form opened by SetProgressButton.
+type ProgressModal struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *ProgressModal) Name() string { return "modal_progress" }
+
+func (a *ProgressModal) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *ProgressModal) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// CompleteButton marks a list entry whose progress reached the end as completed.
+type CompleteButton struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *CompleteButton) Name() string { return "btn_complete" }
+
+func (a *CompleteButton) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *CompleteButton) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// HistoryButton opens HistoryModal for a list entry.
+type HistoryButton struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *HistoryButton) Name() string { return "btn_history" }
+
+func (a *HistoryButton) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *HistoryButton) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// HistoryModal is the start/finish date and repeat count form opened by HistoryButton.
+type HistoryModal struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *HistoryModal) Name() string { return "modal_history" }
+
+func (a *HistoryModal) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *HistoryModal) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// EntryListsMenu is the custom list select menu of a list entry, every selected
+// EntryListsOption is a list the entry is on.
+type EntryListsMenu struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *EntryListsMenu) Name() string { return "sm_entry_lists" }
+
+func (a *EntryListsMenu) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *EntryListsMenu) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// EntryListsOption is an option of EntryListsMenu, one of the user's custom lists.
+type EntryListsOption struct {
+	ListID primitive.ObjectID
+}
+
+func (a *EntryListsOption) Name() string { return "opt_entry_lists" }
+
+func (a *EntryListsOption) encode(w *writer) {
+	w.ObjectID(a.ListID)
+}
+
+func (a *EntryListsOption) decode(r *reader) {
+	a.ListID = r.ObjectID()
+}
+
+// TagsButton opens TagsModal for a list entry.
+type TagsButton struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *TagsButton) Name() string { return "btn_tags" }
+
+func (a *TagsButton) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *TagsButton) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// TagsModal is the tags form opened by TagsButton.
+type TagsModal struct {
+	UserMediaID primitive.ObjectID
+	Prev        ListPosition
+}
+
+func (a *TagsModal) Name() string { return "modal_tags" }
+
+func (a *TagsModal) encode(w *writer) {
+	w.ObjectID(a.UserMediaID)
+	w.position(a.Prev)
+}
+
+func (a *TagsModal) decode(r *reader) {
+	a.UserMediaID = r.ObjectID()
+	a.Prev = r.position()
+}
+
+// FavouriteButton adds a media to the user's favourites, or removes it when it
+// already is one.
+type FavouriteButton struct {
+	Origin    string
+	IdAnilist int
+	Prev      ListPosition
+}
+
+func (a *FavouriteButton) Name() string { return "btn_favourite" }
+
+func (a *FavouriteButton) encode(w *writer) {
+	w.String(a.Origin)
+	w.Int(a.IdAnilist)
+	w.position(a.Prev)
+}
+
+func (a *FavouriteButton) decode(r *reader) {
+	a.Origin = r.Enum(origins...)
+	a.IdAnilist = r.Int(1, maxIdAnilist)
+	a.Prev = r.position()
+}
+
+// ReviewsPage is a Prev/Next button of /reviews, browsing the reviews of UserID.
+type ReviewsPage struct {
+	OwnerID snowflake.ID
+	UserID  snowflake.ID
+	Page    int
+}
+
+func (a *ReviewsPage) Name() string { return "btn_reviews" }
+
+func (a *ReviewsPage) encode(w *writer) {
+	w.Snowflake(a.OwnerID)
+	w.Snowflake(a.UserID)
+	w.Int(a.Page)
+}
+
+func (a *ReviewsPage) decode(r *reader) {
+	a.OwnerID = r.Snowflake()
+	a.UserID = r.Snowflake()
+	a.Page = r.Int(1, maxPage)
+}
+
+// StatsPage is a page or media type button of /stats, showing the stats of UserID.
+type StatsPage struct {
+	UserID    snowflake.ID
+	MediaType string
+	Page      string
+}
+
+func (a *StatsPage) Name() string { return "btn_stats" }
+
+func (a *StatsPage) encode(w *writer) {
+	w.Snowflake(a.UserID)
+	w.String(a.MediaType)
+	w.String(a.Page)
+}
+
+func (a *StatsPage) decode(r *reader) {
+	a.UserID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Page = r.Enum(statsPages...)
+}
+
+// ComparePage is a Prev/Next button of /compare, OwnerID being the user who ran it and
+// OtherID the user they compared with.
+type ComparePage struct {
+	OwnerID   snowflake.ID
+	OtherID   snowflake.ID
+	MediaType string
+	Section   string
+	Page      int
+}
+
+func (a *ComparePage) Name() string { return "btn_compare" }
+
+func (a *ComparePage) encode(w *writer) {
+	w.Snowflake(a.OwnerID)
+	w.Snowflake(a.OtherID)
+	w.String(a.MediaType)
+	w.String(a.Section)
+	w.Int(a.Page)
+}
+
+func (a *ComparePage) decode(r *reader) {
+	a.OwnerID = r.Snowflake()
+	a.OtherID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.Section = r.Enum(compareSections...)
+	a.Page = r.Int(1, maxPage)
+}
+
+// CompareMenu is the select menu of /compare switching between its lists, every
+// CompareOption is one of them.
+type CompareMenu struct {
+	OwnerID   snowflake.ID
+	OtherID   snowflake.ID
+	MediaType string
+}
+
+func (a *CompareMenu) Name() string { return "sm_compare" }
+
+func (a *CompareMenu) encode(w *writer) {
+	w.Snowflake(a.OwnerID)
+	w.Snowflake(a.OtherID)
+	w.String(a.MediaType)
+}
+
+func (a *CompareMenu) decode(r *reader) {
+	a.OwnerID = r.Snowflake()
+	a.OtherID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+}
+
+// CompareOption is an option of CompareMenu.
+type CompareOption struct {
+	Section string
+}
+
+func (a *CompareOption) Name() string { return "opt_compare" }
+
+func (a *CompareOption) encode(w *writer) {
+	w.String(a.Section)
+}
+
+func (a *CompareOption) decode(r *reader) {
+	a.Section = r.Enum(compareSections...)
+}
+
+// LeaderboardMenu is the select menu of /leaderboard switching between its rankings,
+// every LeaderboardOption is one of them. OwnerID is the user who ran it.
+type LeaderboardMenu struct {
+	OwnerID snowflake.ID
+}
+
+func (a *LeaderboardMenu) Name() string { return "sm_leaderboard" }
+
+func (a *LeaderboardMenu) encode(w *writer) {
+	w.Snowflake(a.OwnerID)
+}
+
+func (a *LeaderboardMenu) decode(r *reader) {
+	a.OwnerID = r.Snowflake()
+}
+
+// LeaderboardOption is an option of LeaderboardMenu.
+type LeaderboardOption struct {
+	Board string
+}
+
+func (a *LeaderboardOption) Name() string { return "opt_leaderboard" }
+
+func (a *LeaderboardOption) encode(w *writer) {
+	w.String(a.Board)
+}
+
+func (a *LeaderboardOption) decode(r *reader) {
+	a.Board = r.Enum(leaderboards...)
+}
+
+// ServerTopPage is a Prev/Next button of /server-top, OwnerID being the user who ran it.
+type ServerTopPage struct {
+	OwnerID    snowflake.ID
+	MediaType  string
+	MinRatings int
+	Page       int
+}
+
+func (a *ServerTopPage) Name() string { return "btn_server_top" }
+
+func (a *ServerTopPage) encode(w *writer) {
+	w.Snowflake(a.OwnerID)
+	w.String(a.MediaType)
+	w.Int(a.MinRatings)
+	w.Int(a.Page)
+}
+
+func (a *ServerTopPage) decode(r *reader) {
+	a.OwnerID = r.Snowflake()
+	a.MediaType = r.Enum(mediaTypes...)
+	a.MinRatings = r.Int(1, maxMinRatings)
+	a.Page = r.Int(1, maxPage)
+}
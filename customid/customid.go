@@ -0,0 +1,262 @@
+// Package customid encodes the state carried by message components (button and
+// select menu custom IDs, select option values and modal custom IDs).
+//
+// An encoded ID looks like
+//
+//	btn_delete/3/COMPLETED/atVfdCee1TnxyFW7/ANIME/-/2/a000--/rrn8MAIxdOcaHpvi
+//
+// that is the action name the router matches on, the encoding version, the
+// action's fields and a truncated HMAC of everything before it. IDs whose
+// signature doesn't match were not made by this bot and are rejected.
+package customid
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/config"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Version is bumped whenever the fields of an action change, which retires every
+// component created before the change.
+const Version = 4
+
+// MaxLength is Discord's limit for custom IDs and select option values.
+const MaxLength = 100
+
+// Length of the signature in bytes (16 base64 characters).
+const signatureSize = 12
+
+var (
+	// ErrMalformed is returned for IDs that don't have the layout of the expected action.
+	ErrMalformed = errors.New("malformed custom id")
+	// ErrVersion is returned for IDs made by an older (or newer) version of the bot.
+	ErrVersion = errors.New("custom id version is not supported")
+	// ErrSignature is returned for IDs that were not signed with our secret.
+	ErrSignature = errors.New("custom id signature does not match")
+)
+
+// Action is the state of one kind of component. Name is the prefix the router matches on.
+type Action interface {
+	Name() string
+	encode(w *writer)
+	decode(r *reader)
+}
+
+var secret = loadSecret()
+
+func loadSecret() []byte {
+	if value := config.GetEnv("CUSTOM_ID_SECRET", ""); value != "" {
+		return []byte(value)
+	}
+
+	log.Println("CUSTOM_ID_SECRET is not set, using a random secret; components sent before a restart will stop working")
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		log.Fatalf("Failed to generate a custom id secret: %v", err)
+	}
+	return random
+}
+
+// Encode returns the signed custom ID for an action. It panics if the result is
+// longer than Discord accepts, as that can only be a mistake in an action's fields.
+func Encode(action Action) string {
+	w := &writer{fields: []string{action.Name(), strconv.Itoa(Version)}}
+	action.encode(w)
+
+	body := strings.Join(w.fields, "/")
+	encoded := body + "/" + sign(body)
+
+	if len(encoded) > MaxLength {
+		panic(fmt.Sprintf("customid: %s is %d characters long, the limit is %d", action.Name(), len(encoded), MaxLength))
+	}
+
+	return encoded
+}
+
+// Decode verifies customID and fills action from it. The returned error wraps
+// ErrMalformed, ErrVersion or ErrSignature.
+func Decode(customID string, action Action) error {
+	if len(customID) > MaxLength {
+		return fmt.Errorf("%w: too long", ErrMalformed)
+	}
+
+	parts := strings.Split(customID, "/")
+	if len(parts) < 3 || parts[0] != action.Name() {
+		return fmt.Errorf("%w: not a %s id", ErrMalformed, action.Name())
+	}
+
+	if parts[1] != strconv.Itoa(Version) {
+		return fmt.Errorf("%w: got version %q", ErrVersion, parts[1])
+	}
+
+	body := strings.Join(parts[:len(parts)-1], "/")
+	if !hmac.Equal([]byte(parts[len(parts)-1]), []byte(sign(body))) {
+		return ErrSignature
+	}
+
+	r := &reader{fields: parts[2 : len(parts)-1]}
+	action.decode(r)
+
+	if r.err == nil && len(r.fields) > 0 {
+		r.fail("%d unexpected fields", len(r.fields))
+	}
+
+	return r.err
+}
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureSize])
+}
+
+// writer collects the fields of an action. Numbers use base 36 and object IDs
+// base64 to stay well below MaxLength.
+type writer struct {
+	fields []string
+}
+
+func (w *writer) String(value string) {
+	if value == "" || strings.Contains(value, "/") {
+		panic(fmt.Sprintf("customid: field %q can't be encoded", value))
+	}
+	w.fields = append(w.fields, value)
+}
+
+func (w *writer) Int(value int) {
+	w.fields = append(w.fields, strconv.FormatInt(int64(value), 36))
+}
+
+func (w *writer) Snowflake(value snowflake.ID) {
+	w.fields = append(w.fields, strconv.FormatUint(uint64(value), 36))
+}
+
+func (w *writer) ObjectID(value primitive.ObjectID) {
+	w.fields = append(w.fields, base64.RawURLEncoding.EncodeToString(value[:]))
+}
+
+// OptionalObjectID writes "-" for the nil object ID, which ObjectID can't tell apart
+// from a real one.
+func (w *writer) OptionalObjectID(value primitive.ObjectID) {
+	if value.IsZero() {
+		w.fields = append(w.fields, "-")
+		return
+	}
+	w.ObjectID(value)
+}
+
+// reader hands out the fields of an action in order. The first problem is kept
+// in err and every read after it returns a zero value.
+type reader struct {
+	fields []string
+	err    error
+}
+
+func (r *reader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *reader) next() (string, bool) {
+	if r.err != nil {
+		return "", false
+	}
+	if len(r.fields) == 0 {
+		r.fail("missing fields")
+		return "", false
+	}
+
+	field := r.fields[0]
+	r.fields = r.fields[1:]
+	return field, true
+}
+
+// Enum reads a field that has to be one of allowed.
+func (r *reader) Enum(allowed ...string) string {
+	field, ok := r.next()
+	if !ok {
+		return ""
+	}
+
+	for _, value := range allowed {
+		if field == value {
+			return field
+		}
+	}
+
+	r.fail("unexpected value %q", field)
+	return ""
+}
+
+// Int reads a number between min and max (inclusive).
+func (r *reader) Int(min int, max int) int {
+	field, ok := r.next()
+	if !ok {
+		return 0
+	}
+
+	value, err := strconv.ParseInt(field, 36, 64)
+	if err != nil || value < int64(min) || value > int64(max) {
+		r.fail("invalid number %q", field)
+		return 0
+	}
+
+	return int(value)
+}
+
+func (r *reader) Snowflake() snowflake.ID {
+	field, ok := r.next()
+	if !ok {
+		return 0
+	}
+
+	value, err := strconv.ParseUint(field, 36, 64)
+	if err != nil {
+		r.fail("invalid snowflake %q", field)
+		return 0
+	}
+
+	return snowflake.ID(value)
+}
+
+func (r *reader) ObjectID() primitive.ObjectID {
+	field, ok := r.next()
+	if !ok {
+		return primitive.NilObjectID
+	}
+
+	return r.parseObjectID(field)
+}
+
+func (r *reader) OptionalObjectID() primitive.ObjectID {
+	field, ok := r.next()
+	if !ok || field == "-" {
+		return primitive.NilObjectID
+	}
+
+	return r.parseObjectID(field)
+}
+
+func (r *reader) parseObjectID(field string) primitive.ObjectID {
+	bytes, err := base64.RawURLEncoding.DecodeString(field)
+	if err != nil || len(bytes) != len(primitive.ObjectID{}) {
+		r.fail("invalid object id %q", field)
+		return primitive.NilObjectID
+	}
+
+	var value primitive.ObjectID
+	copy(value[:], bytes)
+	return value
+}
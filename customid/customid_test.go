@@ -0,0 +1,222 @@
+package customid
+
+import (
+	"errors"
+	"ipmanlk/saika/listview"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The largest values every field can hold, so the IDs below are the longest the bot
+// can make.
+var (
+	maxSnowflake = snowflake.ID(math.MaxUint64)
+	maxObjectID  = primitive.ObjectID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	maxView      = listview.View{
+		Sort:     listview.SortProgress,
+		Formats:  listview.Formats,
+		Statuses: listview.Statuses,
+		Genre:    listview.Genres[len(listview.Genres)-1],
+		Scored:   listview.ScoredYes,
+	}
+	// a page of a custom list, which takes longer to encode than a status
+	maxPosition = ListPosition{ListID: maxObjectID, Page: maxPage, View: maxView}
+)
+
+// testActions has every action, with the fields that encode longest.
+var testActions = []Action{
+	&MediaResultsPage{OwnerID: maxSnowflake, SearchQueryID: maxObjectID, Page: maxPage},
+	&MediaActionMenu{},
+	&MediaActionOption{IdAnilist: maxIdAnilist, Status: "REPEATING"},
+	&RateButton{Origin: "search", MediaType: "ANIME", IdAnilist: maxIdAnilist, Prev: maxPosition},
+	&RateModal{Origin: "search", IdAnilist: maxIdAnilist, Prev: maxPosition},
+	&DeleteButton{Status: "REPEATING", UserMediaID: maxObjectID, MediaType: "MANGA", Prev: maxPosition},
+	&MediaListsMenu{},
+	&MediaListsOption{UserID: maxSnowflake, MediaType: "MANGA", ListID: maxObjectID},
+	&MediaListsButton{UserID: maxSnowflake, MediaType: "MANGA"},
+	&MediaListPage{UserID: maxSnowflake, MediaType: "MANGA", ListID: maxObjectID, Page: maxPage, View: maxView},
+	&MediaListViewMenu{Control: "filter", UserID: maxSnowflake, MediaType: "MANGA", ListID: maxObjectID},
+	&MediaListViewOption{View: maxView},
+	&MediaListMenu{},
+	&MediaListOption{UserMediaID: maxObjectID, Prev: maxPosition},
+	&ProgressButton{UserMediaID: maxObjectID, Prev: maxPosition},
+	&SetProgressButton{UserMediaID: maxObjectID, MediaType: "MANGA", Prev: maxPosition},
+	&ProgressModal{UserMediaID: maxObjectID, Prev: maxPosition},
+	&CompleteButton{UserMediaID: maxObjectID, Prev: maxPosition},
+	&HistoryButton{UserMediaID: maxObjectID, Prev: maxPosition},
+	&HistoryModal{UserMediaID: maxObjectID, Prev: maxPosition},
+	&EntryListsMenu{UserMediaID: maxObjectID, Prev: maxPosition},
+	&EntryListsOption{ListID: maxObjectID},
+	&TagsButton{UserMediaID: maxObjectID, Prev: maxPosition},
+	&TagsModal{UserMediaID: maxObjectID, Prev: maxPosition},
+	&FavouriteButton{Origin: "search", IdAnilist: maxIdAnilist, Prev: maxPosition},
+	&ReviewsPage{OwnerID: maxSnowflake, UserID: maxSnowflake, Page: maxPage},
+	&StatsPage{UserID: maxSnowflake, MediaType: "MANGA", Page: "overview"},
+	&ComparePage{OwnerID: maxSnowflake, OtherID: maxSnowflake, MediaType: "MANGA", Section: "other_completed", Page: maxPage},
+	&CompareMenu{OwnerID: maxSnowflake, OtherID: maxSnowflake, MediaType: "MANGA"},
+	&CompareOption{Section: "other_completed"},
+	&LeaderboardMenu{OwnerID: maxSnowflake},
+	&LeaderboardOption{Board: "MANGA_COMPLETED"},
+	&ServerTopPage{OwnerID: maxSnowflake, MediaType: "MANGA", MinRatings: maxMinRatings, Page: maxPage},
+}
+
+// newAction returns an empty action of the same type as action.
+func newAction(action Action) Action {
+	return reflect.New(reflect.TypeOf(action).Elem()).Interface().(Action)
+}
+
+// signed signs fields the way Encode does, whatever they are.
+func signed(fields ...string) string {
+	body := strings.Join(fields, "/")
+	return body + "/" + sign(body)
+}
+
+func TestRoundTrip(t *testing.T) {
+	// besides the longest values, status lists and the smallest values
+	actions := append([]Action{
+		&DeleteButton{Status: "PLANNING", UserMediaID: primitive.NewObjectID(), MediaType: "ANIME", Prev: ListPosition{Page: 1, View: listview.View{Sort: listview.SortAdded}}},
+		&MediaListsOption{UserID: 1, MediaType: "ANIME", Status: "CURRENT"},
+		&MediaListPage{UserID: 1, MediaType: "ANIME", Status: "COMPLETED", Page: 1, View: listview.View{Sort: listview.SortAdded}},
+		&MediaListViewMenu{Control: "sort", UserID: 1, MediaType: "ANIME", Status: "DROPPED"},
+		&MediaResultsPage{SearchQueryID: primitive.NewObjectID(), Page: 1},
+		&ServerTopPage{OwnerID: 1, MediaType: "ANIME", MinRatings: 1, Page: 1},
+	}, testActions...)
+
+	for _, action := range actions {
+		t.Run(action.Name(), func(t *testing.T) {
+			encoded := Encode(action)
+
+			decoded := newAction(action)
+			if err := Decode(encoded, decoded); err != nil {
+				t.Fatalf("Decode(%q) error = %v", encoded, err)
+			}
+			if !reflect.DeepEqual(decoded, action) {
+				t.Errorf("Decode(%q) = %+v, want %+v", encoded, decoded, action)
+			}
+		})
+	}
+}
+
+func TestEveryActionIsTested(t *testing.T) {
+	names := map[string]bool{}
+	for _, action := range testActions {
+		if names[action.Name()] {
+			t.Errorf("%s is tested twice", action.Name())
+		}
+		names[action.Name()] = true
+	}
+
+	// 33 actions are defined in actions.go, a new one has to be added to testActions
+	if len(names) != 33 {
+		t.Errorf("%d actions are tested, want 33", len(names))
+	}
+}
+
+func TestLongestIDsFit(t *testing.T) {
+	longest := 0
+	for _, action := range testActions {
+		encoded := Encode(action)
+		if len(encoded) > MaxLength {
+			t.Errorf("%s is %d characters long, the limit is %d", action.Name(), len(encoded), MaxLength)
+		}
+		if len(encoded) > longest {
+			longest = len(encoded)
+		}
+	}
+	t.Logf("the longest id is %d characters long", longest)
+}
+
+func TestEncodePanicsWhenTooLong(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Encode() of an id longer than MaxLength didn't panic")
+		}
+	}()
+
+	Encode(&LeaderboardOption{Board: strings.Repeat("x", MaxLength)})
+}
+
+func TestDecodeRejects(t *testing.T) {
+	valid := Encode(&DeleteButton{Status: "CURRENT", UserMediaID: maxObjectID, MediaType: "ANIME", Prev: ListPosition{Page: 2}})
+	fields := strings.Split(valid, "/")
+	body := fields[:len(fields)-1]
+	version := strconv.Itoa(Version)
+
+	replace := func(i int, value string) []string {
+		changed := append([]string{}, body...)
+		changed[i] = value
+		return changed
+	}
+
+	tests := []struct {
+		name     string
+		customID string
+		want     error
+	}{
+		{"changed field", strings.Join(replace(2, "COMPLETED"), "/") + "/" + fields[len(fields)-1], ErrSignature},
+		{"changed signature", strings.Join(body, "/") + "/" + strings.Repeat("A", len(fields[len(fields)-1])), ErrSignature},
+		{"no signature", strings.Join(body, "/"), ErrSignature},
+		{"another secret", strings.Join(body, "/") + "/" + "rrn8MAIxdOcaHpvi", ErrSignature},
+		{"older version", signed(replace(1, strconv.Itoa(Version-1))...), ErrVersion},
+		{"newer version", signed(replace(1, strconv.Itoa(Version+1))...), ErrVersion},
+		{"unsigned older version", strings.Join(replace(1, strconv.Itoa(Version-1)), "/") + "/" + fields[len(fields)-1], ErrVersion},
+		{"extra field", signed(append(append([]string{}, body...), "x")...), ErrMalformed},
+		{"missing field", signed(body[:len(body)-1]...), ErrMalformed},
+		{"only the name", signed("btn_delete", version), ErrMalformed},
+		{"another action", Encode(&CompleteButton{UserMediaID: maxObjectID, Prev: ListPosition{Page: 1}}), ErrMalformed},
+		{"unknown status", signed(replace(2, "WATCHING")...), ErrMalformed},
+		{"bad object id", signed(replace(3, "abc")...), ErrMalformed},
+		{"page out of range", signed(replace(6, strconv.FormatInt(maxPage+1, 36))...), ErrMalformed},
+		{"page zero", signed(replace(6, "0")...), ErrMalformed},
+		{"bad view", signed(replace(7, "zzzzzz")...), ErrMalformed},
+		{"too long", signed(append(append([]string{}, body...), strings.Repeat("x", MaxLength))...), ErrMalformed},
+		{"empty", "", ErrMalformed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var action DeleteButton
+			if err := Decode(test.customID, &action); !errors.Is(err, test.want) {
+				t.Errorf("Decode(%q) error = %v, want %v", test.customID, err, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsBadSnowflakes(t *testing.T) {
+	for _, value := range []string{"-1", "zzzzzzzzzzzzzz", "1.5", ""} {
+		var action LeaderboardMenu
+		customID := signed(action.Name(), strconv.Itoa(Version), value)
+		if err := Decode(customID, &action); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Decode(%q) error = %v, want ErrMalformed", customID, err)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, action := range testActions {
+		f.Add(Encode(action))
+	}
+	f.Add("btn_delete/4//-/")
+	f.Add("/////")
+
+	f.Fuzz(func(t *testing.T, customID string) {
+		// the fuzzed ID as is, which almost never has a valid signature, and signed so the
+		// fields get parsed
+		body := customID
+		if i := strings.LastIndex(customID, "/"); i >= 0 {
+			body = customID[:i]
+		}
+
+		for _, action := range testActions {
+			Decode(customID, newAction(action))
+			Decode(body+"/"+sign(body), newAction(action))
+		}
+	})
+}
@@ -0,0 +1,828 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/config"
+	"ipmanlk/saika/listview"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/search"
+	"ipmanlk/saika/structs"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned by every storage backend when a lookup matches nothing.
+var ErrNotFound = errors.New("document not found")
+
+// ErrDuplicate is returned when a write would break a uniqueness rule, like two custom
+// lists with the same name.
+var ErrDuplicate = errors.New("document already exists")
+
+// ErrUserListLimit is returned by CreateUserList for users who already have MaxUserLists lists.
+var ErrUserListLimit = errors.New("too many custom lists")
+
+// ErrFavouriteLimit is returned by AddUserFavourite for users who already have MaxFavourites
+// favourites of that type.
+var ErrFavouriteLimit = errors.New("too many favourites")
+
+// ErrTimeout is returned when an operation did not finish before its deadline,
+// either the per-operation one below or the one carried by the caller's context.
+var ErrTimeout = errors.New("database operation timed out")
+
+// SaveMediaError is returned by SaveMedia when some of the media could not be
+// written. Everything not listed in Failures was saved.
+type SaveMediaError struct {
+	// Failures is keyed by AniList ID.
+	Failures map[int]error
+}
+
+func (e *SaveMediaError) Error() string {
+	ids := make([]string, 0, len(e.Failures))
+	for idAnilist, err := range e.Failures {
+		ids = append(ids, fmt.Sprintf("%d (%v)", idAnilist, err))
+	}
+	sort.Strings(ids)
+
+	return fmt.Sprintf("failed to save %d media: %s", len(e.Failures), strings.Join(ids, ", "))
+}
+
+// UserMediaPageSize is the number of entries on one page of a media list.
+const UserMediaPageSize = 10
+
+// MaxUserLists is the number of custom lists a user can have per media type, they share
+// the list overview's select menu with the status lists.
+const MaxUserLists = 15
+
+// MaxFavourites is the number of favourites a user can have per type, they are all
+// shown at once.
+const MaxFavourites = 25
+
+// MinStatsTagRank is the lowest rank (how well it fits the media, out of 100) a tag of a
+// media needs to count in stats, lower ranked tags barely describe it.
+const MinStatsTagRank = 60
+
+// MinAffinityEntries is the number of media two users both need to have scored for their
+// affinity to mean something.
+const MinAffinityEntries = 5
+
+// MaxAgreementDifference is the furthest apart two scores of the same media can be for
+// the users to agree on it, a point on the 10 point scale.
+const MaxAgreementDifference = 10
+
+// LeaderboardSize is the number of members shown on a leaderboard.
+const LeaderboardSize = 10
+
+// MinGuildRatings is the number of members who need to have scored a media, by default,
+// for it to be ranked among a guild's top media.
+const MinGuildRatings = 3
+
+// MaxGuildTopMedia is the number of media a guild's top media go up to.
+const MaxGuildTopMedia = 100
+
+// GuildMemberCheckInterval is how long a recorded guild member is trusted to still be a
+// member before it is checked again.
+const GuildMemberCheckInterval = 24 * time.Hour
+
+// MaxGuildMemberChecks is the number of recorded members checked at a time, so a guild
+// with many of them is checked over several uses.
+const MaxGuildMemberChecks = 25
+
+// ReviewsPageSize is the number of reviews on one page of /reviews.
+const ReviewsPageSize = 1
+
+// Deadlines applied to each individual store operation.
+const (
+	readTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+// Store is implemented by every storage backend the bot can run on.
+type Store interface {
+	SaveMedia(ctx context.Context, media []structs.AnilistMedia) error
+	GetMediaByIDAnilist(ctx context.Context, idAnilist int) (*structs.AnilistMedia, error)
+	GetMediaByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistMedia, error)
+	SearchMedia(ctx context.Context, query *search.Query, mediaType string, nsfw bool) ([]structs.AnilistMedia, error)
+
+	SaveSearchQuery(ctx context.Context, storeQuery *structs.AnilistSearchQuery) (*structs.AnilistSearchQuery, error)
+	GetSearchQueryByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistSearchQuery, error)
+	DeleteExpiredSearchQueries(ctx context.Context) (int64, error)
+
+	SaveUserMedia(ctx context.Context, userMedia *structs.UserMedia) (*structs.UserMedia, error)
+	GetUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) (*structs.UserMedia, error)
+	GetUserMediaByMediaID(ctx context.Context, userID snowflake.ID, mediaID primitive.ObjectID) (*structs.UserMedia, error)
+	IncrementUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, limit int) (*structs.UserMedia, error)
+	SetUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, progress int, progressVolumes int) (*structs.UserMedia, error)
+	SetUserMediaHistory(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, startedAt *structs.AnilistFuzzyDate, completedAt *structs.AnilistFuzzyDate, repeat int) (*structs.UserMedia, error)
+	SetUserMediaRating(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, score int, note string, review string) (*structs.UserMedia, error)
+	CountUserMediaByStatus(ctx context.Context, userID snowflake.ID, mediaType string) (map[string]int, error)
+	GetUserMediaPage(ctx context.Context, userID snowflake.ID, mediaType string, status string, view listview.View, page int) (*structs.UserMediaPage, error)
+	GetUserReviewsPage(ctx context.Context, userID snowflake.ID, page int) (*structs.UserMediaPage, error)
+	GetUserMediaStats(ctx context.Context, userID snowflake.ID, mediaType string) (*structs.UserMediaStats, error)
+	GetSharedUserMedia(ctx context.Context, userID snowflake.ID, otherUserID snowflake.ID, mediaType string) ([]structs.SharedMediaEntry, error)
+	DeleteUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) error
+
+	SetUserMediaLists(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, listIDs []primitive.ObjectID) (*structs.UserMedia, error)
+	SetUserMediaTags(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, tags []string) (*structs.UserMedia, error)
+
+	GetUserLists(ctx context.Context, userID snowflake.ID, mediaType string) ([]structs.UserList, error)
+	GetUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) (*structs.UserList, error)
+	CreateUserList(ctx context.Context, list *structs.UserList) (*structs.UserList, error)
+	RenameUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, name string) (*structs.UserList, error)
+	DeleteUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) error
+	CountUserMediaByList(ctx context.Context, userID snowflake.ID, mediaType string) (map[primitive.ObjectID]int, error)
+	GetUserListPage(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, view listview.View, page int) (*structs.UserMediaPage, error)
+
+	GetUserFavourites(ctx context.Context, userID snowflake.ID, favouriteType string) ([]structs.FavouriteEntry, error)
+	GetUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) (*structs.Favourite, error)
+	AddUserFavourite(ctx context.Context, favourite *structs.Favourite) (*structs.Favourite, error)
+	DeleteUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) error
+	SetUserFavouritePositions(ctx context.Context, userID snowflake.ID, favouriteType string, favouriteIDs []primitive.ObjectID) error
+
+	GetUserSettings(ctx context.Context, userID snowflake.ID) (*structs.UserSettings, error)
+	SetUserScoreFormat(ctx context.Context, userID snowflake.ID, format score.Format) (*structs.UserSettings, error)
+	SetUserListPrivacy(ctx context.Context, userID snowflake.ID, privacy structs.ListPrivacy) (*structs.UserSettings, error)
+
+	SaveGuildMember(ctx context.Context, member *structs.GuildMember) error
+	DeleteGuildMember(ctx context.Context, guildID snowflake.ID, userID snowflake.ID) error
+	DeleteGuildMembers(ctx context.Context, guildID snowflake.ID) error
+	GetGuildMembersSeenBefore(ctx context.Context, guildID snowflake.ID, before time.Time, limit int) ([]snowflake.ID, error)
+	GetGuildLeaderboard(ctx context.Context, guildID snowflake.ID, board structs.Leaderboard, since time.Time, limit int) ([]structs.LeaderboardEntry, error)
+	GetGuildTopMedia(ctx context.Context, guildID snowflake.ID, mediaType string, minRatings int, limit int) ([]structs.GuildMediaScore, error)
+
+	MigrateUp(ctx context.Context) ([]MigrationStatus, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+var (
+	store     Store
+	storeOnce sync.Once
+)
+
+// Init selects the storage backend from the STORAGE setting ("mongo" or "sqlite")
+// and prepares it for use.
+func Init() {
+	storeOnce.Do(func() {
+		switch backend := config.GetEnv("STORAGE", "mongo"); backend {
+		case "mongo":
+			InitMongoDb()
+			store = &MongoStore{}
+		case "sqlite":
+			sqliteStore, err := OpenSQLite(config.GetEnv("SQLITE_PATH", "ryougi.db"))
+			if err != nil {
+				log.Fatalf("Failed to open sqlite database: %v", err)
+			}
+			store = sqliteStore
+		default:
+			log.Fatalf("Unknown storage backend: %s", backend)
+		}
+	})
+}
+
+func getStore() Store {
+	Init()
+	return store
+}
+
+// checkTimeout turns deadline errors from any backend into ErrTimeout so
+// handlers can tell a slow database apart from other failures.
+func checkTimeout(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+
+	return err
+}
+
+func SaveMedia(ctx context.Context, media []structs.AnilistMedia) error {
+	return checkTimeout(getStore().SaveMedia(ctx, media))
+}
+
+func GetMediaByIDAnilist(ctx context.Context, idAnilist int) (*structs.AnilistMedia, error) {
+	media, err := getStore().GetMediaByIDAnilist(ctx, idAnilist)
+	return media, checkTimeout(err)
+}
+
+func GetMediaByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistMedia, error) {
+	media, err := getStore().GetMediaByObjectID(ctx, objectID)
+	return media, checkTimeout(err)
+}
+
+func GetMediaByHexID(ctx context.Context, hexID string) (*structs.AnilistMedia, error) {
+	objectID, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetMediaByObjectID(ctx, objectID)
+}
+
+func SearchMedia(ctx context.Context, query *search.Query, mediaType string, nsfw bool) ([]structs.AnilistMedia, error) {
+	media, err := getStore().SearchMedia(ctx, query, mediaType, nsfw)
+	return media, checkTimeout(err)
+}
+
+// SaveSearchQuery stores a new snapshot of search results. Every search gets its
+// own snapshot, which expires SearchRetention after it was made.
+func SaveSearchQuery(ctx context.Context, storeQuery *structs.AnilistSearchQuery) (*structs.AnilistSearchQuery, error) {
+	query, err := getStore().SaveSearchQuery(ctx, storeQuery)
+	return query, checkTimeout(err)
+}
+
+// GetSearchQueryByObjectID returns a search snapshot, or ErrNotFound once it has expired.
+func GetSearchQueryByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistSearchQuery, error) {
+	query, err := getStore().GetSearchQueryByObjectID(ctx, objectID)
+	return query, checkTimeout(err)
+}
+
+// SaveUserMedia adds media to a user's list, or updates the entry already there. An empty
+// status keeps the entry's current status (new entries go to PLANNING). The score is left
+// alone, new entries start out unscored; see SetUserMediaRating.
+func SaveUserMedia(ctx context.Context, userMedia *structs.UserMedia) (*structs.UserMedia, error) {
+	result, err := getStore().SaveUserMedia(ctx, userMedia)
+	return result, checkTimeout(err)
+}
+
+// GetUserMediaByObjectID returns one of the user's list entries. Entries of other
+// users are reported as ErrNotFound, the same as ones that don't exist.
+func GetUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) (*structs.UserMedia, error) {
+	userMedia, err := getStore().GetUserMediaByObjectID(ctx, userID, objectID)
+	return userMedia, checkTimeout(err)
+}
+
+// CountUserMediaByStatus returns how many entries a user has in each status list.
+func CountUserMediaByStatus(ctx context.Context, userID snowflake.ID, mediaType string) (map[string]int, error) {
+	counts, err := getStore().CountUserMediaByStatus(ctx, userID, mediaType)
+	return counts, checkTimeout(err)
+}
+
+// GetUserMediaPage returns one page of a status list, sorted and filtered by view. Pages
+// past the end of the list (ex, after the last entry of a page was removed) give the
+// last page instead.
+func GetUserMediaPage(ctx context.Context, userID snowflake.ID, mediaType string, status string, view listview.View, page int) (*structs.UserMediaPage, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	result, err := getStore().GetUserMediaPage(ctx, userID, mediaType, status, view, page)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	if page > result.Pages() {
+		result, err = getStore().GetUserMediaPage(ctx, userID, mediaType, status, view, result.Pages())
+	}
+
+	return result, checkTimeout(err)
+}
+
+// GetUserMediaByMediaID returns the user's list entry for a media, or ErrNotFound
+// when the media isn't on any of the user's lists.
+func GetUserMediaByMediaID(ctx context.Context, userID snowflake.ID, mediaID primitive.ObjectID) (*structs.UserMedia, error) {
+	userMedia, err := getStore().GetUserMediaByMediaID(ctx, userID, mediaID)
+	return userMedia, checkTimeout(err)
+}
+
+// IncrementUserMediaProgress adds one to the progress of a list entry, stopping at
+// limit when it is above 0. Entries still being planned move to CURRENT once their
+// progress goes up. Gives ErrNotFound when the user has no such entry.
+func IncrementUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, limit int) (*structs.UserMedia, error) {
+	userMedia, err := getStore().IncrementUserMediaProgress(ctx, userID, objectID, limit)
+	return userMedia, checkTimeout(err)
+}
+
+// SetUserMediaProgress replaces the progress of a list entry, see IncrementUserMediaProgress.
+func SetUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, progress int, progressVolumes int) (*structs.UserMedia, error) {
+	userMedia, err := getStore().SetUserMediaProgress(ctx, userID, objectID, progress, progressVolumes)
+	return userMedia, checkTimeout(err)
+}
+
+// SetUserMediaHistory replaces the start and finish dates (nil clears them) and the
+// repeat count of a list entry. Gives ErrNotFound when the user has no such entry.
+func SetUserMediaHistory(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, startedAt *structs.AnilistFuzzyDate, completedAt *structs.AnilistFuzzyDate, repeat int) (*structs.UserMedia, error) {
+	userMedia, err := getStore().SetUserMediaHistory(ctx, userID, objectID, startedAt, completedAt, repeat)
+	return userMedia, checkTimeout(err)
+}
+
+// SetUserMediaRating replaces the score (out of 100, or score.Unscored), note and review
+// of a list entry; empty notes and reviews are removed. The edit time of each is only
+// moved when its text changed. Gives ErrNotFound when the user has no such entry.
+func SetUserMediaRating(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, rating int, note string, review string) (*structs.UserMedia, error) {
+	if rating < score.Unscored || rating > score.Max {
+		return nil, fmt.Errorf("score %d is out of range", rating)
+	}
+
+	userMedia, err := getStore().SetUserMediaRating(ctx, userID, objectID, rating, note, review)
+	return userMedia, checkTimeout(err)
+}
+
+// GetUserReviewsPage returns one page of the entries a user has written a review for,
+// most recently edited first. Pages past the end give the last page instead.
+func GetUserReviewsPage(ctx context.Context, userID snowflake.ID, page int) (*structs.UserMediaPage, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	result, err := getStore().GetUserReviewsPage(ctx, userID, page)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	if page > result.Pages() {
+		result, err = getStore().GetUserReviewsPage(ctx, userID, result.Pages())
+	}
+
+	return result, checkTimeout(err)
+}
+
+// DeleteUserMediaByObjectID removes one of the user's list entries, giving ErrNotFound
+// when the user has no such entry.
+func DeleteUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) error {
+	return checkTimeout(getStore().DeleteUserMediaByObjectID(ctx, userID, objectID))
+}
+
+// SetUserMediaLists replaces the custom lists a list entry is on. Every list has to be
+// one of the user's lists for the entry's media type. Gives ErrNotFound when the user
+// has no such entry or list.
+func SetUserMediaLists(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, listIDs []primitive.ObjectID) (*structs.UserMedia, error) {
+	userMedia, err := getStore().GetUserMediaByObjectID(ctx, userID, objectID)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	lists, err := getStore().GetUserLists(ctx, userID, userMedia.MediaType)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	for _, listID := range listIDs {
+		known := false
+		for _, list := range lists {
+			known = known || list.ID == listID
+		}
+		if !known {
+			return nil, ErrNotFound
+		}
+	}
+
+	userMedia, err = getStore().SetUserMediaLists(ctx, userID, objectID, listIDs)
+	return userMedia, checkTimeout(err)
+}
+
+// SetUserMediaTags replaces the tags of a list entry, an empty slice removes them.
+// Gives ErrNotFound when the user has no such entry.
+func SetUserMediaTags(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, tags []string) (*structs.UserMedia, error) {
+	userMedia, err := getStore().SetUserMediaTags(ctx, userID, objectID, tags)
+	return userMedia, checkTimeout(err)
+}
+
+// GetUserLists returns a user's custom lists for a media type, oldest first.
+func GetUserLists(ctx context.Context, userID snowflake.ID, mediaType string) ([]structs.UserList, error) {
+	lists, err := getStore().GetUserLists(ctx, userID, mediaType)
+	return lists, checkTimeout(err)
+}
+
+// GetUserList returns one of the user's custom lists. Lists of other users are
+// reported as ErrNotFound, the same as ones that don't exist.
+func GetUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) (*structs.UserList, error) {
+	list, err := getStore().GetUserList(ctx, userID, listID)
+	return list, checkTimeout(err)
+}
+
+// CreateUserList adds a custom list. Gives ErrDuplicate when the user already has a
+// list of that name (ignoring case) and ErrUserListLimit when they have too many.
+func CreateUserList(ctx context.Context, list *structs.UserList) (*structs.UserList, error) {
+	lists, err := getStore().GetUserLists(ctx, list.UserID, list.MediaType)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	if len(lists) >= MaxUserLists {
+		return nil, ErrUserListLimit
+	}
+
+	created, err := getStore().CreateUserList(ctx, list)
+	return created, checkTimeout(err)
+}
+
+// RenameUserList changes the name of a custom list, see CreateUserList.
+func RenameUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, name string) (*structs.UserList, error) {
+	list, err := getStore().RenameUserList(ctx, userID, listID, name)
+	return list, checkTimeout(err)
+}
+
+// DeleteUserList removes a custom list and takes its entries off it, the entries
+// themselves stay on the user's status lists.
+func DeleteUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) error {
+	return checkTimeout(getStore().DeleteUserList(ctx, userID, listID))
+}
+
+// CountUserMediaByList returns how many entries a user has on each custom list. Lists
+// without entries are left out.
+func CountUserMediaByList(ctx context.Context, userID snowflake.ID, mediaType string) (map[primitive.ObjectID]int, error) {
+	counts, err := getStore().CountUserMediaByList(ctx, userID, mediaType)
+	return counts, checkTimeout(err)
+}
+
+// GetUserListPage returns one page of a custom list, see GetUserMediaPage.
+func GetUserListPage(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, view listview.View, page int) (*structs.UserMediaPage, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	result, err := getStore().GetUserListPage(ctx, userID, listID, view, page)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	if page > result.Pages() {
+		result, err = getStore().GetUserListPage(ctx, userID, listID, view, result.Pages())
+	}
+
+	return result, checkTimeout(err)
+}
+
+// GetUserMediaStats sums up a user's entries of a media type. Statuses and formats come
+// most common first, scores from lowest to highest and release years from newest to
+// oldest. Genres and tags are ranked by how many entries have them weighted by their mean
+// score, with entries of unscored groups weighing as much as the user's mean score.
+func GetUserMediaStats(ctx context.Context, userID snowflake.ID, mediaType string) (*structs.UserMediaStats, error) {
+	stats, err := getStore().GetUserMediaStats(ctx, userID, mediaType)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	byCount := func(groups []structs.StatsGroup) {
+		sort.SliceStable(groups, func(i, j int) bool {
+			if groups[i].Count != groups[j].Count {
+				return groups[i].Count > groups[j].Count
+			}
+			return groups[i].Key < groups[j].Key
+		})
+	}
+	byNumber := func(groups []structs.StatsGroup, descending bool) {
+		sort.SliceStable(groups, func(i, j int) bool {
+			a, _ := strconv.Atoi(groups[i].Key)
+			b, _ := strconv.Atoi(groups[j].Key)
+			return a < b != descending
+		})
+	}
+
+	byCount(stats.Statuses)
+	byCount(stats.Formats)
+	byNumber(stats.Scores, false)
+	byNumber(stats.ReleaseYears, true)
+	rankStatsGroups(stats.Genres, stats.Overall.MeanScore())
+	rankStatsGroups(stats.Tags, stats.Overall.MeanScore())
+
+	return stats, nil
+}
+
+// rankStatsGroups sorts groups by their entry count times their mean score, unscored
+// groups use meanScore instead. Without any scores that is just the count.
+func rankStatsGroups(groups []structs.StatsGroup, meanScore int) {
+	weight := func(group *structs.StatsGroup) int {
+		groupScore := group.MeanScore()
+		if groupScore == score.Unscored {
+			groupScore = meanScore
+		}
+		if groupScore == score.Unscored {
+			return group.Count
+		}
+		// a score of 0 still counts the entries a little
+		return group.Count * (groupScore + 1)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := weight(&groups[i]), weight(&groups[j])
+		if a != b {
+			return a > b
+		}
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Key < groups[j].Key
+	})
+}
+
+// CompareUserMedia compares two users' lists of a media type. Media both scored are
+// agreements when the scores are at most MaxAgreementDifference apart, closest (then
+// best liked) first, and disagreements otherwise, furthest apart first. Media one user
+// completed while the other is planning them come best scored first.
+func CompareUserMedia(ctx context.Context, userID snowflake.ID, otherUserID snowflake.ID, mediaType string) (*structs.UserMediaComparison, error) {
+	shared, err := getStore().GetSharedUserMedia(ctx, userID, otherUserID, mediaType)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	comparison := &structs.UserMediaComparison{MediaType: mediaType, Shared: len(shared)}
+
+	var userScores, otherScores []float64
+	for _, entry := range shared {
+		if entry.User.Scored() && entry.Other.Scored() {
+			userScores = append(userScores, float64(entry.User.Score))
+			otherScores = append(otherScores, float64(entry.Other.Score))
+
+			if entry.ScoreDifference() <= MaxAgreementDifference {
+				comparison.Agreements = append(comparison.Agreements, entry)
+			} else {
+				comparison.Disagreements = append(comparison.Disagreements, entry)
+			}
+		}
+
+		switch {
+		case entry.User.Status == "COMPLETED" && entry.Other.Status == "PLANNING":
+			comparison.UserCompleted = append(comparison.UserCompleted, entry)
+		case entry.Other.Status == "COMPLETED" && entry.User.Status == "PLANNING":
+			comparison.OtherCompleted = append(comparison.OtherCompleted, entry)
+		}
+	}
+
+	comparison.Scored = len(userScores)
+	if comparison.Scored >= MinAffinityEntries {
+		comparison.Affinity = pearson(userScores, otherScores)
+	}
+
+	title := func(entry *structs.SharedMediaEntry) string {
+		if entry.Media == nil {
+			return ""
+		}
+		return strings.ToLower(entry.Media.GetTitle())
+	}
+	// compare orders two entries like a minus b would, ties go by title
+	sortShared := func(entries []structs.SharedMediaEntry, compare func(a *structs.SharedMediaEntry, b *structs.SharedMediaEntry) int) {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if order := compare(&entries[i], &entries[j]); order != 0 {
+				return order < 0
+			}
+			return title(&entries[i]) < title(&entries[j])
+		})
+	}
+
+	sortShared(comparison.Agreements, func(a *structs.SharedMediaEntry, b *structs.SharedMediaEntry) int {
+		if order := a.ScoreDifference() - b.ScoreDifference(); order != 0 {
+			return order
+		}
+		return (b.User.Score + b.Other.Score) - (a.User.Score + a.Other.Score)
+	})
+	sortShared(comparison.Disagreements, func(a *structs.SharedMediaEntry, b *structs.SharedMediaEntry) int {
+		return b.ScoreDifference() - a.ScoreDifference()
+	})
+	sortShared(comparison.UserCompleted, func(a *structs.SharedMediaEntry, b *structs.SharedMediaEntry) int {
+		return b.User.Score - a.User.Score
+	})
+	sortShared(comparison.OtherCompleted, func(a *structs.SharedMediaEntry, b *structs.SharedMediaEntry) int {
+		return b.Other.Score - a.Other.Score
+	})
+
+	return comparison, nil
+}
+
+// pearson is the Pearson correlation of xs and ys, nil when either doesn't vary and
+// there is nothing to correlate.
+func pearson(xs []float64, ys []float64) *float64 {
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var covariance, varianceX, varianceY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+
+	if varianceX == 0 || varianceY == 0 {
+		return nil
+	}
+
+	correlation := covariance / math.Sqrt(varianceX*varianceY)
+	return &correlation
+}
+
+// GetUserFavourites returns a user's favourites of a type (ANIME or MANGA) in their order,
+// media favourites come with their media.
+func GetUserFavourites(ctx context.Context, userID snowflake.ID, favouriteType string) ([]structs.FavouriteEntry, error) {
+	favourites, err := getStore().GetUserFavourites(ctx, userID, favouriteType)
+	return favourites, checkTimeout(err)
+}
+
+// GetUserFavourite returns one of the user's favourites by its AniList ID. Gives
+// ErrNotFound when it isn't a favourite.
+func GetUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) (*structs.Favourite, error) {
+	favourite, err := getStore().GetUserFavourite(ctx, userID, favouriteType, idAnilist)
+	return favourite, checkTimeout(err)
+}
+
+// AddUserFavourite adds a favourite after the user's other favourites of its type. Gives
+// ErrDuplicate when it already is a favourite and ErrFavouriteLimit when the user has
+// too many.
+func AddUserFavourite(ctx context.Context, favourite *structs.Favourite) (*structs.Favourite, error) {
+	favourites, err := getStore().GetUserFavourites(ctx, favourite.UserID, favourite.Type)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	if len(favourites) >= MaxFavourites {
+		return nil, ErrFavouriteLimit
+	}
+
+	added := *favourite
+	added.Position = 0
+	if len(favourites) > 0 {
+		added.Position = favourites[len(favourites)-1].Position + 1
+	}
+
+	result, err := getStore().AddUserFavourite(ctx, &added)
+	return result, checkTimeout(err)
+}
+
+// DeleteUserFavourite removes one of the user's favourites. Gives ErrNotFound when it
+// isn't a favourite.
+func DeleteUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) error {
+	return checkTimeout(getStore().DeleteUserFavourite(ctx, userID, favouriteType, idAnilist))
+}
+
+// ToggleUserFavourite adds a favourite, or removes it when it already is one. Reports
+// whether it was added.
+func ToggleUserFavourite(ctx context.Context, favourite *structs.Favourite) (bool, error) {
+	_, err := AddUserFavourite(ctx, favourite)
+	if errors.Is(err, ErrDuplicate) {
+		err = DeleteUserFavourite(ctx, favourite.UserID, favourite.Type, favourite.IdAnilist)
+		// removed by someone else in between, the favourite is gone either way
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		return false, err
+	}
+	return err == nil, err
+}
+
+// MoveUserFavourite moves one of the user's favourites to position (starting at 1) and
+// returns the favourites in their new order. Positions past the end move it to the end.
+// Gives ErrNotFound when it isn't a favourite.
+func MoveUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int, position int) ([]structs.FavouriteEntry, error) {
+	favourites, err := getStore().GetUserFavourites(ctx, userID, favouriteType)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	from := -1
+	for i, favourite := range favourites {
+		if favourite.IdAnilist == idAnilist {
+			from = i
+		}
+	}
+
+	if from == -1 {
+		return nil, ErrNotFound
+	}
+
+	to := position - 1
+	if to < 0 {
+		to = 0
+	}
+	if to >= len(favourites) {
+		to = len(favourites) - 1
+	}
+
+	moved := favourites[from]
+	favourites = append(favourites[:from], favourites[from+1:]...)
+	favourites = append(favourites[:to], append([]structs.FavouriteEntry{moved}, favourites[to:]...)...)
+
+	favouriteIDs := make([]primitive.ObjectID, len(favourites))
+	for i := range favourites {
+		favourites[i].Position = i
+		favouriteIDs[i] = favourites[i].ID
+	}
+
+	if err := getStore().SetUserFavouritePositions(ctx, userID, favouriteType, favouriteIDs); err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	return favourites, nil
+}
+
+// GetUserSettings returns a user's settings. Users who never changed anything get the
+// defaults, and settings that are unknown or no longer valid are reset to them.
+func GetUserSettings(ctx context.Context, userID snowflake.ID) (*structs.UserSettings, error) {
+	settings, err := getStore().GetUserSettings(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		settings, err = &structs.UserSettings{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+
+	return withDefaultSettings(settings), nil
+}
+
+// SetUserScoreFormat saves the format a user's scores are shown and entered in.
+func SetUserScoreFormat(ctx context.Context, userID snowflake.ID, format score.Format) (*structs.UserSettings, error) {
+	if !format.Valid() {
+		return nil, fmt.Errorf("unknown score format %q", format)
+	}
+
+	settings, err := getStore().SetUserScoreFormat(ctx, userID, format)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+	return withDefaultSettings(settings), nil
+}
+
+// SetUserListPrivacy saves who can look at a user's lists.
+func SetUserListPrivacy(ctx context.Context, userID snowflake.ID, privacy structs.ListPrivacy) (*structs.UserSettings, error) {
+	if !privacy.Valid() {
+		return nil, fmt.Errorf("unknown list privacy %q", privacy)
+	}
+
+	settings, err := getStore().SetUserListPrivacy(ctx, userID, privacy)
+	if err != nil {
+		return nil, checkTimeout(err)
+	}
+	return withDefaultSettings(settings), nil
+}
+
+// withDefaultSettings replaces the settings a user hasn't picked, or that are no longer
+// valid, with the defaults.
+func withDefaultSettings(settings *structs.UserSettings) *structs.UserSettings {
+	if !settings.ScoreFormat.Valid() {
+		settings.ScoreFormat = score.DefaultFormat
+	}
+	if !settings.ListPrivacy.Valid() {
+		settings.ListPrivacy = structs.DefaultListPrivacy
+	}
+	return settings
+}
+
+// SaveGuildMember records that a user was seen in a guild.
+func SaveGuildMember(ctx context.Context, guildID snowflake.ID, userID snowflake.ID) error {
+	err := getStore().SaveGuildMember(ctx, &structs.GuildMember{GuildID: guildID, UserID: userID, SeenAt: time.Now()})
+	return checkTimeout(err)
+}
+
+// DeleteGuildMember forgets a user who isn't a member of a guild anymore.
+func DeleteGuildMember(ctx context.Context, guildID snowflake.ID, userID snowflake.ID) error {
+	return checkTimeout(getStore().DeleteGuildMember(ctx, guildID, userID))
+}
+
+// DeleteGuildMembers forgets every member of a guild, for guilds the bot was removed from.
+func DeleteGuildMembers(ctx context.Context, guildID snowflake.ID) error {
+	return checkTimeout(getStore().DeleteGuildMembers(ctx, guildID))
+}
+
+// GetUncheckedGuildMembers returns the recorded members of a guild who weren't seen or
+// checked in the last GuildMemberCheckInterval, longest ago first, up to
+// MaxGuildMemberChecks. SaveGuildMember marks a member as checked.
+func GetUncheckedGuildMembers(ctx context.Context, guildID snowflake.ID) ([]snowflake.ID, error) {
+	before := time.Now().Add(-GuildMemberCheckInterval)
+	userIDs, err := getStore().GetGuildMembersSeenBefore(ctx, guildID, before, MaxGuildMemberChecks)
+	return userIDs, checkTimeout(err)
+}
+
+// GetGuildLeaderboard ranks the recorded members of a guild, highest first, leaving out
+// members who keep their lists private and those with nothing to count. Up to limit
+// members are returned; some of them may have left the guild since they were recorded.
+func GetGuildLeaderboard(ctx context.Context, guildID snowflake.ID, board structs.Leaderboard, limit int) ([]structs.LeaderboardEntry, error) {
+	if !board.Valid() {
+		return nil, fmt.Errorf("unknown leaderboard %q", board)
+	}
+
+	// the active leaderboard counts from the start of the month
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	entries, err := getStore().GetGuildLeaderboard(ctx, guildID, board, since, limit)
+	return entries, checkTimeout(err)
+}
+
+// GetGuildTopMedia ranks the media of a type by the mean of the scores the recorded
+// members of a guild gave them, best first, up to MaxGuildTopMedia. Media need at least
+// minRatings scores, and the scores of members who keep their lists private don't count.
+func GetGuildTopMedia(ctx context.Context, guildID snowflake.ID, mediaType string, minRatings int) ([]structs.GuildMediaScore, error) {
+	if minRatings < 1 {
+		minRatings = 1
+	}
+
+	entries, err := getStore().GetGuildTopMedia(ctx, guildID, mediaType, minRatings, MaxGuildTopMedia)
+	return entries, checkTimeout(err)
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"math"
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// useTestStore makes the package functions use testStore until the test ends.
+func useTestStore(t *testing.T, testStore Store) {
+	storeOnce.Do(func() {})
+
+	previous := store
+	store = testStore
+	t.Cleanup(func() {
+		store = previous
+	})
+}
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   *float64
+	}{
+		{"same order", []float64{1, 2, 3, 4, 5}, []float64{2, 4, 6, 8, 10}, floatPointer(1)},
+		{"opposite order", []float64{1, 2, 3, 4, 5}, []float64{10, 8, 6, 4, 2}, floatPointer(-1)},
+		{"mostly the same order", []float64{1, 2, 3, 4, 5}, []float64{2, 1, 4, 3, 5}, floatPointer(0.8)},
+		{"unrelated", []float64{1, 2, 3}, []float64{1, 3, 1}, floatPointer(0)},
+		{"scores", []float64{80, 90, 60, 30, 70, 70, 20}, []float64{85, 90, 60, 90, 40, 80, 50}, floatPointer(0.28339303931268)},
+		{"first doesn't vary", []float64{70, 70, 70}, []float64{10, 50, 90}, nil},
+		{"second doesn't vary", []float64{10, 50, 90}, []float64{70, 70, 70}, nil},
+		{"a single score", []float64{70}, []float64{80}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := pearson(test.xs, test.ys)
+			switch {
+			case test.want == nil && got != nil:
+				t.Errorf("pearson() = %f, want nil", *got)
+			case test.want != nil && got == nil:
+				t.Errorf("pearson() = nil, want %f", *test.want)
+			case test.want != nil && math.Abs(*got-*test.want) > 1e-9:
+				t.Errorf("pearson() = %f, want %f", *got, *test.want)
+			}
+		})
+	}
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
+
+// sharedTestEntry is one media on the lists of both users of a comparison.
+type sharedTestEntry struct {
+	title                   string
+	userStatus, otherStatus string
+	userScore, otherScore   int
+}
+
+// compareTestLists puts entries on the lists of users 1 and 2 and compares them.
+func compareTestLists(t *testing.T, entries []sharedTestEntry) *structs.UserMediaComparison {
+	t.Helper()
+
+	const user, other snowflake.ID = 1, 2
+
+	testStore := testSQLiteStore(t)
+	useTestStore(t, testStore)
+
+	for i, entry := range entries {
+		media := importTestMedia(t, testStore, i+1, entry.title, 12)
+		if entry.userStatus != "" {
+			importTestEntry(t, testStore, structs.UserMedia{UserID: user, MediaID: media.ID, MediaType: "ANIME", Status: entry.userStatus, Score: entry.userScore})
+		}
+		if entry.otherStatus != "" {
+			importTestEntry(t, testStore, structs.UserMedia{UserID: other, MediaID: media.ID, MediaType: "ANIME", Status: entry.otherStatus, Score: entry.otherScore})
+		}
+	}
+
+	comparison, err := CompareUserMedia(context.Background(), user, other, "ANIME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comparison
+}
+
+func checkTitles(t *testing.T, section string, entries []structs.SharedMediaEntry, want ...string) {
+	t.Helper()
+
+	got := []string{}
+	for _, entry := range entries {
+		got = append(got, entry.Media.GetTitle())
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", section, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s = %v, want %v", section, got, want)
+			return
+		}
+	}
+}
+
+func TestCompareUserMedia(t *testing.T) {
+	comparison := compareTestLists(t, []sharedTestEntry{
+		{"Alpha", "COMPLETED", "COMPLETED", 80, 85},
+		{"Bravo", "COMPLETED", "COMPLETED", 90, 90},
+		{"Charlie", "COMPLETED", "COMPLETED", 60, 60},
+		{"Delta", "COMPLETED", "COMPLETED", 30, 90},
+		{"Echo", "COMPLETED", "COMPLETED", 70, 40},
+		{"Foxtrot", "COMPLETED", "PLANNING", 75, score.Unscored},
+		{"Golf", "PLANNING", "COMPLETED", score.Unscored, 95},
+		{"Hotel", "PLANNING", "COMPLETED", score.Unscored, 50},
+		{"India", "COMPLETED", "COMPLETED", 70, 80},
+		{"Juliet", "DROPPED", "CURRENT", 20, 50},
+		// only on one of the lists
+		{"Kilo", "COMPLETED", "", 100, 0},
+		{"Lima", "", "COMPLETED", 0, 100},
+		// scored by only one of them
+		{"Mike", "COMPLETED", "COMPLETED", 90, score.Unscored},
+	})
+
+	if comparison.Shared != 11 {
+		t.Errorf("Shared = %d, want 11", comparison.Shared)
+	}
+	if comparison.Scored != 7 {
+		t.Errorf("Scored = %d, want 7", comparison.Scored)
+	}
+	if comparison.Affinity == nil || math.Abs(*comparison.Affinity-0.28339303931268) > 1e-9 {
+		t.Errorf("Affinity = %v, want 0.2834", comparison.Affinity)
+	}
+
+	// closest first, then best liked; a difference of exactly MaxAgreementDifference agrees
+	checkTitles(t, "Agreements", comparison.Agreements, "Bravo", "Charlie", "Alpha", "India")
+	// furthest apart first, ties by title
+	checkTitles(t, "Disagreements", comparison.Disagreements, "Delta", "Echo", "Juliet")
+	checkTitles(t, "UserCompleted", comparison.UserCompleted, "Foxtrot")
+	// best scored first
+	checkTitles(t, "OtherCompleted", comparison.OtherCompleted, "Golf", "Hotel")
+}
+
+func TestCompareUserMediaTooFewScores(t *testing.T) {
+	entries := []sharedTestEntry{}
+	for i := 0; i < MinAffinityEntries-1; i++ {
+		entries = append(entries, sharedTestEntry{string(rune('A' + i)), "COMPLETED", "COMPLETED", 10 + i*20, 20 + i*20})
+	}
+	entries = append(entries, sharedTestEntry{"Unscored", "COMPLETED", "COMPLETED", score.Unscored, 50})
+
+	comparison := compareTestLists(t, entries)
+
+	if comparison.Scored != MinAffinityEntries-1 {
+		t.Errorf("Scored = %d, want %d", comparison.Scored, MinAffinityEntries-1)
+	}
+	if comparison.Affinity != nil {
+		t.Errorf("Affinity = %f, want nil below %d scored media", *comparison.Affinity, MinAffinityEntries)
+	}
+	if len(comparison.Agreements) != MinAffinityEntries-1 {
+		t.Errorf("%d agreements, want %d", len(comparison.Agreements), MinAffinityEntries-1)
+	}
+}
+
+func TestCompareUserMediaSameScores(t *testing.T) {
+	entries := []sharedTestEntry{}
+	for i := 0; i < MinAffinityEntries+1; i++ {
+		entries = append(entries, sharedTestEntry{string(rune('A' + i)), "COMPLETED", "COMPLETED", 70, 10 + i*10})
+	}
+
+	// one of them gave everything the same score, there is nothing to correlate
+	if comparison := compareTestLists(t, entries); comparison.Affinity != nil {
+		t.Errorf("Affinity = %f, want nil", *comparison.Affinity)
+	}
+}
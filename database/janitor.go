@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"ipmanlk/saika/config"
+	"log"
+	"time"
+)
+
+// Retention settings, read from the environment as durations (ex, "24h").
+var (
+	// SearchRetention is how long the results of a search can be paged through.
+	SearchRetention = config.GetDurationEnv("SEARCH_RETENTION", 24*time.Hour)
+	// JanitorInterval is how often RunJanitor removes expired state.
+	JanitorInterval = config.GetDurationEnv("JANITOR_INTERVAL", time.Hour)
+)
+
+// DeleteExpiredSearchQueries removes search snapshots past their expiry and
+// returns how many were removed.
+func DeleteExpiredSearchQueries(ctx context.Context) (int64, error) {
+	deleted, err := getStore().DeleteExpiredSearchQueries(ctx)
+	return deleted, checkTimeout(err)
+}
+
+// RunJanitor removes expired interaction state every JanitorInterval until ctx is done.
+func RunJanitor(ctx context.Context) {
+	ticker := time.NewTicker(JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := DeleteExpiredSearchQueries(ctx)
+		if err != nil {
+			log.Printf("Failed to delete expired search queries: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d expired search queries", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrMigrationLocked is returned by a store's MigrateUp while another instance holds the migration lock.
+var ErrMigrationLocked = errors.New("another instance is migrating the database")
+
+// A lock older than this is considered abandoned (ex, the instance holding it crashed).
+// The instance holding it renews it every migrationLockRenewal while it migrates, so
+// migrations can take longer than this.
+const (
+	migrationLockTTL     = 10 * time.Minute
+	migrationLockRenewal = migrationLockTTL / 5
+)
+
+// How often MigrateUp checks whether a held migration lock was released.
+const migrationLockRetry = 2 * time.Second
+
+// MigrationStatus describes one migration known to the running binary.
+// AppliedAt is zero for migrations that have not run yet.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (status *MigrationStatus) Applied() bool {
+	return !status.AppliedAt.IsZero()
+}
+
+// MigrateUp applies every pending migration in version order and returns the ones it applied.
+// When another instance is already migrating, it waits for that instance to finish first.
+func MigrateUp(ctx context.Context) ([]MigrationStatus, error) {
+	for {
+		applied, err := getStore().MigrateUp(ctx)
+		if !errors.Is(err, ErrMigrationLocked) {
+			return applied, checkTimeout(err)
+		}
+
+		log.Printf("Waiting for another instance to finish migrating the database")
+
+		select {
+		case <-ctx.Done():
+			return nil, checkTimeout(ctx.Err())
+		case <-time.After(migrationLockRetry):
+		}
+	}
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied.
+func GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := getStore().MigrationStatus(ctx)
+	return statuses, checkTimeout(err)
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"ipmanlk/saika/config"
+	"ipmanlk/saika/listview"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/search"
 	"ipmanlk/saika/structs"
 	"log"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,8 +27,29 @@ var (
 	database       = config.GetEnv("MONGO_DATABASE", "")
 )
 
+// MongoStore keeps everything in the MongoDB database named by MONGO_DATABASE.
+type MongoStore struct{}
+
+const duplicateKeyCode = 11000
+
+// Weights of the media text index, titles count the most.
+var mediaTextIndexWeights = bson.D{
+	{Key: "title.english", Value: 10},
+	{Key: "title.romaji", Value: 10},
+	{Key: "title.native", Value: 10},
+	{Key: "synonyms", Value: 6},
+	{Key: "genres", Value: 3},
+	{Key: "tags.name", Value: 3},
+	{Key: "description", Value: 1},
+}
+
+// titleMatchBoost is added to the text score of media whose title contains the
+// whole search text, so title hits stay ahead of everything else.
+const titleMatchBoost = 100
+
+// InitMongoDb connects to MongoDB. Indexes are created by the migrations in mongodb_migrations.go.
 func InitMongoDb() {
-	ensureUniqueIndex(GetCollection("media"), "media_hash")
+	GetMongoClient()
 }
 
 func GetMongoClient() *mongo.Client {
@@ -59,178 +85,346 @@ func GetCollection(collectionName string) *mongo.Collection {
 	return db.Collection(collectionName)
 }
 
-func ensureUniqueIndex(collection *mongo.Collection, fieldName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// translateError maps mongo driver errors onto the errors shared by every store.
+func translateError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func ensureUniqueIndex(ctx context.Context, collection *mongo.Collection, fieldName string) error {
+	return ensureIndex(ctx, collection, bson.D{{Key: fieldName, Value: 1}}, options.Index().SetUnique(true))
+}
 
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{fieldName: 1},
-		Options: options.Index().SetUnique(true),
+func ensureTextIndex(ctx context.Context, collection *mongo.Collection, name string, weights bson.D) error {
+	keys := bson.D{}
+	for _, weight := range weights {
+		keys = append(keys, bson.E{Key: weight.Key, Value: "text"})
 	}
 
-	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	return ensureIndex(ctx, collection, keys, options.Index().SetName(name).SetWeights(weights))
+}
+
+// upsertOne updates the document matching filter, inserting it when there is none, and
+// decodes the document as it is after the update. Two upserts racing to insert the same
+// document make the loser fail on the unique index; it is retried once, as an update.
+func upsertOne(ctx context.Context, collection *mongo.Collection, filter bson.M, update interface{}, result interface{}) error {
+	options := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 
-	if err != nil {
-		return err
+	err := collection.FindOneAndUpdate(ctx, filter, update, options).Decode(result)
+	if mongo.IsDuplicateKeyError(err) {
+		err = collection.FindOneAndUpdate(ctx, filter, update, options).Decode(result)
 	}
 
-	return nil
+	return err
 }
 
-func SaveMedia(media []structs.AnilistMedia) error {
+// ensureIndex creates an index, doing nothing if an identical one already exists.
+func ensureIndex(ctx context.Context, collection *mongo.Collection, keys bson.D, indexOptions *options.IndexOptions) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: indexOptions})
+	return err
+}
+
+func (s *MongoStore) SaveMedia(ctx context.Context, media []structs.AnilistMedia) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
 	collection := GetCollection("media")
-	// loop through the media.
-	// 1. if id_anilist is not in the database, insert a new document
-	// 2. if id_anilist is in the database and media_hash is different, update the document
-	for _, media := range media {
+
+	// one upsert per media, keyed on id_anilist and only matching when the stored hash differs:
+	// 1. if id_anilist is not in the database, the upsert inserts a new document
+	// 2. if id_anilist is in the database and media_hash is different, the document is updated
+	// 3. if media_hash is unchanged the filter misses and the insert hits the unique
+	//    id_anilist index; that duplicate key error just means there is nothing to do
+	models := make([]mongo.WriteModel, len(media))
+	for i, media := range media {
 		media.MediaHash = media.Hash()
 
-		// check if the document exists in the database
-		var result structs.AnilistMedia
-		err := collection.FindOne(context.Background(), bson.M{"id_anilist": media.IdAnilist}).Decode(&result)
-		if err != nil {
-			if err != mongo.ErrNoDocuments {
-				return err
-			}
-			// if the document does not exist, insert a new document
-			_, err := collection.InsertOne(context.Background(), media)
-			if err != nil {
-				return err
-			}
-		} else {
-			// if the document exists, check if the media_hash is different
-			if result.Hash() != media.MediaHash {
-				// if the media_hash is different, update the document
-				_, err := collection.UpdateOne(context.Background(), bson.M{"id_anilist": media.IdAnilist}, bson.M{"$set": media})
-				if err != nil {
-					return err
-				}
-			}
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"id_anilist": media.IdAnilist, "media_hash": bson.M{"$ne": media.MediaHash}}).
+			SetUpdate(bson.M{"$set": media}).
+			SetUpsert(true)
+	}
+
+	_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err == nil {
+		return nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return err
+	}
+
+	failures := map[int]error{}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code == duplicateKeyCode {
+			continue
 		}
+		failures[media[writeErr.Index].IdAnilist] = writeErr
+	}
+
+	if len(failures) > 0 {
+		return &SaveMediaError{Failures: failures}
 	}
+
 	return nil
 }
 
-func GetMediaByIDAnilist(idAnilist int) (*structs.AnilistMedia, error) {
+func (s *MongoStore) GetMediaByIDAnilist(ctx context.Context, idAnilist int) (*structs.AnilistMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	collection := GetCollection("media")
 
 	var result structs.AnilistMedia
-	err := collection.FindOne(context.Background(), bson.M{"id_anilist": idAnilist}).Decode(&result)
+	err := collection.FindOne(ctx, bson.M{"id_anilist": idAnilist}).Decode(&result)
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return &result, nil
 }
 
-func GetMediaByObjectID(objectID primitive.ObjectID) (*structs.AnilistMedia, error) {
+func (s *MongoStore) GetMediaByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	collection := GetCollection("media")
 
 	var result structs.AnilistMedia
-	err := collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&result)
+	err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&result)
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return &result, nil
 }
 
-func GetMediaByHexID(hexID string) (*structs.AnilistMedia, error) {
-	objectID, err := primitive.ObjectIDFromHex(hexID)
+func (s *MongoStore) GetUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+
+	var result structs.UserMedia
+	err := collection.FindOne(ctx, bson.M{"_id": objectID, "user_id": userID}).Decode(&result)
+
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
-	return GetMediaByObjectID(objectID)
+	return &result, nil
 }
 
-func GetUserMediaByHexID(hexID string) (*structs.UserMedia, error) {
-	objectID, err := primitive.ObjectIDFromHex(hexID)
-	if err != nil {
-		return nil, err
-	}
+func (s *MongoStore) GetUserMediaByMediaID(ctx context.Context, userID snowflake.ID, mediaID primitive.ObjectID) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
 
 	collection := GetCollection("user_media")
 
 	var result structs.UserMedia
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&result)
+	err := collection.FindOne(ctx, bson.M{"user_id": userID, "media_id": mediaID}).Decode(&result)
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return &result, nil
 }
 
-// function for saving anilist search query in the database
-func SaveSearchQuery(storeQuery *structs.AnilistSearchQuery) (query *structs.AnilistSearchQuery, err error) {
+func (s *MongoStore) SaveSearchQuery(ctx context.Context, storeQuery *structs.AnilistSearchQuery) (*structs.AnilistSearchQuery, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
 	collection := GetCollection("search_queries")
 
-	// check if the document exists in the database using user_id and search_text
-	var result structs.AnilistSearchQuery
+	query := *storeQuery
+	query.ID = primitive.NewObjectID()
+	query.CreatedAt = time.Now()
+	// removed by the TTL index on expires_at
+	query.ExpiresAt = query.CreatedAt.Add(SearchRetention)
 
-	err = collection.FindOne(context.Background(), bson.M{"search_text": storeQuery.SearchText, "media_type": storeQuery.MediaType}).Decode(&result)
+	_, err := collection.InsertOne(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &query, nil
+}
+
+// DeleteExpiredSearchQueries backs up the TTL index, which only removes
+// documents once a minute and not at all while the server is busy.
+func (s *MongoStore) DeleteExpiredSearchQueries(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
 
+	result, err := GetCollection("search_queries").DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
 	if err != nil {
-		if err != mongo.ErrNoDocuments {
-			return nil, err
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (s *MongoStore) GetSearchQueryByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistSearchQuery, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("search_queries")
+
+	// the TTL monitor only runs once a minute, so expired snapshots may still be around
+	var result structs.AnilistSearchQuery
+	err := collection.FindOne(ctx, bson.M{"_id": objectID, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&result)
+
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &result, nil
+}
+
+// mongoSearchFilters turns the non-text parts of a search into mongo filters.
+func mongoSearchFilters(query *search.Query, mediaType string, nsfw bool) []bson.M {
+	filters := []bson.M{{"type": mediaType}}
+
+	if !nsfw {
+		filters = append(filters, bson.M{"is_adult": false})
+	}
+
+	for _, genre := range query.Genres {
+		filters = append(filters, bson.M{"genres": genre})
+	}
+
+	for _, tag := range query.Tags {
+		filters = append(filters, bson.M{"tags.name": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(tag) + "$", Options: "i"}})
+	}
+
+	if query.Year > 0 {
+		filters = append(filters, bson.M{"start_date.year": query.Year})
+	}
+
+	if query.Format != "" {
+		filters = append(filters, bson.M{"format": query.Format})
+	}
+
+	if query.ScoreGreater >= 0 {
+		filters = append(filters, bson.M{"average_score": bson.M{"$gt": query.ScoreGreater}})
+	}
+
+	if query.ScoreLesser >= 0 {
+		filters = append(filters, bson.M{"average_score": bson.M{"$lt": query.ScoreLesser}})
+	}
+
+	if len(query.Excludes) > 0 {
+		var excluded []bson.M
+		for _, exclude := range query.Excludes {
+			excludeRegex := primitive.Regex{Pattern: regexp.QuoteMeta(exclude), Options: "i"}
+			excluded = append(excluded,
+				bson.M{"title.english": excludeRegex},
+				bson.M{"title.romaji": excludeRegex},
+				bson.M{"title.native": excludeRegex},
+				bson.M{"synonyms": excludeRegex},
+				bson.M{"description": excludeRegex},
+				bson.M{"genres": excludeRegex},
+				bson.M{"tags.name": excludeRegex},
+			)
 		}
+		filters = append(filters, bson.M{"$nor": excluded})
+	}
+
+	return filters
+}
+
+// mongoTextSearch builds a $text search string: words match any, phrases must all match.
+func mongoTextSearch(query *search.Query) string {
+	terms := append([]string{}, query.Words...)
+	for _, phrase := range query.Phrases {
+		terms = append(terms, `"`+phrase+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func (s *MongoStore) SearchMedia(ctx context.Context, query *search.Query, mediaType string, nsfw bool) ([]structs.AnilistMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
 
-		storeQuery.CreatedAt = time.Now()
-		storeQuery.LastUsedAt = time.Now()
+	collection := GetCollection("media")
 
-		// if the document does not exist, insert a new document and return the document from the database
-		// with mongodb id
-		res, err := collection.InsertOne(context.Background(), storeQuery)
+	// Without any text there is nothing to rank by, show the best rated matches instead
+	if !query.HasText() {
+		cursor, err := collection.Find(ctx, bson.M{"$and": mongoSearchFilters(query, mediaType, nsfw)},
+			options.Find().SetSort(bson.D{{Key: "average_score", Value: -1}}).SetLimit(20))
 		if err != nil {
 			return nil, err
 		}
 
-		err = collection.FindOne(context.Background(), bson.M{"_id": res.InsertedID}).Decode(&result)
+		var results []structs.AnilistMedia
+		err = cursor.All(ctx, &results)
 		if err != nil {
 			return nil, err
 		}
 
-		return &result, nil
+		return results, nil
 	}
 
-	// if document exists, update last_used_at and return the document from the database
-	// with mongodb id
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": result.ID}, bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+	textFilter := bson.M{"$text": bson.M{"$search": mongoTextSearch(query)}}
 
-	if err != nil {
-		return nil, err
+	lowerText := strings.ToLower(query.Text())
+	titleContains := func(field string) bson.M {
+		return bson.M{"$gte": bson.A{bson.M{"$indexOfCP": bson.A{bson.M{"$toLower": bson.M{"$ifNull": bson.A{field, ""}}}, lowerText}}, 0}}
 	}
 
-	// document already exists
-	return &result, nil
-}
-
-func GetSearchQueryByHexID(hexID string) (*structs.AnilistSearchQuery, error) {
-	objectID, _ := primitive.ObjectIDFromHex(hexID)
-
-	collection := GetCollection("search_queries")
+	// Rank by text score, with titles containing the whole search text boosted to the top
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": append([]bson.M{textFilter}, mongoSearchFilters(query, mediaType, nsfw)...)}}},
+		{{Key: "$addFields", Value: bson.M{"search_score": bson.M{"$add": bson.A{
+			bson.M{"$meta": "textScore"},
+			bson.M{"$cond": bson.A{
+				bson.M{"$or": bson.A{titleContains("$title.english"), titleContains("$title.romaji"), titleContains("$title.native")}},
+				titleMatchBoost,
+				0,
+			}},
+		}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "search_score", Value: -1}}}},
+		{{Key: "$limit", Value: 20}},
+	}
 
-	var result structs.AnilistSearchQuery
-	err := collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&result)
+	rankedCursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
 
+	// decode the cursor to a slice of structs
+	var rankedMedia []structs.AnilistMedia
+	err = rankedCursor.All(ctx, &rankedMedia)
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
-}
+	if len(rankedMedia) >= 20 {
+		return rankedMedia, nil
+	}
 
-func SearchMedia(searchText string, mediaType string, nsfw bool) ([]structs.AnilistMedia, error) {
-	collection := GetCollection("media")
+	// The text index only matches whole words, so fill in the remaining slots with
+	// partial title matches (ex, "naru" for Naruto), excluding the ones already ranked
+	var rankedIDs []primitive.ObjectID
+	for _, media := range rankedMedia {
+		rankedIDs = append(rankedIDs, media.ID)
+	}
 
-	// Regular expression to allow for case-insensitive search
-	searchRegex := primitive.Regex{Pattern: searchText, Options: "i"}
+	// the search text is escaped, it is matched literally and case-insensitively
+	searchRegex := primitive.Regex{Pattern: regexp.QuoteMeta(query.Text()), Options: "i"}
 
 	titleFilter := bson.M{
-		"$and": []bson.M{
+		"$and": append([]bson.M{
 			{
 				"$or": []bson.M{
 					{"title.english": searchRegex},
@@ -238,193 +432,1037 @@ func SearchMedia(searchText string, mediaType string, nsfw bool) ([]structs.Anil
 					{"title.native": searchRegex},
 				},
 			},
-			{"type": mediaType},
-		},
-	}
-
-	if !nsfw {
-		titleFilter["$and"] = append(titleFilter["$and"].([]bson.M), bson.M{"is_adult": false})
+			{"_id": bson.M{"$nin": rankedIDs}},
+		}, mongoSearchFilters(query, mediaType, nsfw)...),
 	}
 
-	options := options.Find()
-	options.SetLimit(20)
-
-	// Find matches in the title first
-	titleCursor, err := collection.Find(context.Background(), titleFilter, options)
+	titleCursor, err := collection.Find(ctx, titleFilter, options.Find().SetLimit(20-int64(len(rankedMedia))))
 	if err != nil {
 		return nil, err
 	}
 
-	// decode the cursor to a slice of structs
 	var titleMedia []structs.AnilistMedia
-	err = titleCursor.All(context.Background(), &titleMedia)
+	err = titleCursor.All(ctx, &titleMedia)
 	if err != nil {
 		return nil, err
 	}
 
-	// If there are less than 20 matches, fill in the remaining slots with matches from other fields
-	if len(titleMedia) < 20 {
-		options.SetLimit(20 - int64(len(titleMedia)))
+	return append(rankedMedia, titleMedia...), nil
+}
 
-		// Get the ObjectIDs of the title matches
-		var titleIDs []primitive.ObjectID
-		for _, media := range titleMedia {
-			titleIDs = append(titleIDs, media.ID)
-		}
+func (s *MongoStore) SaveUserMedia(ctx context.Context, userMedia *structs.UserMedia) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
 
-		// Query for matches in other fields, excluding the ones already matched by title
-		otherFilter := bson.M{
-			"$and": []bson.M{
-				{
-					"$or": []bson.M{
-						{"description": searchRegex},
-						{"genres": searchRegex},
-						{"tags.name": searchRegex},
-					},
-				},
-				{"type": mediaType},
-				{"_id": bson.M{"$nin": titleIDs}},
-			},
-		}
+	collection := GetCollection("user_media")
 
-		if !nsfw {
-			otherFilter["$and"] = append(otherFilter["$and"].([]bson.M), bson.M{"is_adult": false})
-		}
+	// a pipeline update, so the new values can depend on the current ones; on insert
+	// the document starts out as the filter and every "$field" is missing
+	now := time.Now()
+	set := bson.M{
+		"created_at": bson.M{"$ifNull": bson.A{"$created_at", now}},
+		"media_type": bson.M{"$ifNull": bson.A{"$media_type", userMedia.MediaType}},
+		"status":     bson.M{"$ifNull": bson.A{"$status", "PLANNING"}},
+		"score":      bson.M{"$ifNull": bson.A{"$score", score.Unscored}},
+		"updated_at": now,
+		// new entries are scored out of 100 from the start, migration 9 must not convert them
+		"score_scale": score.Max,
+	}
 
-		otherCursor, err := collection.Find(context.Background(), otherFilter, options)
-		if err != nil {
-			return nil, err
+	// an empty status keeps the current one
+	if userMedia.Status != "" {
+		set["status"] = userMedia.Status
+		for field, value := range mongoStatusHistory(userMedia.Status, structs.NewFuzzyDate(now)) {
+			set[field] = value
 		}
+	}
 
-		var otherMedia []structs.AnilistMedia
-		err = otherCursor.All(context.Background(), &otherMedia)
-		if err != nil {
-			return nil, err
+	// the unique (user_id, media_id) index makes this a single entry per user and media
+	filter := bson.M{"user_id": userMedia.UserID, "media_id": userMedia.MediaID}
+	update := mongo.Pipeline{{{Key: "$set", Value: set}}}
+
+	var result structs.UserMedia
+	err := upsertOne(ctx, collection, filter, update, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// mongoStatusHistory gives the pipeline $set fields that record an entry moving into
+// status (from another status, or as a new entry): starting it sets started_at unless
+// already known, completing it sets completed_at unless already known, and completing
+// a rewatch counts it in repeat and moves completed_at to today.
+func mongoStatusHistory(status string, today structs.AnilistFuzzyDate) bson.M {
+	entering := bson.M{"$ne": bson.A{"$status", status}}
+
+	switch status {
+	case "CURRENT", "REPEATING":
+		return bson.M{
+			"started_at": bson.M{"$cond": bson.A{bson.M{"$and": bson.A{entering, mongoUnset("started_at")}}, today, "$started_at"}},
+		}
+	case "COMPLETED":
+		rewatched := bson.M{"$eq": bson.A{"$status", "REPEATING"}}
+		return bson.M{
+			"completed_at": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{entering, bson.M{"$or": bson.A{mongoUnset("completed_at"), rewatched}}}}, today, "$completed_at",
+			}},
+			"repeat": bson.M{"$cond": bson.A{rewatched, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$repeat", 0}}, 1}}, "$repeat"}},
 		}
+	default:
+		return bson.M{}
+	}
+}
+
+// mongoUnset is true for fields that are missing or null.
+func mongoUnset(field string) bson.M {
+	return bson.M{"$in": bson.A{bson.M{"$type": "$" + field}, bson.A{"missing", "null"}}}
+}
 
-		// Concatenate the two slices
-		titleMedia = append(titleMedia, otherMedia...)
+func (s *MongoStore) IncrementUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, limit int) (*structs.UserMedia, error) {
+	current := bson.M{"$ifNull": bson.A{"$progress", 0}}
+	var progress interface{} = bson.M{"$add": bson.A{current, 1}}
+	if limit > 0 {
+		// progress that is already past the limit is left alone
+		progress = bson.M{"$max": bson.A{bson.M{"$min": bson.A{progress, limit}}, current}}
 	}
 
-	return titleMedia, nil
+	return updateUserMediaProgress(ctx, userID, objectID, progress, bson.M{})
+}
+
+func (s *MongoStore) SetUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, progress int, progressVolumes int) (*structs.UserMedia, error) {
+	return updateUserMediaProgress(ctx, userID, objectID, progress, bson.M{"progress_volumes": progressVolumes})
+}
+
+func (s *MongoStore) SetUserMediaHistory(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, startedAt *structs.AnilistFuzzyDate, completedAt *structs.AnilistFuzzyDate, repeat int) (*structs.UserMedia, error) {
+	return updateUserMedia(ctx, userID, objectID, bson.M{"$set": bson.M{
+		"started_at":   startedAt,
+		"completed_at": completedAt,
+		"repeat":       repeat,
+		"updated_at":   time.Now(),
+	}})
 }
 
-func SaveUserMedia(userMedia *structs.UserMedia) (*structs.UserMedia, error) {
+func (s *MongoStore) SetUserMediaRating(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, score int, note string, review string) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
 	collection := GetCollection("user_media")
 
-	// check if the document exists in the database using user_id and search_text
-	var result structs.UserMedia
+	now := time.Now()
+	set := bson.M{"score": score, "updated_at": now}
+
+	// user text is wrapped in $literal, a pipeline would read "$..." as a field path
+	changed := func(field string, value string) bson.M {
+		return bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$" + field, ""}}, bson.M{"$literal": value}}}
+	}
+
+	if note == "" {
+		set["note"] = "$$REMOVE"
+		set["note_updated_at"] = "$$REMOVE"
+	} else {
+		set["note"] = bson.M{"$literal": note}
+		set["note_updated_at"] = bson.M{"$cond": bson.A{changed("note", note), now, "$note_updated_at"}}
+	}
 
-	err := collection.FindOne(context.Background(), bson.M{"user_id": userMedia.UserID, "media_id": userMedia.MediaID}).Decode(&result)
+	if review == "" {
+		set["review"] = "$$REMOVE"
+		set["review_created_at"] = "$$REMOVE"
+		set["review_updated_at"] = "$$REMOVE"
+	} else {
+		set["review"] = bson.M{"$literal": review}
+		set["review_created_at"] = bson.M{"$cond": bson.A{changed("review", ""), "$review_created_at", now}}
+		set["review_updated_at"] = bson.M{"$cond": bson.A{changed("review", review), now, "$review_updated_at"}}
+	}
 
+	update := mongo.Pipeline{{{Key: "$set", Value: set}}}
+	options := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result structs.UserMedia
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID, "user_id": userID}, update, options).Decode(&result)
 	if err != nil {
-		if err != mongo.ErrNoDocuments {
-			return nil, err
-		}
+		return nil, translateError(err)
+	}
 
-		if userMedia.Status == "" {
-			userMedia.Status = "planning"
-		}
+	return &result, nil
+}
 
-		userMedia.CreatedAt = time.Now()
-		userMedia.UpdatedAt = time.Now()
+// updateUserMediaProgress sets progress (a value or an expression on the current
+// document) and moves planned entries to CURRENT, as started today, when it goes up. Every field in a
+// single $set stage sees the document as it was before the update.
+func updateUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, progress interface{}, set bson.M) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
 
-		// if the document does not exist, insert a new document and return the document from the database
-		// with mongodb id
-		res, err := collection.InsertOne(context.Background(), userMedia)
-		if err != nil {
-			return nil, err
-		}
+	collection := GetCollection("user_media")
 
-		err = collection.FindOne(context.Background(), bson.M{"_id": res.InsertedID}).Decode(&result)
-		if err != nil {
-			return nil, err
-		}
+	started := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$status", "PLANNING"}},
+		bson.M{"$gt": bson.A{progress, bson.M{"$ifNull": bson.A{"$progress", 0}}}},
+	}}
 
-		return &result, nil
-	}
+	now := time.Now()
+	set["progress"] = progress
+	set["status"] = bson.M{"$cond": bson.A{started, "CURRENT", "$status"}}
+	set["started_at"] = bson.M{"$cond": bson.A{bson.M{"$and": bson.A{started, mongoUnset("started_at")}}, structs.NewFuzzyDate(now), "$started_at"}}
+	set["updated_at"] = now
 
-	// if document exists, update last_used_at and return the document from the database
-	// with mongodb id
-	var newStatus = userMedia.Status
-	if newStatus == "" {
-		newStatus = result.Status
-	}
+	update := mongo.Pipeline{{{Key: "$set", Value: set}}}
+	options := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	var newScore = userMedia.Score
-	if newScore == 0 {
-		newScore = -1
+	var result structs.UserMedia
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID, "user_id": userID}, update, options).Decode(&result)
+	if err != nil {
+		return nil, translateError(err)
 	}
 
-	var updateResult *mongo.UpdateResult
-	updateResult, err = collection.UpdateOne(context.Background(), bson.M{"_id": result.ID}, bson.M{"$set": bson.M{"updated_at": time.Now(), "status": newStatus, "score": newScore}})
+	return &result, nil
+}
+
+func (s *MongoStore) CountUserMediaByStatus(ctx context.Context, userID snowflake.ID, mediaType string) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "media_type": mediaType}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	}
 
+	cursor, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 
-	if updateResult.ModifiedCount == 0 {
-		return nil, errors.New("no documents were modified")
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
 	}
-
-	// return the updated document
-	err = collection.FindOne(context.Background(), bson.M{"_id": result.ID}).Decode(&result)
+	err = cursor.All(ctx, &groups)
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	counts := map[string]int{}
+	for _, group := range groups {
+		counts[group.Status] = group.Count
+	}
+
+	return counts, nil
+}
+
+func (s *MongoStore) GetUserMediaPage(ctx context.Context, userID snowflake.ID, mediaType string, status string, view listview.View, page int) (*structs.UserMediaPage, error) {
+	return mongoUserMediaPage(ctx, bson.M{"user_id": userID, "media_type": mediaType, "status": status}, view, page)
 }
 
-func GetAllUserMedia(userID snowflake.ID, mediaType string, status string) ([]structs.UserMedia, error) {
+// mongoUserMediaPage returns a page of the user_media documents matching filter, sorted
+// and filtered by view.
+func mongoUserMediaPage(ctx context.Context, filter bson.M, view listview.View, page int) (*structs.UserMediaPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	collection := GetCollection("user_media")
 
-	var filter bson.M
-	if status == "" {
-		filter = bson.M{
-			"$and": []bson.M{
-				{"user_id": userID},
-				{"media_type": mediaType},
-			},
+	switch view.Scored {
+	case listview.ScoredYes:
+		filter["score"] = bson.M{"$gte": 0}
+	case listview.ScoredNo:
+		filter["score"] = bson.M{"$lt": 0}
+	}
+
+	lookup := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "media_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}}
+
+	// the media are only looked up before the page is cut when the view needs them,
+	// otherwise only the page's own media are fetched
+	if view.NeedsMedia() {
+		pipeline = append(pipeline, lookup...)
+
+		mediaFilter := bson.M{}
+		if len(view.Formats) > 0 {
+			mediaFilter["media.format"] = bson.M{"$in": view.Formats}
 		}
-	} else {
-		filter = bson.M{
-			"$and": []bson.M{
-				{"user_id": userID},
-				{"media_type": mediaType},
-				{"status": status},
-			},
+		if len(view.Statuses) > 0 {
+			mediaFilter["media.status"] = bson.M{"$in": view.Statuses}
+		}
+		if view.Genre != "" {
+			mediaFilter["media.genres"] = view.Genre
 		}
+		if len(mediaFilter) > 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: mediaFilter}})
+		}
+	}
+
+	total, err := mongoCount(ctx, collection, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	// _id breaks ties, so entries don't move between pages
+	sortOrder := bson.D{{Key: "_id", Value: 1}}
+	switch view.GetSort() {
+	case listview.SortTitle:
+		// the title shown is the english one when there is one (see AnilistMedia.GetTitle)
+		english := bson.M{"$ifNull": bson.A{"$media.title.english", ""}}
+		romaji := bson.M{"$ifNull": bson.A{"$media.title.romaji", ""}}
+		title := bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{english, ""}}, romaji, english}}
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{"sort_title": bson.M{"$toLower": title}}}})
+		sortOrder = bson.D{{Key: "sort_title", Value: 1}, {Key: "_id", Value: 1}}
+	case listview.SortScore:
+		sortOrder = bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}
+	case listview.SortUpdated:
+		sortOrder = bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: 1}}
+	case listview.SortYear:
+		sortOrder = bson.D{{Key: "media.start_date.year", Value: -1}, {Key: "_id", Value: 1}}
+	case listview.SortProgress:
+		sortOrder = bson.D{{Key: "progress", Value: -1}, {Key: "_id", Value: 1}}
 	}
 
-	options := options.Find()
-	options.SetLimit(20)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: sortOrder}},
+		bson.D{{Key: "$skip", Value: int64((page - 1) * UserMediaPageSize)}},
+		bson.D{{Key: "$limit", Value: int64(UserMediaPageSize)}},
+	)
+
+	if !view.NeedsMedia() {
+		pipeline = append(pipeline, lookup...)
+	}
 
-	cursor, err := collection.Find(context.Background(), filter, options)
+	cursor, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 
-	// decode the cursor to a slice of structs
-	var media []structs.UserMedia
-	err = cursor.All(context.Background(), &media)
+	var media []structs.UserMediaEntry
+	err = cursor.All(ctx, &media)
 	if err != nil {
 		return nil, err
 	}
 
-	return media, nil
+	return &structs.UserMediaPage{Entries: media, Page: page, PerPage: UserMediaPageSize, Total: total}, nil
+}
+
+// mongoCount returns the number of documents coming out of pipeline.
+func mongoCount(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) (int, error) {
+	counted := append(mongo.Pipeline{}, pipeline...)
+	counted = append(counted, bson.D{{Key: "$count", Value: "total"}})
+
+	cursor, err := collection.Aggregate(ctx, counted)
+	if err != nil {
+		return 0, err
+	}
+
+	var results []struct {
+		Total int `bson:"total"`
+	}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return 0, err
+	}
+
+	// $count gives no document at all for an empty result
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	return results[0].Total, nil
 }
 
-func DeleteUserMediaByHexID(hexID string) error {
-	objectID, _ := primitive.ObjectIDFromHex(hexID)
+func (s *MongoStore) GetUserReviewsPage(ctx context.Context, userID snowflake.ID, page int) (*structs.UserMediaPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
 
 	collection := GetCollection("user_media")
 
-	_, err := collection.DeleteOne(context.Background(), bson.M{"_id": objectID})
+	filter := bson.M{"user_id": userID, "review": bson.M{"$exists": true, "$ne": ""}}
 
+	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "review_updated_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$skip", Value: int64((page - 1) * ReviewsPageSize)}},
+		{{Key: "$limit", Value: int64(ReviewsPageSize)}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "media_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var media []structs.UserMediaEntry
+	err = cursor.All(ctx, &media)
+	if err != nil {
+		return nil, err
+	}
+
+	return &structs.UserMediaPage{Entries: media, Page: page, PerPage: ReviewsPageSize, Total: int(total)}, nil
+}
+
+func (s *MongoStore) GetSharedUserMedia(ctx context.Context, userID snowflake.ID, otherUserID snowflake.ID, mediaType string) ([]structs.SharedMediaEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+
+	// both entries of a shared media end up in the same group, and only media with
+	// two entries are shared since an entry per user and media is unique
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": bson.M{"$in": bson.A{userID, otherUserID}}, "media_type": mediaType}}},
+		{{Key: "$group", Value: bson.M{"_id": "$media_id", "entries": bson.M{"$push": "$$ROOT"}}}},
+		{{Key: "$match", Value: bson.M{"entries.1": bson.M{"$exists": true}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		Entries []structs.UserMedia   `bson:"entries"`
+		Media   *structs.AnilistMedia `bson:"media,omitempty"`
+	}
+	err = cursor.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := make([]structs.SharedMediaEntry, 0, len(groups))
+	for _, group := range groups {
+		entry := structs.SharedMediaEntry{Media: group.Media, User: group.Entries[0], Other: group.Entries[1]}
+		if entry.User.UserID != userID {
+			entry.User, entry.Other = entry.Other, entry.User
+		}
+		shared = append(shared, entry)
+	}
+
+	return shared, nil
+}
+
+// mongoEntryProgress is the number of episodes (chapters) a joined user_media entry went
+// through, total being the path of the media's count. Entries added as completed never
+// had their progress set, so completed entries count the whole media, and finished
+// rewatches (rereads) went through it again.
+func mongoEntryProgress(total string) bson.M {
+	progress := bson.M{"$ifNull": bson.A{"$progress", 0}}
+	mediaTotal := bson.M{"$ifNull": bson.A{total, 0}}
+
+	return bson.M{"$add": bson.A{
+		bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "COMPLETED"}}, bson.M{"$max": bson.A{progress, mediaTotal}}, progress}},
+		bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$repeat", 0}}, mediaTotal}},
+	}}
+}
+
+func (s *MongoStore) GetUserMediaStats(ctx context.Context, userID snowflake.ID, mediaType string) (*structs.UserMediaStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+
+	scored := bson.M{"$gte": bson.A{"$score", 0}}
+	group := func(key interface{}, fields bson.M) bson.D {
+		stage := bson.M{
+			"_id":       key,
+			"count":     bson.M{"$sum": 1},
+			"scored":    bson.M{"$sum": bson.M{"$cond": bson.A{scored, 1, 0}}},
+			"score_sum": bson.M{"$sum": bson.M{"$cond": bson.A{scored, "$score", 0}}},
+		}
+		for field, value := range fields {
+			stage[field] = value
+		}
+		return bson.D{{Key: "$group", Value: stage}}
+	}
+
+	total := "$media.episodes"
+	if mediaType == "MANGA" {
+		total = "$media.chapters"
+	}
+
+	progress := mongoEntryProgress(total)
+	minutes := bson.M{"$multiply": bson.A{progress, bson.M{"$ifNull": bson.A{"$media.duration", 0}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "media_type": mediaType}}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "media_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+		{{Key: "$facet", Value: bson.M{
+			"overall": bson.A{
+				group(nil, bson.M{"progress": bson.M{"$sum": progress}, "minutes": bson.M{"$sum": minutes}}),
+			},
+			"statuses": bson.A{group("$status", nil)},
+			"scores": bson.A{
+				bson.M{"$match": bson.M{"score": bson.M{"$gte": 0}}},
+				group(bson.M{"$toString": "$score"}, nil),
+			},
+			"genres": bson.A{
+				bson.M{"$unwind": "$media.genres"},
+				group("$media.genres", nil),
+			},
+			"tags": bson.A{
+				bson.M{"$unwind": "$media.tags"},
+				bson.M{"$match": bson.M{"media.tags.rank": bson.M{"$gte": MinStatsTagRank}}},
+				group("$media.tags.name", nil),
+			},
+			"formats": bson.A{
+				bson.M{"$match": bson.M{"media.format": bson.M{"$nin": bson.A{nil, ""}}}},
+				group("$media.format", nil),
+			},
+			"release_years": bson.A{
+				bson.M{"$match": bson.M{"media.start_date.year": bson.M{"$gt": 0}}},
+				group(bson.M{"$toString": "$media.start_date.year"}, nil),
+			},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Overall []struct {
+			structs.StatsGroup `bson:",inline"`
+			Progress           int `bson:"progress"`
+			Minutes            int `bson:"minutes"`
+		} `bson:"overall"`
+		Statuses     []structs.StatsGroup `bson:"statuses"`
+		Scores       []structs.StatsGroup `bson:"scores"`
+		Genres       []structs.StatsGroup `bson:"genres"`
+		Tags         []structs.StatsGroup `bson:"tags"`
+		Formats      []structs.StatsGroup `bson:"formats"`
+		ReleaseYears []structs.StatsGroup `bson:"release_years"`
+	}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &structs.UserMediaStats{MediaType: mediaType}
+
+	// $facet always gives one document, its overall group is missing for empty lists
+	if len(results) == 0 {
+		return stats, nil
+	}
+
+	result := results[0]
+	if len(result.Overall) > 0 {
+		stats.Overall = result.Overall[0].StatsGroup
+		stats.Progress = result.Overall[0].Progress
+		stats.Minutes = result.Overall[0].Minutes
+	}
+	stats.Statuses = result.Statuses
+	stats.Scores = result.Scores
+	stats.Genres = result.Genres
+	stats.Tags = result.Tags
+	stats.Formats = result.Formats
+	stats.ReleaseYears = result.ReleaseYears
+
+	return stats, nil
+}
+
+func (s *MongoStore) DeleteUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID, "user_id": userID})
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetUserMediaLists(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, listIDs []primitive.ObjectID) (*structs.UserMedia, error) {
+	update := bson.M{"$set": bson.M{"lists": listIDs, "updated_at": time.Now()}}
+	if len(listIDs) == 0 {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"lists": ""}}
+	}
+
+	return updateUserMedia(ctx, userID, objectID, update)
+}
+
+func (s *MongoStore) SetUserMediaTags(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, tags []string) (*structs.UserMedia, error) {
+	update := bson.M{"$set": bson.M{"tags": tags, "updated_at": time.Now()}}
+	if len(tags) == 0 {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"tags": ""}}
+	}
+
+	return updateUserMedia(ctx, userID, objectID, update)
+}
+
+// updateUserMedia applies update to one of the user's list entries and returns the result.
+func updateUserMedia(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, update interface{}) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+	options := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result structs.UserMedia
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID, "user_id": userID}, update, options).Decode(&result)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &result, nil
+}
+
+func (s *MongoStore) GetUserLists(ctx context.Context, userID snowflake.ID, mediaType string) ([]structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_lists")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID, "media_type": mediaType}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var lists []structs.UserList
+	err = cursor.All(ctx, &lists)
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (s *MongoStore) GetUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) (*structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_lists")
+
+	var list structs.UserList
+	err := collection.FindOne(ctx, bson.M{"_id": listID, "user_id": userID}).Decode(&list)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &list, nil
+}
+
+func (s *MongoStore) CreateUserList(ctx context.Context, userList *structs.UserList) (*structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_lists")
+
+	list := *userList
+	list.ID = primitive.NewObjectID()
+	list.CreatedAt = time.Now()
+
+	// names are unique per user and media type, ignoring case (see migration 10)
+	_, err := collection.InsertOne(ctx, list)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (s *MongoStore) RenameUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, name string) (*structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_lists")
+	options := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var list structs.UserList
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": listID, "user_id": userID}, bson.M{"$set": bson.M{"name": name}}, options).Decode(&list)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &list, nil
+}
+
+func (s *MongoStore) DeleteUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	result, err := GetCollection("user_lists").DeleteOne(ctx, bson.M{"_id": listID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	// entries left pointing at the list if this fails are harmless, lists are
+	// always looked up before their ids are used
+	_, err = GetCollection("user_media").UpdateMany(ctx,
+		bson.M{"user_id": userID, "lists": listID},
+		bson.M{"$pull": bson.M{"lists": listID}},
+	)
+	return err
+}
+
+func (s *MongoStore) CountUserMediaByList(ctx context.Context, userID snowflake.ID, mediaType string) (map[primitive.ObjectID]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_media")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "media_type": mediaType, "lists.0": bson.M{"$exists": true}}}},
+		{{Key: "$unwind", Value: "$lists"}},
+		{{Key: "$group", Value: bson.M{"_id": "$lists", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		ListID primitive.ObjectID `bson:"_id"`
+		Count  int                `bson:"count"`
+	}
+	err = cursor.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[primitive.ObjectID]int{}
+	for _, group := range groups {
+		counts[group.ListID] = group.Count
+	}
+
+	return counts, nil
+}
+
+func (s *MongoStore) GetUserListPage(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, view listview.View, page int) (*structs.UserMediaPage, error) {
+	return mongoUserMediaPage(ctx, bson.M{"user_id": userID, "lists": listID}, view, page)
+}
+
+func (s *MongoStore) GetUserFavourites(ctx context.Context, userID snowflake.ID, favouriteType string) ([]structs.FavouriteEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("favourites")
+
+	// only media favourites have a media_id, the lookup leaves the others alone
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "type": favouriteType}}},
+		{{Key: "$sort", Value: bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "media_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var favourites []structs.FavouriteEntry
+	err = cursor.All(ctx, &favourites)
+	if err != nil {
+		return nil, err
+	}
+
+	return favourites, nil
+}
+
+func (s *MongoStore) GetUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) (*structs.Favourite, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("favourites")
+
+	var favourite structs.Favourite
+	err := collection.FindOne(ctx, bson.M{"user_id": userID, "type": favouriteType, "id_anilist": idAnilist}).Decode(&favourite)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &favourite, nil
+}
+
+func (s *MongoStore) AddUserFavourite(ctx context.Context, favourite *structs.Favourite) (*structs.Favourite, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("favourites")
+
+	added := *favourite
+	added.ID = primitive.NewObjectID()
+	added.CreatedAt = time.Now()
+
+	// a user can favourite something only once (see migration 11)
+	_, err := collection.InsertOne(ctx, added)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &added, nil
+}
+
+func (s *MongoStore) DeleteUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("favourites")
+
+	result, err := collection.DeleteOne(ctx, bson.M{"user_id": userID, "type": favouriteType, "id_anilist": idAnilist})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetUserFavouritePositions(ctx context.Context, userID snowflake.ID, favouriteType string, favouriteIDs []primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("favourites")
+
+	models := make([]mongo.WriteModel, len(favouriteIDs))
+	for i, favouriteID := range favouriteIDs {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": favouriteID, "user_id": userID, "type": favouriteType}).
+			SetUpdate(bson.M{"$set": bson.M{"position": i}})
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) GetUserSettings(ctx context.Context, userID snowflake.ID) (*structs.UserSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_settings")
+
+	var result structs.UserSettings
+	err := collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&result)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &result, nil
+}
+
+func (s *MongoStore) SetUserScoreFormat(ctx context.Context, userID snowflake.ID, format score.Format) (*structs.UserSettings, error) {
+	return mongoSetUserSetting(ctx, userID, "score_format", format)
+}
+
+func (s *MongoStore) SetUserListPrivacy(ctx context.Context, userID snowflake.ID, privacy structs.ListPrivacy) (*structs.UserSettings, error) {
+	return mongoSetUserSetting(ctx, userID, "list_privacy", privacy)
+}
+
+// mongoSetUserSetting changes one setting of a user, creating their settings when
+// they have none yet.
+func mongoSetUserSetting(ctx context.Context, userID snowflake.ID, field string, value interface{}) (*structs.UserSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	collection := GetCollection("user_settings")
+
+	update := bson.M{"$set": bson.M{field: value, "updated_at": time.Now()}}
+
+	var result structs.UserSettings
+	err := upsertOne(ctx, collection, bson.M{"_id": userID}, update, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *MongoStore) SaveGuildMember(ctx context.Context, member *structs.GuildMember) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	_, err := GetCollection("guild_members").UpdateOne(ctx,
+		bson.M{"guild_id": member.GuildID, "user_id": member.UserID},
+		bson.M{"$set": bson.M{"seen_at": member.SeenAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoStore) DeleteGuildMember(ctx context.Context, guildID snowflake.ID, userID snowflake.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	_, err := GetCollection("guild_members").DeleteOne(ctx, bson.M{"guild_id": guildID, "user_id": userID})
+	return err
+}
+
+func (s *MongoStore) DeleteGuildMembers(ctx context.Context, guildID snowflake.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	_, err := GetCollection("guild_members").DeleteMany(ctx, bson.M{"guild_id": guildID})
+	return err
+}
+
+func (s *MongoStore) GetGuildMembersSeenBefore(ctx context.Context, guildID snowflake.ID, before time.Time, limit int) ([]snowflake.ID, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seen_at", Value: 1}, {Key: "user_id", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"_id": 0, "user_id": 1})
+
+	cursor, err := GetCollection("guild_members").Find(ctx, bson.M{"guild_id": guildID, "seen_at": bson.M{"$lt": before}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []structs.GuildMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]snowflake.ID, len(members))
+	for i, member := range members {
+		userIDs[i] = member.UserID
+	}
+	return userIDs, nil
+}
+
+// mongoGuildUserIDs returns the recorded members of a guild who don't keep their lists private.
+func mongoGuildUserIDs(ctx context.Context, guildID snowflake.ID) ([]snowflake.ID, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"guild_id": guildID}}},
+		{{Key: "$lookup", Value: bson.M{"from": "user_settings", "localField": "user_id", "foreignField": "_id", "as": "settings"}}},
+		{{Key: "$match", Value: bson.M{"settings.list_privacy": bson.M{"$ne": structs.ListPrivate}}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "user_id": 1}}},
+	}
+
+	cursor, err := GetCollection("guild_members").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []structs.GuildMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]snowflake.ID, len(members))
+	for i, member := range members {
+		userIDs[i] = member.UserID
+	}
+	return userIDs, nil
+}
+
+func (s *MongoStore) GetGuildLeaderboard(ctx context.Context, guildID snowflake.ID, board structs.Leaderboard, since time.Time, limit int) ([]structs.LeaderboardEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	userIDs, err := mongoGuildUserIDs(ctx, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	match := bson.M{"user_id": bson.M{"$in": userIDs}}
+	value := bson.M{"$sum": 1}
+	switch board {
+	case structs.LeaderboardAnimeCompleted:
+		match["media_type"], match["status"] = "ANIME", "COMPLETED"
+	case structs.LeaderboardMangaCompleted:
+		match["media_type"], match["status"] = "MANGA", "COMPLETED"
+	case structs.LeaderboardEpisodes:
+		match["media_type"], value = "ANIME", bson.M{"$sum": mongoEntryProgress("$media.episodes")}
+	case structs.LeaderboardChapters:
+		match["media_type"], value = "MANGA", bson.M{"$sum": mongoEntryProgress("$media.chapters")}
+	case structs.LeaderboardActive:
+		match["updated_at"] = bson.M{"$gte": since}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "media_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "value": value}}},
+		{{Key: "$match", Value: bson.M{"value": bson.M{"$gt": 0}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "value", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := GetCollection("user_media").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []structs.LeaderboardEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *MongoStore) GetGuildTopMedia(ctx context.Context, guildID snowflake.ID, mediaType string, minRatings int, limit int) ([]structs.GuildMediaScore, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	userIDs, err := mongoGuildUserIDs(ctx, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": bson.M{"$in": userIDs}, "media_type": mediaType, "score": bson.M{"$gte": 0}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$media_id", "ratings": bson.M{"$sum": 1}, "score_sum": bson.M{"$sum": "$score"}}}},
+		{{Key: "$match", Value: bson.M{"ratings": bson.M{"$gte": minRatings}}}},
+		{{Key: "$set", Value: bson.M{"mean": bson.M{"$divide": bson.A{"$score_sum", "$ratings"}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "mean", Value: -1}, {Key: "ratings", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "_id", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}}},
+	}
+
+	cursor, err := GetCollection("user_media").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []structs.GuildMediaScore{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
 }
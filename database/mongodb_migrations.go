@@ -0,0 +1,378 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context) error
+}
+
+// mongoMigrations run in version order, each once. A migration may be interrupted
+// half way and run again, so every step has to be safe to repeat.
+var mongoMigrations = []mongoMigration{
+	{1, "media_unique_indexes", func(ctx context.Context) error {
+		collection := GetCollection("media")
+
+		// SaveMedia could add a media again under another hash; keep the newest copy and
+		// point everything that used the others at it
+		for _, key := range []string{"media_hash", "id_anilist"} {
+			err := removeMongoDuplicates(ctx, collection, []string{key}, bson.D{{Key: "_id", Value: -1}}, repointMongoMedia)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := ensureUniqueIndex(ctx, collection, "media_hash"); err != nil {
+			return err
+		}
+		return ensureUniqueIndex(ctx, collection, "id_anilist")
+	}},
+	{2, "media_text_index", func(ctx context.Context) error {
+		return ensureTextIndex(ctx, GetCollection("media"), "media_text", mediaTextIndexWeights)
+	}},
+	{3, "user_media_list_index", func(ctx context.Context) error {
+		// serves the status counts and the list pages, which are sorted by _id
+		keys := bson.D{{Key: "user_id", Value: 1}, {Key: "media_type", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: 1}}
+		return ensureIndex(ctx, GetCollection("user_media"), keys, options.Index())
+	}},
+	{4, "search_queries_lookup_index", func(ctx context.Context) error {
+		keys := bson.D{{Key: "search_text", Value: 1}, {Key: "media_type", Value: 1}}
+		return ensureIndex(ctx, GetCollection("search_queries"), keys, options.Index())
+	}},
+	{5, "user_media_unset_scores", func(ctx context.Context) error {
+		// unrated entries are stored with a score of -1, older ones may have 0 or nothing
+		filter := bson.M{"$or": bson.A{bson.M{"score": bson.M{"$exists": false}}, bson.M{"score": 0}}}
+		_, err := GetCollection("user_media").UpdateMany(ctx, filter, bson.M{"$set": bson.M{"score": -1}})
+		return err
+	}},
+	{6, "user_media_unique_entry", func(ctx context.Context) error {
+		collection := GetCollection("user_media")
+
+		// keep the most recently updated copy of entries added twice
+		err := removeMongoDuplicates(ctx, collection, []string{"user_id", "media_id"}, bson.D{{Key: "updated_at", Value: -1}}, nil)
+		if err != nil {
+			return err
+		}
+
+		keys := bson.D{{Key: "user_id", Value: 1}, {Key: "media_id", Value: 1}}
+		return ensureIndex(ctx, collection, keys, options.Index().SetUnique(true))
+	}},
+	{7, "search_queries_unique_lookup", func(ctx context.Context) error {
+		collection := GetCollection("search_queries")
+
+		// keep the oldest copy, the one most messages link to
+		err := removeMongoDuplicates(ctx, collection, []string{"search_text", "media_type"}, bson.D{{Key: "_id", Value: 1}}, nil)
+		if err != nil {
+			return err
+		}
+
+		// replaces the non-unique index on the same keys from migration 4
+		if err := dropMongoIndex(ctx, collection, "search_text_1_media_type_1"); err != nil {
+			return err
+		}
+
+		keys := bson.D{{Key: "search_text", Value: 1}, {Key: "media_type", Value: 1}}
+		return ensureIndex(ctx, collection, keys, options.Index().SetUnique(true))
+	}},
+	{8, "search_queries_snapshots", func(ctx context.Context) error {
+		collection := GetCollection("search_queries")
+
+		// every search is stored on its own now, with its results
+		if err := dropMongoIndex(ctx, collection, "search_text_1_media_type_1"); err != nil {
+			return err
+		}
+
+		// searches saved before results were kept can't be paged anymore
+		_, err := collection.DeleteMany(ctx, bson.M{"result_ids": bson.M{"$exists": false}})
+		if err != nil {
+			return err
+		}
+
+		keys := bson.D{{Key: "expires_at", Value: 1}}
+		return ensureIndex(ctx, collection, keys, options.Index().SetExpireAfterSeconds(0))
+	}},
+	{9, "user_media_100_point_scores", func(ctx context.Context) error {
+		// scores were out of 10 and are stored out of 100 now; score_scale marks the
+		// entries already out of 100 (SaveUserMedia sets it on new ones), so running
+		// this again doesn't multiply them twice
+		filter := bson.M{"score_scale": bson.M{"$exists": false}}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"score":       bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$score", 0}}, bson.M{"$multiply": bson.A{"$score", 10}}, "$score"}},
+			"score_scale": 100,
+		}}}}
+		_, err := GetCollection("user_media").UpdateMany(ctx, filter, update)
+		return err
+	}},
+	{10, "user_lists_indexes", func(ctx context.Context) error {
+		// list names are unique per user and media type, ignoring case
+		keys := bson.D{{Key: "user_id", Value: 1}, {Key: "media_type", Value: 1}, {Key: "name", Value: 1}}
+		caseInsensitive := &options.Collation{Locale: "en", Strength: 2}
+		if err := ensureIndex(ctx, GetCollection("user_lists"), keys, options.Index().SetUnique(true).SetCollation(caseInsensitive)); err != nil {
+			return err
+		}
+
+		// serves the custom list pages, which are sorted by _id
+		keys = bson.D{{Key: "user_id", Value: 1}, {Key: "lists", Value: 1}, {Key: "_id", Value: 1}}
+		return ensureIndex(ctx, GetCollection("user_media"), keys, options.Index())
+	}},
+	{11, "favourites_indexes", func(ctx context.Context) error {
+		// something can be a favourite of a user only once
+		keys := bson.D{{Key: "user_id", Value: 1}, {Key: "type", Value: 1}, {Key: "id_anilist", Value: 1}}
+		if err := ensureIndex(ctx, GetCollection("favourites"), keys, options.Index().SetUnique(true)); err != nil {
+			return err
+		}
+
+		keys = bson.D{{Key: "user_id", Value: 1}, {Key: "type", Value: 1}, {Key: "position", Value: 1}}
+		return ensureIndex(ctx, GetCollection("favourites"), keys, options.Index())
+	}},
+	{12, "guild_members_indexes", func(ctx context.Context) error {
+		// a user is recorded once per guild
+		keys := bson.D{{Key: "guild_id", Value: 1}, {Key: "user_id", Value: 1}}
+		return ensureIndex(ctx, GetCollection("guild_members"), keys, options.Index().SetUnique(true))
+	}},
+}
+
+// Returned by the server when dropping an index that doesn't exist, or from a collection that doesn't.
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
+// removeMongoDuplicates deletes all but the first document (in sortOrder) of every
+// group of documents sharing the same values for keys. When merge isn't nil, it is
+// called with the kept and the removed documents of each group before they are deleted.
+func removeMongoDuplicates(ctx context.Context, collection *mongo.Collection, keys []string, sortOrder bson.D, merge func(ctx context.Context, kept primitive.ObjectID, removed []primitive.ObjectID) error) error {
+	groupID := bson.M{}
+	for _, key := range keys {
+		groupID[key] = "$" + key
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: sortOrder}},
+		{{Key: "$group", Value: bson.M{"_id": groupID, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if merge != nil {
+			if err := merge(ctx, group.IDs[0], group.IDs[1:]); err != nil {
+				return err
+			}
+		}
+
+		result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+		if err != nil {
+			return err
+		}
+		log.Printf("Removed %d duplicate documents from %s", result.DeletedCount, collection.Name())
+	}
+
+	return nil
+}
+
+// repointMongoMedia makes the list entries, favourites and search results that use
+// the removed media documents use the kept one instead. Entries of a user that now point
+// at the same media are merged by migration 6.
+func repointMongoMedia(ctx context.Context, kept primitive.ObjectID, removed []primitive.ObjectID) error {
+	log.Printf("Merging media %v into %s", removed, kept.Hex())
+
+	for _, name := range []string{"user_media", "favourites"} {
+		_, err := GetCollection(name).UpdateMany(ctx,
+			bson.M{"media_id": bson.M{"$in": removed}},
+			bson.M{"$set": bson.M{"media_id": kept}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := GetCollection("search_queries").UpdateMany(ctx,
+		bson.M{"result_ids": bson.M{"$in": removed}},
+		bson.M{"$set": bson.M{"result_ids.$[removed]": kept}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"removed": bson.M{"$in": removed}}}}),
+	)
+	return err
+}
+
+func dropMongoIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Code == indexNotFoundCode || commandErr.Code == namespaceNotFoundCode) {
+		return nil
+	}
+
+	return err
+}
+
+// The lock lives in schema_migrations next to the applied versions, under its own _id.
+const mongoMigrationLockID = "lock"
+
+type mongoMigrationRecord struct {
+	ID        int       `bson:"_id"`
+	Version   int       `bson:"version"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+func (s *MongoStore) MigrateUp(ctx context.Context) ([]MigrationStatus, error) {
+	collection := GetCollection("schema_migrations")
+	owner := primitive.NewObjectID().Hex()
+
+	locked, err := acquireMongoMigrationLock(ctx, collection, owner)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrMigrationLocked
+	}
+	defer releaseMongoMigrationLock(collection, owner)
+
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	defer stopRenewing()
+	go renewMongoMigrationLock(renewCtx, collection, owner)
+
+	statuses, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationStatus
+	for i, migration := range mongoMigrations {
+		if statuses[i].Applied() {
+			continue
+		}
+
+		log.Printf("Applying migration %d (%s)", migration.version, migration.name)
+
+		if err := migration.up(ctx); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", migration.version, migration.name, err)
+		}
+
+		record := mongoMigrationRecord{ID: migration.version, Version: migration.version, Name: migration.name, AppliedAt: time.Now()}
+		_, err := collection.InsertOne(ctx, record)
+		if err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: record.AppliedAt})
+	}
+
+	return applied, nil
+}
+
+func (s *MongoStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	cursor, err := GetCollection("schema_migrations").Find(ctx, bson.M{"version": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []mongoMigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	appliedAt := map[int]time.Time{}
+	for _, record := range records {
+		appliedAt[record.Version] = record.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, len(mongoMigrations))
+	for i, migration := range mongoMigrations {
+		statuses[i] = MigrationStatus{Version: migration.version, Name: migration.name, AppliedAt: appliedAt[migration.version]}
+	}
+
+	return statuses, nil
+}
+
+// acquireMongoMigrationLock takes the lock when it is free or has expired. While
+// another owner holds it, the upsert collides with the existing lock document.
+func acquireMongoMigrationLock(ctx context.Context, collection *mongo.Collection, owner string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": mongoMigrationLockID, "expires_at": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"owner": owner, "expires_at": now.Add(migrationLockTTL)}},
+		options.Update().SetUpsert(true),
+	)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// renewMongoMigrationLock pushes back the expiry of a held lock every
+// migrationLockRenewal until ctx is done, so another instance doesn't take it over
+// while a long migration (ex, an index build) is still running.
+func renewMongoMigrationLock(ctx context.Context, collection *mongo.Collection, owner string) {
+	ticker := time.NewTicker(migrationLockRenewal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		updateCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+		result, err := collection.UpdateOne(updateCtx,
+			bson.M{"_id": mongoMigrationLockID, "owner": owner},
+			bson.M{"$set": bson.M{"expires_at": time.Now().Add(migrationLockTTL)}},
+		)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to renew the migration lock: %v", err)
+			}
+			continue
+		}
+		if result.MatchedCount == 0 {
+			log.Printf("The migration lock expired before it could be renewed")
+			return
+		}
+	}
+}
+
+func releaseMongoMigrationLock(collection *mongo.Collection, owner string) {
+	// the caller's context may already be done, the lock is released regardless
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": mongoMigrationLockID, "owner": owner})
+	if err != nil {
+		log.Printf("Failed to release the migration lock: %v", err)
+	}
+}
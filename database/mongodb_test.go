@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/config"
+	"ipmanlk/saika/structs"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The MongoDB tests need a server to talk to, they are skipped unless MONGO_URI is set.
+// Everything is written to a throwaway database that is dropped afterwards.
+const mongoTestDatabase = "saika_test"
+
+// mongoTestMedia creates a media collection with the unique indexes of the migrations,
+// rejecting documents that don't match validator when it isn't nil.
+func mongoTestMedia(tb testing.TB, validator bson.M) *mongo.Collection {
+	tb.Helper()
+
+	if config.GetEnv("MONGO_URI", "") == "" {
+		tb.Skip("MONGO_URI is not set")
+	}
+
+	database = mongoTestDatabase
+	ctx := context.Background()
+
+	db := GetMongoClient().Database(database)
+	if err := db.Drop(ctx); err != nil {
+		tb.Fatalf("dropping the test database: %v", err)
+	}
+	tb.Cleanup(func() {
+		db.Drop(context.Background())
+	})
+
+	opts := options.CreateCollection()
+	if validator != nil {
+		opts.SetValidator(validator)
+	}
+	if err := db.CreateCollection(ctx, "media", opts); err != nil {
+		tb.Fatalf("creating the media collection: %v", err)
+	}
+
+	collection := db.Collection("media")
+	for _, field := range []string{"media_hash", "id_anilist"} {
+		if err := ensureUniqueIndex(ctx, collection, field); err != nil {
+			tb.Fatalf("creating the %s index: %v", field, err)
+		}
+	}
+
+	return collection
+}
+
+func testMedia(count int, title string) []structs.AnilistMedia {
+	media := make([]structs.AnilistMedia, count)
+	for i := range media {
+		media[i] = structs.AnilistMedia{
+			IdAnilist: i + 1,
+			Type:      "ANIME",
+			Title:     structs.AnilistMediaTitle{Romaji: fmt.Sprintf("%s %d", title, i+1)},
+		}
+	}
+	return media
+}
+
+// saveMediaOneByOne is how SaveMedia used to work, a lookup and a write per media.
+// It is kept to compare against the bulk write.
+func saveMediaOneByOne(ctx context.Context, media []structs.AnilistMedia) error {
+	collection := GetCollection("media")
+	for _, media := range media {
+		media.MediaHash = media.Hash()
+
+		var result structs.AnilistMedia
+		err := collection.FindOne(ctx, bson.M{"id_anilist": media.IdAnilist}).Decode(&result)
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				return err
+			}
+			if _, err := collection.InsertOne(ctx, media); err != nil {
+				return err
+			}
+		} else if result.Hash() != media.MediaHash {
+			if _, err := collection.UpdateOne(ctx, bson.M{"id_anilist": media.IdAnilist}, bson.M{"$set": media}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func BenchmarkSaveMedia(b *testing.B) {
+	const count = 50
+
+	saves := []struct {
+		name string
+		save func(ctx context.Context, media []structs.AnilistMedia) error
+	}{
+		{"OneByOne", saveMediaOneByOne},
+		{"Bulk", (&MongoStore{}).SaveMedia},
+	}
+
+	for _, save := range saves {
+		b.Run(save.name, func(b *testing.B) {
+			mongoTestMedia(b, nil)
+			ctx := context.Background()
+
+			// every other round changes the titles, so both inserts, updates and
+			// unchanged media are measured
+			rounds := [][]structs.AnilistMedia{testMedia(count, "Title"), testMedia(count, "Renamed")}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := save.save(ctx, rounds[i%len(rounds)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveMediaPartialFailure(t *testing.T) {
+	const rejected = 3
+
+	// the validator makes the server refuse one of the media
+	collection := mongoTestMedia(t, bson.M{"id_anilist": bson.M{"$ne": rejected}})
+	ctx := context.Background()
+	store := &MongoStore{}
+	media := testMedia(5, "Title")
+
+	err := store.SaveMedia(ctx, media)
+
+	var saveErr *SaveMediaError
+	if !errors.As(err, &saveErr) {
+		t.Fatalf("SaveMedia() error = %v, want a *SaveMediaError", err)
+	}
+	if len(saveErr.Failures) != 1 || saveErr.Failures[rejected] == nil {
+		t.Fatalf("Failures = %v, want only %d", saveErr.Failures, rejected)
+	}
+
+	saved, err := collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != int64(len(media)-1) {
+		t.Errorf("saved %d media, want %d", saved, len(media)-1)
+	}
+
+	// saving unchanged media runs into the unique id_anilist index, those duplicate
+	// key errors are not failures
+	err = store.SaveMedia(ctx, media)
+	if !errors.As(err, &saveErr) {
+		t.Fatalf("SaveMedia() again error = %v, want a *SaveMediaError", err)
+	}
+	if len(saveErr.Failures) != 1 || saveErr.Failures[rejected] == nil {
+		t.Errorf("Failures on the second save = %v, want only %d", saveErr.Failures, rejected)
+	}
+
+	if err := store.SaveMedia(ctx, media[:rejected-1]); err != nil {
+		t.Errorf("SaveMedia() of unchanged media error = %v, want nil", err)
+	}
+}
+
+func TestMongoMediaUniqueIndexesMigration(t *testing.T) {
+	if config.GetEnv("MONGO_URI", "") == "" {
+		t.Skip("MONGO_URI is not set")
+	}
+
+	database = mongoTestDatabase
+	ctx := context.Background()
+
+	db := GetMongoClient().Database(database)
+	if err := db.Drop(ctx); err != nil {
+		t.Fatalf("dropping the test database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+	})
+
+	// the same media saved twice under different hashes, the second copy being newer
+	old, current, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	_, err := db.Collection("media").InsertMany(ctx, []interface{}{
+		bson.M{"_id": old, "id_anilist": 1, "media_hash": "old"},
+		bson.M{"_id": current, "id_anilist": 1, "media_hash": "current"},
+		bson.M{"_id": other, "id_anilist": 2, "media_hash": "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := primitive.NewObjectID()
+	if _, err := db.Collection("user_media").InsertOne(ctx, bson.M{"_id": entry, "user_id": 1, "media_id": old}); err != nil {
+		t.Fatal(err)
+	}
+	query := primitive.NewObjectID()
+	if _, err := db.Collection("search_queries").InsertOne(ctx, bson.M{"_id": query, "result_ids": bson.A{other, old}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mongoMigrations[0].up(ctx); err != nil {
+		t.Fatalf("migration 1 error = %v", err)
+	}
+
+	count, err := db.Collection("media").CountDocuments(ctx, bson.M{"id_anilist": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d copies of the media are left, want 1", count)
+	}
+
+	var userMedia structs.UserMedia
+	if err := db.Collection("user_media").FindOne(ctx, bson.M{"_id": entry}).Decode(&userMedia); err != nil {
+		t.Fatal(err)
+	}
+	if userMedia.MediaID != current {
+		t.Errorf("the entry points at %s, want the kept media %s", userMedia.MediaID.Hex(), current.Hex())
+	}
+
+	var searchQuery structs.AnilistSearchQuery
+	if err := db.Collection("search_queries").FindOne(ctx, bson.M{"_id": query}).Decode(&searchQuery); err != nil {
+		t.Fatal(err)
+	}
+	if len(searchQuery.ResultIDs) != 2 || searchQuery.ResultIDs[0] != other || searchQuery.ResultIDs[1] != current {
+		t.Errorf("search results = %v, want [%s %s]", searchQuery.ResultIDs, other.Hex(), current.Hex())
+	}
+
+	// and adding the media again is refused
+	_, err = db.Collection("media").InsertOne(ctx, bson.M{"id_anilist": 1, "media_hash": "again"})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("inserting a duplicate after the migration error = %v, want a duplicate key error", err)
+	}
+}
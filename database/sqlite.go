@@ -0,0 +1,1837 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/listview"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/search"
+	"ipmanlk/saika/structs"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStore keeps everything in a single SQLite file. Every row carries the
+// full document as relaxed extended JSON (the same field names used in Mongo),
+// next to the handful of columns the queries filter on.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// sqliteSchema is the schema created by the first migration, see sqlite_migrations.go.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS media (
+	id         TEXT PRIMARY KEY,
+	id_anilist INTEGER NOT NULL UNIQUE,
+	type       TEXT NOT NULL,
+	is_adult   INTEGER NOT NULL,
+	media_hash TEXT NOT NULL UNIQUE,
+	document   TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_media (
+	id         TEXT PRIMARY KEY,
+	user_id    INTEGER NOT NULL,
+	media_id   TEXT NOT NULL,
+	media_type TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	document   TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_media_user_type_status ON user_media (user_id, media_type, status);
+
+CREATE TABLE IF NOT EXISTS search_queries (
+	id          TEXT PRIMARY KEY,
+	search_text TEXT NOT NULL,
+	media_type  TEXT NOT NULL,
+	document    TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS search_queries_text_type ON search_queries (search_text, media_type);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS media_fts USING fts5(
+	id UNINDEXED,
+	title_english,
+	title_romaji,
+	title_native,
+	synonyms,
+	genres,
+	tags,
+	description,
+	tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS media_fts_insert AFTER INSERT ON media BEGIN
+	INSERT INTO media_fts SELECT ` + mediaFTSValues + `;
+END;
+
+CREATE TRIGGER IF NOT EXISTS media_fts_update AFTER UPDATE ON media BEGIN
+	DELETE FROM media_fts WHERE id = old.id;
+	INSERT INTO media_fts SELECT ` + mediaFTSValues + `;
+END;
+
+CREATE TRIGGER IF NOT EXISTS media_fts_delete AFTER DELETE ON media BEGIN
+	DELETE FROM media_fts WHERE id = old.id;
+END;
+`
+
+// mediaFTSValues builds a media_fts row from the "new" row of a media trigger.
+const mediaFTSValues = `
+	new.id,
+	json_extract(new.document, '$.title.english'),
+	json_extract(new.document, '$.title.romaji'),
+	json_extract(new.document, '$.title.native'),
+	(SELECT group_concat(value, ' ') FROM json_each(new.document, '$.synonyms')),
+	(SELECT group_concat(value, ' ') FROM json_each(new.document, '$.genres')),
+	(SELECT group_concat(json_extract(value, '$.name'), ' ') FROM json_each(new.document, '$.tags')),
+	json_extract(new.document, '$.description')`
+
+// mediaFTSRank weighs the media_fts columns like the mongo text index: titles count the most.
+// Titles containing the whole search text (@text) are boosted above everything else.
+const mediaFTSRank = `
+	(
+		instr(lower(ifnull(json_extract(media.document, '$.title.english'), '')), lower(@text)) > 0
+		OR instr(lower(ifnull(json_extract(media.document, '$.title.romaji'), '')), lower(@text)) > 0
+		OR instr(lower(ifnull(json_extract(media.document, '$.title.native'), '')), lower(@text)) > 0
+	) DESC,
+	bm25(media_fts, 0, 10, 10, 10, 6, 3, 3, 1)`
+
+var sqliteRegexCache sync.Map
+
+func init() {
+	// SQLite has no built-in REGEXP implementation; this one mirrors Mongo's
+	// case-insensitive $regex so both stores match the same search text.
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		pattern, _ := args[0].(string)
+		value, _ := args[1].(string)
+
+		cached, ok := sqliteRegexCache.Load(pattern)
+		if !ok {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, err
+			}
+			cached, _ = sqliteRegexCache.LoadOrStore(pattern, re)
+		}
+
+		return cached.(*regexp.Regexp).MatchString(value), nil
+	})
+}
+
+// OpenSQLite opens (creating if needed) the SQLite database at path.
+// The tables are created by MigrateUp.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, err
+	}
+
+	// a single connection serialises writers, which is plenty for small deployments
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteMigrationsTable); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func marshalDocument(document interface{}) (string, error) {
+	bytes, err := bson.MarshalExtJSON(document, false, false)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+func unmarshalDocument(document string, result interface{}) error {
+	return bson.UnmarshalExtJSON([]byte(document), false, result)
+}
+
+func sqliteTranslateError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func sqliteIsUniqueError(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func scanMedia(rows *sql.Rows) ([]structs.AnilistMedia, error) {
+	defer rows.Close()
+
+	var results []structs.AnilistMedia
+	for rows.Next() {
+		var document string
+		if err := rows.Scan(&document); err != nil {
+			return nil, err
+		}
+
+		var media structs.AnilistMedia
+		if err := unmarshalDocument(document, &media); err != nil {
+			return nil, err
+		}
+		results = append(results, media)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *SQLiteStore) getMedia(ctx context.Context, where string, arg interface{}) (*structs.AnilistMedia, error) {
+	var document string
+	err := s.db.QueryRowContext(ctx, "SELECT document FROM media WHERE "+where, arg).Scan(&document)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var result structs.AnilistMedia
+	if err := unmarshalDocument(document, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ImportMedia writes a media document as-is, keeping its ObjectID.
+func (s *SQLiteStore) ImportMedia(ctx context.Context, media *structs.AnilistMedia) error {
+	document, err := marshalDocument(media)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO media (id, id_anilist, type, is_adult, media_hash, document) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			id_anilist = excluded.id_anilist,
+			type = excluded.type,
+			is_adult = excluded.is_adult,
+			media_hash = excluded.media_hash,
+			document = excluded.document`,
+		media.ID.Hex(), media.IdAnilist, media.Type, media.IsAdult, media.MediaHash, document,
+	)
+	return err
+}
+
+func (s *SQLiteStore) SaveMedia(ctx context.Context, media []structs.AnilistMedia) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// same rules as the mongo store: insert unknown media, replace media whose hash changed.
+	// An existing row keeps its id, including the copy inside the document.
+	statement, err := tx.PrepareContext(ctx, `
+		INSERT INTO media (id, id_anilist, type, is_adult, media_hash, document) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id_anilist) DO UPDATE SET
+			type = excluded.type,
+			is_adult = excluded.is_adult,
+			media_hash = excluded.media_hash,
+			document = json_set(excluded.document, '$._id."$oid"', media.id)
+		WHERE media.media_hash != excluded.media_hash`,
+	)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	failures := map[int]error{}
+	for _, media := range media {
+		media.ID = primitive.NewObjectID()
+		media.MediaHash = media.Hash()
+
+		document, err := marshalDocument(media)
+		if err == nil {
+			_, err = statement.ExecContext(ctx, media.ID.Hex(), media.IdAnilist, media.Type, media.IsAdult, media.MediaHash, document)
+		}
+
+		if err != nil {
+			failures[media.IdAnilist] = err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return &SaveMediaError{Failures: failures}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) GetMediaByIDAnilist(ctx context.Context, idAnilist int) (*structs.AnilistMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	return s.getMedia(ctx, "id_anilist = ?", idAnilist)
+}
+
+func (s *SQLiteStore) GetMediaByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	return s.getMedia(ctx, "id = ?", objectID.Hex())
+}
+
+// sqliteSearchFilters turns the non-text parts of a search into SQL conditions on the media table.
+func sqliteSearchFilters(query *search.Query, mediaType string, nsfw bool) (string, []interface{}) {
+	conditions := []string{"media.type = @type"}
+	args := []interface{}{sql.Named("type", mediaType)}
+
+	if !nsfw {
+		conditions = append(conditions, "media.is_adult = 0")
+	}
+
+	for i, genre := range query.Genres {
+		name := fmt.Sprintf("genre%d", i)
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(media.document, '$.genres') WHERE value = @"+name+")")
+		args = append(args, sql.Named(name, genre))
+	}
+
+	for i, tag := range query.Tags {
+		name := fmt.Sprintf("tag%d", i)
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(media.document, '$.tags') WHERE lower(json_extract(value, '$.name')) = lower(@"+name+"))")
+		args = append(args, sql.Named(name, tag))
+	}
+
+	if query.Year > 0 {
+		conditions = append(conditions, "json_extract(media.document, '$.start_date.year') = @year")
+		args = append(args, sql.Named("year", query.Year))
+	}
+
+	if query.Format != "" {
+		conditions = append(conditions, "json_extract(media.document, '$.format') = @format")
+		args = append(args, sql.Named("format", query.Format))
+	}
+
+	if query.ScoreGreater >= 0 {
+		conditions = append(conditions, "json_extract(media.document, '$.average_score') > @scoreGreater")
+		args = append(args, sql.Named("scoreGreater", query.ScoreGreater))
+	}
+
+	if query.ScoreLesser >= 0 {
+		conditions = append(conditions, "json_extract(media.document, '$.average_score') < @scoreLesser")
+		args = append(args, sql.Named("scoreLesser", query.ScoreLesser))
+	}
+
+	for i, exclude := range query.Excludes {
+		name := fmt.Sprintf("exclude%d", i)
+		conditions = append(conditions, `NOT (
+			ifnull(json_extract(media.document, '$.title.english'), '') REGEXP @`+name+`
+			OR ifnull(json_extract(media.document, '$.title.romaji'), '') REGEXP @`+name+`
+			OR ifnull(json_extract(media.document, '$.title.native'), '') REGEXP @`+name+`
+			OR ifnull(json_extract(media.document, '$.description'), '') REGEXP @`+name+`
+			OR EXISTS (SELECT 1 FROM json_each(media.document, '$.synonyms') WHERE value REGEXP @`+name+`)
+			OR EXISTS (SELECT 1 FROM json_each(media.document, '$.genres') WHERE value REGEXP @`+name+`)
+			OR EXISTS (SELECT 1 FROM json_each(media.document, '$.tags') WHERE json_extract(value, '$.name') REGEXP @`+name+`)
+		)`)
+		args = append(args, sql.Named(name, regexp.QuoteMeta(exclude)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// ftsSearch builds an FTS5 query: words match any (as prefixes), phrases must all match.
+// Every term is quoted so user input is never read as FTS5 syntax.
+func ftsSearch(query *search.Query) string {
+	var terms []string
+
+	if len(query.Words) > 0 {
+		words := make([]string, len(query.Words))
+		for i, word := range query.Words {
+			words[i] = `"` + word + `"*`
+		}
+		terms = append(terms, "("+strings.Join(words, " OR ")+")")
+	}
+
+	for _, phrase := range query.Phrases {
+		terms = append(terms, `"`+strings.ReplaceAll(phrase, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+func (s *SQLiteStore) SearchMedia(ctx context.Context, query *search.Query, mediaType string, nsfw bool) ([]structs.AnilistMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	filters, args := sqliteSearchFilters(query, mediaType, nsfw)
+
+	// Without any text there is nothing to rank by, show the best rated matches instead
+	if !query.HasText() {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT document FROM media WHERE `+filters+`
+			ORDER BY json_extract(document, '$.average_score') DESC LIMIT 20`,
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return scanMedia(rows)
+	}
+
+	args = append(args, sql.Named("text", query.Text()))
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT media.document FROM media_fts
+		JOIN media ON media.id = media_fts.id
+		WHERE media_fts MATCH @match AND `+filters+`
+		ORDER BY `+mediaFTSRank+`
+		LIMIT 20`,
+		append(args, sql.Named("match", ftsSearch(query)))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rankedMedia, err := scanMedia(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rankedMedia) >= 20 {
+		return rankedMedia, nil
+	}
+
+	rankedIDs := make([]string, len(rankedMedia))
+	for i, media := range rankedMedia {
+		rankedIDs[i] = media.ID.Hex()
+	}
+	rankedIDsJSON, _ := json.Marshal(rankedIDs)
+
+	// The full text index only matches whole words, so fill in the remaining slots with
+	// partial title matches (ex, "naru" for Naruto), excluding the ones already ranked.
+	// The search text is escaped, it is matched literally and case-insensitively.
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT document FROM media
+		WHERE `+filters+`
+		AND id NOT IN (SELECT value FROM json_each(@ranked))
+		AND (
+			json_extract(document, '$.title.english') REGEXP @titleRegex
+			OR json_extract(document, '$.title.romaji') REGEXP @titleRegex
+			OR json_extract(document, '$.title.native') REGEXP @titleRegex
+		)
+		ORDER BY rowid LIMIT @limit`,
+		append(args,
+			sql.Named("ranked", string(rankedIDsJSON)),
+			sql.Named("titleRegex", regexp.QuoteMeta(query.Text())),
+			sql.Named("limit", 20-len(rankedMedia)),
+		)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	titleMedia, err := scanMedia(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rankedMedia, titleMedia...), nil
+}
+
+// ImportSearchQuery writes a search query document as-is, keeping its ObjectID.
+func (s *SQLiteStore) ImportSearchQuery(ctx context.Context, query *structs.AnilistSearchQuery) error {
+	document, err := marshalDocument(query)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO search_queries (id, search_text, media_type, expires_at, document) VALUES (?, ?, ?, ?, ?)`,
+		query.ID.Hex(), query.SearchText, query.MediaType, query.ExpiresAt.Unix(), document,
+	)
+	return err
+}
+
+func (s *SQLiteStore) SaveSearchQuery(ctx context.Context, storeQuery *structs.AnilistSearchQuery) (*structs.AnilistSearchQuery, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	query := *storeQuery
+	query.ID = primitive.NewObjectID()
+	query.CreatedAt = time.Now()
+	query.ExpiresAt = query.CreatedAt.Add(SearchRetention)
+
+	if err := s.ImportSearchQuery(ctx, &query); err != nil {
+		return nil, err
+	}
+
+	return &query, nil
+}
+
+// DeleteExpiredSearchQueries is run by the janitor, SQLite has no TTL index.
+func (s *SQLiteStore) DeleteExpiredSearchQueries(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM search_queries WHERE expires_at <= ?`, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *SQLiteStore) GetSearchQueryByObjectID(ctx context.Context, objectID primitive.ObjectID) (*structs.AnilistSearchQuery, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	var document string
+	err := s.db.QueryRowContext(ctx, `SELECT document FROM search_queries WHERE id = ? AND expires_at > ?`, objectID.Hex(), time.Now().Unix()).Scan(&document)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var result structs.AnilistSearchQuery
+	if err := unmarshalDocument(document, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ImportUserMedia writes a user media document as-is, keeping its ObjectID.
+func (s *SQLiteStore) ImportUserMedia(ctx context.Context, userMedia *structs.UserMedia) error {
+	document, err := marshalDocument(userMedia)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO user_media (id, user_id, media_id, media_type, status, document) VALUES (?, ?, ?, ?, ?, ?)`,
+		userMedia.ID.Hex(), int64(userMedia.UserID), userMedia.MediaID.Hex(), userMedia.MediaType, userMedia.Status, document,
+	)
+	return err
+}
+
+func scanUserMedia(rows *sql.Rows) ([]structs.UserMedia, error) {
+	defer rows.Close()
+
+	var results []structs.UserMedia
+	for rows.Next() {
+		var document string
+		if err := rows.Scan(&document); err != nil {
+			return nil, err
+		}
+
+		var userMedia structs.UserMedia
+		if err := unmarshalDocument(document, &userMedia); err != nil {
+			return nil, err
+		}
+		results = append(results, userMedia)
+	}
+
+	return results, rows.Err()
+}
+
+// scanUserMediaEntries reads rows of (user_media.document, media.document), where
+// the media document is NULL if it has been removed.
+func scanUserMediaEntries(rows *sql.Rows) ([]structs.UserMediaEntry, error) {
+	defer rows.Close()
+
+	var results []structs.UserMediaEntry
+	for rows.Next() {
+		var userMediaDocument string
+		var mediaDocument sql.NullString
+		if err := rows.Scan(&userMediaDocument, &mediaDocument); err != nil {
+			return nil, err
+		}
+
+		var entry structs.UserMediaEntry
+		if err := unmarshalDocument(userMediaDocument, &entry.UserMedia); err != nil {
+			return nil, err
+		}
+
+		if mediaDocument.Valid {
+			entry.Media = &structs.AnilistMedia{}
+			if err := unmarshalDocument(mediaDocument.String, entry.Media); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, entry)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *SQLiteStore) SaveUserMedia(ctx context.Context, userMedia *structs.UserMedia) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	// same rules as the mongo store: an empty status keeps the current one
+	entry := *userMedia
+	entry.ID = primitive.NewObjectID()
+	entry.Score = score.Unscored
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = entry.CreatedAt
+
+	if entry.Status == "" {
+		entry.Status = "PLANNING"
+	}
+
+	// a new entry is always entering its status, see sqliteStatusHistory
+	today := structs.NewFuzzyDate(entry.CreatedAt)
+	switch entry.Status {
+	case "CURRENT", "REPEATING":
+		entry.StartedAt = &today
+	case "COMPLETED":
+		entry.CompletedAt = &today
+	}
+
+	document, err := marshalDocument(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	todayDocument, err := marshalDocument(&today)
+	if err != nil {
+		return nil, err
+	}
+
+	// the whole document is only used when inserting, an existing entry has these fields changed
+	err = s.db.QueryRowContext(ctx,
+		`INSERT INTO user_media (id, user_id, media_id, media_type, status, document)
+		VALUES (@id, @user_id, @media_id, @media_type, @insert_status, @document)
+		ON CONFLICT (user_id, media_id) DO UPDATE SET
+			status = iif(@status = '', user_media.status, @status),
+			document = json_set(user_media.document,
+				'$.status', iif(@status = '', user_media.status, @status),
+				'$.updated_at', json_extract(excluded.document, '$.updated_at')`+sqliteStatusHistory(userMedia.Status)+`)
+		RETURNING document`,
+		sql.Named("today", todayDocument),
+		sql.Named("id", entry.ID.Hex()),
+		sql.Named("user_id", int64(entry.UserID)),
+		sql.Named("media_id", entry.MediaID.Hex()),
+		sql.Named("media_type", entry.MediaType),
+		sql.Named("insert_status", entry.Status),
+		sql.Named("document", document),
+		sql.Named("status", userMedia.Status),
+	).Scan(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	var result structs.UserMedia
+	if err := unmarshalDocument(document, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *SQLiteStore) GetUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT document FROM user_media WHERE id = ? AND user_id = ?`, objectID.Hex(), int64(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := scanUserMedia(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &results[0], nil
+}
+
+func (s *SQLiteStore) IncrementUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, limit int) (*structs.UserMedia, error) {
+	// progress that is already past the limit is left alone
+	progress := `iif(@limit > 0,
+		max(min(ifnull(json_extract(document, '$.progress'), 0) + 1, @limit), ifnull(json_extract(document, '$.progress'), 0)),
+		ifnull(json_extract(document, '$.progress'), 0) + 1)`
+
+	return s.updateUserMediaProgress(ctx, userID, objectID, progress, `document`, sql.Named("limit", limit))
+}
+
+func (s *SQLiteStore) SetUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, progress int, progressVolumes int) (*structs.UserMedia, error) {
+	return s.updateUserMediaProgress(ctx, userID, objectID, `@progress`, `json_set(document, '$.progress_volumes', @progress_volumes)`,
+		sql.Named("progress", progress), sql.Named("progress_volumes", progressVolumes))
+}
+
+func (s *SQLiteStore) SetUserMediaHistory(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, startedAt *structs.AnilistFuzzyDate, completedAt *structs.AnilistFuzzyDate, repeat int) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	// marshalled as one document, so cleared dates become null like in the mongo store
+	history, err := marshalDocument(bson.M{
+		"started_at":   startedAt,
+		"completed_at": completedAt,
+		"updated_at":   time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result string
+	err = s.db.QueryRowContext(ctx,
+		`UPDATE user_media SET
+			document = json_set(document,
+				'$.started_at', json_extract(@history, '$.started_at'),
+				'$.completed_at', json_extract(@history, '$.completed_at'),
+				'$.repeat', @repeat,
+				'$.updated_at', json_extract(@history, '$.updated_at'))
+		WHERE id = @id AND user_id = @user_id
+		RETURNING document`,
+		sql.Named("history", history),
+		sql.Named("repeat", repeat),
+		sql.Named("id", objectID.Hex()),
+		sql.Named("user_id", int64(userID)),
+	).Scan(&result)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var userMedia structs.UserMedia
+	if err := unmarshalDocument(result, &userMedia); err != nil {
+		return nil, err
+	}
+
+	return &userMedia, nil
+}
+
+// sqliteStatusHistory gives the extra json_set arguments of SaveUserMedia that record an
+// existing entry moving into status, following the same rules as mongoStatusHistory.
+// @today is the date as a JSON document; user_media is the row before the update.
+func sqliteStatusHistory(status string) string {
+	entering := `user_media.status != @status`
+
+	switch status {
+	case "CURRENT", "REPEATING":
+		return `,
+				'$.started_at', iif(` + entering + ` AND ` + sqliteUnset("user_media.document", "started_at") + `,
+					json(@today), json_extract(user_media.document, '$.started_at'))`
+	case "COMPLETED":
+		rewatched := `user_media.status = 'REPEATING'`
+		return `,
+				'$.completed_at', iif(` + entering + ` AND (` + sqliteUnset("user_media.document", "completed_at") + ` OR ` + rewatched + `),
+					json(@today), json_extract(user_media.document, '$.completed_at')),
+				'$.repeat', ifnull(json_extract(user_media.document, '$.repeat'), 0) + iif(` + rewatched + `, 1, 0)`
+	default:
+		return ""
+	}
+}
+
+// sqliteUnset is true for document fields that are missing or null.
+func sqliteUnset(document string, field string) string {
+	return `ifnull(json_type(` + document + `, '$.` + field + `'), 'null') = 'null'`
+}
+
+// updateUserMediaProgress sets the progress to the result of an SQL expression on the
+// current row and moves planned entries to CURRENT, as started today, when it goes up. document is the
+// expression the changes are applied to. Every expression of an UPDATE sees the row
+// as it was before the update.
+func (s *SQLiteStore) updateUserMediaProgress(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, progress string, document string, args ...interface{}) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	updatedAt, err := marshalDocument(bson.M{"updated_at": now})
+	if err != nil {
+		return nil, err
+	}
+
+	todayDocument, err := marshalDocument(structs.NewFuzzyDate(now))
+	if err != nil {
+		return nil, err
+	}
+
+	started := `status = 'PLANNING' AND ` + progress + ` > ifnull(json_extract(document, '$.progress'), 0)`
+	status := `iif(` + started + `, 'CURRENT', status)`
+	startedAt := `iif(` + started + ` AND ` + sqliteUnset("document", "started_at") + `, json(@today), json_extract(document, '$.started_at'))`
+
+	args = append(args,
+		sql.Named("id", objectID.Hex()),
+		sql.Named("user_id", int64(userID)),
+		sql.Named("updated_at", updatedAt),
+		sql.Named("today", todayDocument),
+	)
+
+	var result string
+	err = s.db.QueryRowContext(ctx,
+		`UPDATE user_media SET
+			status = `+status+`,
+			document = json_set(`+document+`,
+				'$.progress', `+progress+`,
+				'$.status', `+status+`,
+				'$.started_at', `+startedAt+`,
+				'$.updated_at', json_extract(@updated_at, '$.updated_at'))
+		WHERE id = @id AND user_id = @user_id
+		RETURNING document`,
+		args...,
+	).Scan(&result)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var userMedia structs.UserMedia
+	if err := unmarshalDocument(result, &userMedia); err != nil {
+		return nil, err
+	}
+
+	return &userMedia, nil
+}
+
+func (s *SQLiteStore) GetUserMediaByMediaID(ctx context.Context, userID snowflake.ID, mediaID primitive.ObjectID) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT document FROM user_media WHERE user_id = ? AND media_id = ?`, int64(userID), mediaID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := scanUserMedia(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &results[0], nil
+}
+
+func (s *SQLiteStore) SetUserMediaRating(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, score int, note string, review string) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	updatedAt, err := marshalDocument(bson.M{"updated_at": time.Now()})
+	if err != nil {
+		return nil, err
+	}
+
+	// every expression sees the row before the update, so the checks below compare
+	// against the old note and review
+	now := `json_extract(@updated_at, '$.updated_at')`
+	document := `json_set(document, '$.score', @score, '$.updated_at', ` + now + `)`
+
+	if note == "" {
+		document = `json_remove(` + document + `, '$.note', '$.note_updated_at')`
+	} else {
+		document = `json_set(` + document + `,
+			'$.note', @note,
+			'$.note_updated_at', iif(ifnull(json_extract(document, '$.note'), '') != @note, ` + now + `, json_extract(document, '$.note_updated_at')))`
+	}
+
+	if review == "" {
+		document = `json_remove(` + document + `, '$.review', '$.review_created_at', '$.review_updated_at')`
+	} else {
+		document = `json_set(` + document + `,
+			'$.review', @review,
+			'$.review_created_at', iif(ifnull(json_extract(document, '$.review'), '') = '', ` + now + `, json_extract(document, '$.review_created_at')),
+			'$.review_updated_at', iif(ifnull(json_extract(document, '$.review'), '') != @review, ` + now + `, json_extract(document, '$.review_updated_at')))`
+	}
+
+	var result string
+	err = s.db.QueryRowContext(ctx,
+		`UPDATE user_media SET document = `+document+`
+		WHERE id = @id AND user_id = @user_id
+		RETURNING document`,
+		sql.Named("score", score),
+		sql.Named("note", note),
+		sql.Named("review", review),
+		sql.Named("updated_at", updatedAt),
+		sql.Named("id", objectID.Hex()),
+		sql.Named("user_id", int64(userID)),
+	).Scan(&result)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var userMedia structs.UserMedia
+	if err := unmarshalDocument(result, &userMedia); err != nil {
+		return nil, err
+	}
+
+	return &userMedia, nil
+}
+
+func (s *SQLiteStore) CountUserMediaByStatus(ctx context.Context, userID snowflake.ID, mediaType string) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM user_media WHERE user_id = ? AND media_type = ? GROUP BY status`,
+		int64(userID), mediaType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *SQLiteStore) GetUserMediaPage(ctx context.Context, userID snowflake.ID, mediaType string, status string, view listview.View, page int) (*structs.UserMediaPage, error) {
+	return s.userMediaPage(ctx,
+		`user_media.user_id = @user_id AND user_media.media_type = @media_type AND user_media.status = @status`,
+		[]interface{}{sql.Named("user_id", int64(userID)), sql.Named("media_type", mediaType), sql.Named("status", status)},
+		view, page,
+	)
+}
+
+// sqliteListSorts are the ORDER BY clauses of the list sort orders, user_media.id breaks
+// ties so entries don't move between pages.
+var sqliteListSorts = map[listview.Sort]string{
+	listview.SortAdded: `user_media.id`,
+	// the title shown is the english one when there is one (see AnilistMedia.GetTitle)
+	listview.SortTitle: `lower(coalesce(nullif(json_extract(media.document, '$.title.english'), ''),
+		json_extract(media.document, '$.title.romaji'))), user_media.id`,
+	listview.SortScore:    `json_extract(user_media.document, '$.score') DESC, user_media.id`,
+	listview.SortUpdated:  `json_extract(user_media.document, '$.updated_at."$date"') DESC, user_media.id`,
+	listview.SortYear:     `json_extract(media.document, '$.start_date.year') DESC, user_media.id`,
+	listview.SortProgress: `json_extract(user_media.document, '$.progress') DESC, user_media.id`,
+}
+
+// userMediaPage returns a page of the user_media rows matching where, sorted and
+// filtered by view. where and args use named parameters.
+func (s *SQLiteStore) userMediaPage(ctx context.Context, where string, args []interface{}, view listview.View, page int) (*structs.UserMediaPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	conditions := []string{where}
+
+	if len(view.Formats) > 0 {
+		conditions = append(conditions, `json_extract(media.document, '$.format') IN (`+sqliteNamedList("format", view.Formats, &args)+`)`)
+	}
+	if len(view.Statuses) > 0 {
+		conditions = append(conditions, `json_extract(media.document, '$.status') IN (`+sqliteNamedList("media_status", view.Statuses, &args)+`)`)
+	}
+	if view.Genre != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(media.document, '$.genres') WHERE value = @genre)`)
+		args = append(args, sql.Named("genre", view.Genre))
+	}
+
+	switch view.Scored {
+	case listview.ScoredYes:
+		conditions = append(conditions, `json_extract(user_media.document, '$.score') >= 0`)
+	case listview.ScoredNo:
+		conditions = append(conditions, `json_extract(user_media.document, '$.score') < 0`)
+	}
+
+	from := `FROM user_media LEFT JOIN media ON media.id = user_media.media_id WHERE ` + strings.Join(conditions, " AND ")
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) `+from, args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_media.document, media.document `+from+`
+		ORDER BY `+sqliteListSorts[view.GetSort()]+` LIMIT @limit OFFSET @offset`,
+		append(args, sql.Named("limit", UserMediaPageSize), sql.Named("offset", (page-1)*UserMediaPageSize))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := scanUserMediaEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &structs.UserMediaPage{Entries: media, Page: page, PerPage: UserMediaPageSize, Total: total}, nil
+}
+
+// sqliteNamedList adds values to args as name0, name1... and returns the placeholders
+// for them.
+func sqliteNamedList(name string, values []string, args *[]interface{}) string {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = fmt.Sprintf("@%s%d", name, i)
+		*args = append(*args, sql.Named(fmt.Sprintf("%s%d", name, i), value))
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+func (s *SQLiteStore) GetUserReviewsPage(ctx context.Context, userID snowflake.ID, page int) (*structs.UserMediaPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	var total int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_media WHERE user_id = ? AND ifnull(json_extract(document, '$.review'), '') != ''`,
+		int64(userID),
+	).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	// relaxed extended JSON dates are ISO 8601 strings, which sort like the dates
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_media.document, media.document FROM user_media
+		LEFT JOIN media ON media.id = user_media.media_id
+		WHERE user_media.user_id = ? AND ifnull(json_extract(user_media.document, '$.review'), '') != ''
+		ORDER BY json_extract(user_media.document, '$.review_updated_at."$date"') DESC, user_media.id DESC
+		LIMIT ? OFFSET ?`,
+		int64(userID), ReviewsPageSize, (page-1)*ReviewsPageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := scanUserMediaEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &structs.UserMediaPage{Entries: media, Page: page, PerPage: ReviewsPageSize, Total: total}, nil
+}
+
+func (s *SQLiteStore) GetSharedUserMedia(ctx context.Context, userID snowflake.ID, otherUserID snowflake.ID, mediaType string) ([]structs.SharedMediaEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_media.document, other_media.document, media.document FROM user_media
+		JOIN user_media AS other_media ON other_media.media_id = user_media.media_id AND other_media.user_id = @other_user_id
+		LEFT JOIN media ON media.id = user_media.media_id
+		WHERE user_media.user_id = @user_id AND user_media.media_type = @media_type`,
+		sql.Named("user_id", int64(userID)), sql.Named("other_user_id", int64(otherUserID)), sql.Named("media_type", mediaType),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shared := []structs.SharedMediaEntry{}
+	for rows.Next() {
+		var userDocument, otherDocument string
+		var mediaDocument sql.NullString
+		if err := rows.Scan(&userDocument, &otherDocument, &mediaDocument); err != nil {
+			return nil, err
+		}
+
+		var entry structs.SharedMediaEntry
+		if err := unmarshalDocument(userDocument, &entry.User); err != nil {
+			return nil, err
+		}
+		if err := unmarshalDocument(otherDocument, &entry.Other); err != nil {
+			return nil, err
+		}
+
+		if mediaDocument.Valid {
+			entry.Media = &structs.AnilistMedia{}
+			if err := unmarshalDocument(mediaDocument.String, entry.Media); err != nil {
+				return nil, err
+			}
+		}
+		shared = append(shared, entry)
+	}
+
+	return shared, rows.Err()
+}
+
+// sqliteEntryProgress is the number of episodes (chapters) a user_media row joined with
+// its media went through, total being the JSON path of the media's count. Entries
+// added as completed never had their progress set, so completed entries count the whole
+// media, and finished rewatches (rereads) went through it again.
+func sqliteEntryProgress(total string) string {
+	progress := `ifnull(json_extract(user_media.document, '$.progress'), 0)`
+	mediaTotal := `ifnull(json_extract(media.document, ` + total + `), 0)`
+
+	return `(iif(user_media.status = 'COMPLETED', max(` + progress + `, ` + mediaTotal + `), ` + progress + `) +
+		ifnull(json_extract(user_media.document, '$.repeat'), 0) * ` + mediaTotal + `)`
+}
+
+func (s *SQLiteStore) GetUserMediaStats(ctx context.Context, userID snowflake.ID, mediaType string) (*structs.UserMediaStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	args := []interface{}{
+		sql.Named("user_id", int64(userID)),
+		sql.Named("media_type", mediaType),
+		sql.Named("min_rank", MinStatsTagRank),
+	}
+
+	total := `'$.episodes'`
+	if mediaType == "MANGA" {
+		total = `'$.chapters'`
+	}
+
+	progress := sqliteEntryProgress(total)
+	minutes := progress + ` * ifnull(json_extract(media.document, '$.duration'), 0)`
+
+	stats := &structs.UserMediaStats{MediaType: mediaType}
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT `+sqliteStatsColumns+`, ifnull(SUM(`+progress+`), 0), ifnull(SUM(`+minutes+`), 0) `+sqliteStatsFrom+` `+sqliteStatsWhere,
+		args...,
+	).Scan(&stats.Overall.Count, &stats.Overall.Scored, &stats.Overall.ScoreSum, &stats.Progress, &stats.Minutes)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []struct {
+		groups *[]structs.StatsGroup
+		key    string
+		join   string
+		where  string
+	}{
+		{&stats.Statuses, `user_media.status`, ``, ``},
+		{&stats.Scores, `CAST(json_extract(user_media.document, '$.score') AS TEXT)`, ``,
+			`json_extract(user_media.document, '$.score') >= 0`},
+		// media without genres or tags store them as null, which json_each gives as a null value
+		{&stats.Genres, `genre.value`, `JOIN json_each(media.document, '$.genres') AS genre`,
+			`genre.value IS NOT NULL`},
+		{&stats.Tags, `json_extract(tag.value, '$.name')`, `JOIN json_each(media.document, '$.tags') AS tag`,
+			`json_extract(tag.value, '$.rank') >= @min_rank`},
+		{&stats.Formats, `json_extract(media.document, '$.format')`, ``,
+			`ifnull(json_extract(media.document, '$.format'), '') != ''`},
+		{&stats.ReleaseYears, `CAST(json_extract(media.document, '$.start_date.year') AS TEXT)`, ``,
+			`json_extract(media.document, '$.start_date.year') > 0`},
+	}
+
+	for _, group := range groups {
+		query := `SELECT ` + group.key + `, ` + sqliteStatsColumns + ` ` + sqliteStatsFrom + ` ` + group.join + ` ` + sqliteStatsWhere
+		if group.where != "" {
+			query += ` AND ` + group.where
+		}
+
+		*group.groups, err = s.statsGroups(ctx, query+` GROUP BY 1`, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// The entry count, scored entry count and score sum selected for each stats group, from
+// a user's entries of a media type.
+const (
+	sqliteStatsColumns = `COUNT(*),
+		ifnull(SUM(json_extract(user_media.document, '$.score') >= 0), 0),
+		ifnull(SUM(max(json_extract(user_media.document, '$.score'), 0)), 0)`
+	sqliteStatsFrom  = `FROM user_media LEFT JOIN media ON media.id = user_media.media_id`
+	sqliteStatsWhere = `WHERE user_media.user_id = @user_id AND user_media.media_type = @media_type`
+)
+
+func (s *SQLiteStore) statsGroups(ctx context.Context, query string, args []interface{}) ([]structs.StatsGroup, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []structs.StatsGroup{}
+	for rows.Next() {
+		var group structs.StatsGroup
+		if err := rows.Scan(&group.Key, &group.Count, &group.Scored, &group.ScoreSum); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteUserMediaByObjectID(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM user_media WHERE id = ? AND user_id = ?`, objectID.Hex(), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) SetUserMediaLists(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, listIDs []primitive.ObjectID) (*structs.UserMedia, error) {
+	return s.setUserMediaField(ctx, userID, objectID, "lists", listIDs, len(listIDs) == 0)
+}
+
+func (s *SQLiteStore) SetUserMediaTags(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, tags []string) (*structs.UserMedia, error) {
+	return s.setUserMediaField(ctx, userID, objectID, "tags", tags, len(tags) == 0)
+}
+
+// setUserMediaField replaces one field of a list entry, or removes it when empty is true.
+// field is one of ours, never user input.
+func (s *SQLiteStore) setUserMediaField(ctx context.Context, userID snowflake.ID, objectID primitive.ObjectID, field string, value interface{}, empty bool) (*structs.UserMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	// marshalled as a document so the value is stored the same way as everywhere else
+	fields, err := marshalDocument(bson.M{field: value, "updated_at": time.Now()})
+	if err != nil {
+		return nil, err
+	}
+
+	document := `json_set(document, '$.` + field + `', json_extract(@fields, '$.` + field + `'), '$.updated_at', json_extract(@fields, '$.updated_at'))`
+	if empty {
+		document = `json_remove(json_set(document, '$.updated_at', json_extract(@fields, '$.updated_at')), '$.` + field + `')`
+	}
+
+	var result string
+	err = s.db.QueryRowContext(ctx,
+		`UPDATE user_media SET document = `+document+`
+		WHERE id = @id AND user_id = @user_id
+		RETURNING document`,
+		sql.Named("fields", fields),
+		sql.Named("id", objectID.Hex()),
+		sql.Named("user_id", int64(userID)),
+	).Scan(&result)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var userMedia structs.UserMedia
+	if err := unmarshalDocument(result, &userMedia); err != nil {
+		return nil, err
+	}
+
+	return &userMedia, nil
+}
+
+func (s *SQLiteStore) ImportUserList(ctx context.Context, list *structs.UserList) error {
+	document, err := marshalDocument(list)
+	if err != nil {
+		return err
+	}
+
+	// only the id may conflict, INSERT OR REPLACE would also replace lists with the same name
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO user_lists (id, user_id, media_type, name_key, document) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, media_type = excluded.media_type,
+			name_key = excluded.name_key, document = excluded.document`,
+		list.ID.Hex(), int64(list.UserID), list.MediaType, strings.ToLower(list.Name), document,
+	)
+	if sqliteIsUniqueError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func scanUserLists(rows *sql.Rows) ([]structs.UserList, error) {
+	defer rows.Close()
+
+	var results []structs.UserList
+	for rows.Next() {
+		var document string
+		if err := rows.Scan(&document); err != nil {
+			return nil, err
+		}
+
+		var list structs.UserList
+		if err := unmarshalDocument(document, &list); err != nil {
+			return nil, err
+		}
+		results = append(results, list)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *SQLiteStore) GetUserLists(ctx context.Context, userID snowflake.ID, mediaType string) ([]structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT document FROM user_lists WHERE user_id = ? AND media_type = ? ORDER BY id`,
+		int64(userID), mediaType,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanUserLists(rows)
+}
+
+func (s *SQLiteStore) GetUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) (*structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT document FROM user_lists WHERE id = ? AND user_id = ?`, listID.Hex(), int64(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := scanUserLists(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lists) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &lists[0], nil
+}
+
+func (s *SQLiteStore) CreateUserList(ctx context.Context, userList *structs.UserList) (*structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	list := *userList
+	list.ID = primitive.NewObjectID()
+	list.CreatedAt = time.Now()
+
+	if err := s.ImportUserList(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (s *SQLiteStore) RenameUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, name string) (*structs.UserList, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	var document string
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE user_lists SET name_key = ?, document = json_set(document, '$.name', ?)
+		WHERE id = ? AND user_id = ?
+		RETURNING document`,
+		strings.ToLower(name), name, listID.Hex(), int64(userID),
+	).Scan(&document)
+	if sqliteIsUniqueError(err) {
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var list structs.UserList
+	if err := unmarshalDocument(document, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// sqliteListMember is true for user_media rows on the custom list @list_id. Object IDs
+// are stored as {"$oid": "..."} in relaxed extended JSON.
+const sqliteListMember = `EXISTS (SELECT 1 FROM json_each(user_media.document, '$.lists') WHERE json_extract(value, '$."$oid"') = @list_id)`
+
+func (s *SQLiteStore) DeleteUserList(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_lists WHERE id = ? AND user_id = ?`, listID.Hex(), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE user_media SET document = json_set(document, '$.lists', (
+			SELECT json_group_array(json(value)) FROM json_each(user_media.document, '$.lists')
+			WHERE json_extract(value, '$."$oid"') != @list_id
+		))
+		WHERE user_id = @user_id AND `+sqliteListMember,
+		sql.Named("list_id", listID.Hex()),
+		sql.Named("user_id", int64(userID)),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) CountUserMediaByList(ctx context.Context, userID snowflake.ID, mediaType string) (map[primitive.ObjectID]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT json_extract(list.value, '$."$oid"'), COUNT(*) FROM user_media, json_each(user_media.document, '$.lists') AS list
+		WHERE user_media.user_id = ? AND user_media.media_type = ?
+		GROUP BY 1`,
+		int64(userID), mediaType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[primitive.ObjectID]int{}
+	for rows.Next() {
+		var hexID string
+		var count int
+		if err := rows.Scan(&hexID, &count); err != nil {
+			return nil, err
+		}
+
+		listID, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			return nil, err
+		}
+		counts[listID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *SQLiteStore) GetUserListPage(ctx context.Context, userID snowflake.ID, listID primitive.ObjectID, view listview.View, page int) (*structs.UserMediaPage, error) {
+	return s.userMediaPage(ctx,
+		`user_media.user_id = @user_id AND `+sqliteListMember,
+		[]interface{}{sql.Named("user_id", int64(userID)), sql.Named("list_id", listID.Hex())},
+		view, page,
+	)
+}
+
+// ImportFavourite writes a favourite document as-is, keeping its ObjectID.
+func (s *SQLiteStore) ImportFavourite(ctx context.Context, favourite *structs.Favourite) error {
+	document, err := marshalDocument(favourite)
+	if err != nil {
+		return err
+	}
+
+	// only media favourites point at a media row
+	var mediaID interface{}
+	if !favourite.MediaID.IsZero() {
+		mediaID = favourite.MediaID.Hex()
+	}
+
+	// only the id may conflict, INSERT OR REPLACE would also replace the same favourite under another id
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO favourites (id, user_id, type, id_anilist, media_id, position, document) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, type = excluded.type, id_anilist = excluded.id_anilist,
+			media_id = excluded.media_id, position = excluded.position, document = excluded.document`,
+		favourite.ID.Hex(), int64(favourite.UserID), favourite.Type, favourite.IdAnilist, mediaID, favourite.Position, document,
+	)
+	if sqliteIsUniqueError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *SQLiteStore) GetUserFavourites(ctx context.Context, userID snowflake.ID, favouriteType string) ([]structs.FavouriteEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT favourites.document, media.document FROM favourites
+		LEFT JOIN media ON media.id = favourites.media_id
+		WHERE favourites.user_id = ? AND favourites.type = ?
+		ORDER BY favourites.position, favourites.id`,
+		int64(userID), favouriteType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []structs.FavouriteEntry
+	for rows.Next() {
+		var favouriteDocument string
+		var mediaDocument sql.NullString
+		if err := rows.Scan(&favouriteDocument, &mediaDocument); err != nil {
+			return nil, err
+		}
+
+		var entry structs.FavouriteEntry
+		if err := unmarshalDocument(favouriteDocument, &entry.Favourite); err != nil {
+			return nil, err
+		}
+
+		if mediaDocument.Valid {
+			entry.Media = &structs.AnilistMedia{}
+			if err := unmarshalDocument(mediaDocument.String, entry.Media); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, entry)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *SQLiteStore) GetUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) (*structs.Favourite, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	var document string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT document FROM favourites WHERE user_id = ? AND type = ? AND id_anilist = ?`,
+		int64(userID), favouriteType, idAnilist,
+	).Scan(&document)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var favourite structs.Favourite
+	if err := unmarshalDocument(document, &favourite); err != nil {
+		return nil, err
+	}
+
+	return &favourite, nil
+}
+
+func (s *SQLiteStore) AddUserFavourite(ctx context.Context, favourite *structs.Favourite) (*structs.Favourite, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	added := *favourite
+	added.ID = primitive.NewObjectID()
+	added.CreatedAt = time.Now()
+
+	if err := s.ImportFavourite(ctx, &added); err != nil {
+		return nil, err
+	}
+
+	return &added, nil
+}
+
+func (s *SQLiteStore) DeleteUserFavourite(ctx context.Context, userID snowflake.ID, favouriteType string, idAnilist int) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM favourites WHERE user_id = ? AND type = ? AND id_anilist = ?`,
+		int64(userID), favouriteType, idAnilist,
+	)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) SetUserFavouritePositions(ctx context.Context, userID snowflake.ID, favouriteType string, favouriteIDs []primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for position, favouriteID := range favouriteIDs {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE favourites SET position = @position, document = json_set(document, '$.position', @position)
+			WHERE id = @id AND user_id = @user_id AND type = @type`,
+			sql.Named("position", position),
+			sql.Named("id", favouriteID.Hex()),
+			sql.Named("user_id", int64(userID)),
+			sql.Named("type", favouriteType),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ImportUserSettings(ctx context.Context, settings *structs.UserSettings) error {
+	document, err := marshalDocument(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO user_settings (user_id, document) VALUES (?, ?)`,
+		int64(settings.UserID), document,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetUserSettings(ctx context.Context, userID snowflake.ID) (*structs.UserSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	var document string
+	err := s.db.QueryRowContext(ctx, `SELECT document FROM user_settings WHERE user_id = ?`, int64(userID)).Scan(&document)
+	if err != nil {
+		return nil, sqliteTranslateError(err)
+	}
+
+	var settings structs.UserSettings
+	if err := unmarshalDocument(document, &settings); err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (s *SQLiteStore) SetUserScoreFormat(ctx context.Context, userID snowflake.ID, format score.Format) (*structs.UserSettings, error) {
+	return s.setUserSetting(ctx, &structs.UserSettings{UserID: userID, ScoreFormat: format}, "score_format")
+}
+
+func (s *SQLiteStore) SetUserListPrivacy(ctx context.Context, userID snowflake.ID, privacy structs.ListPrivacy) (*structs.UserSettings, error) {
+	return s.setUserSetting(ctx, &structs.UserSettings{UserID: userID, ListPrivacy: privacy}, "list_privacy")
+}
+
+// setUserSetting saves the field setting of settings, creating the user's settings
+// when they have none yet. Their other settings are kept.
+func (s *SQLiteStore) setUserSetting(ctx context.Context, settings *structs.UserSettings, field string) (*structs.UserSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	settings.UpdatedAt = time.Now()
+	document, err := marshalDocument(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		`INSERT INTO user_settings (user_id, document) VALUES (@user_id, @document)
+		ON CONFLICT (user_id) DO UPDATE SET
+			document = json_set(user_settings.document,
+				@field, json_extract(excluded.document, @field),
+				'$.updated_at', json_extract(excluded.document, '$.updated_at'))
+		RETURNING document`,
+		sql.Named("user_id", int64(settings.UserID)),
+		sql.Named("document", document),
+		sql.Named("field", "$."+field),
+	).Scan(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	var result structs.UserSettings
+	if err := unmarshalDocument(document, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *SQLiteStore) SaveGuildMember(ctx context.Context, member *structs.GuildMember) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	return s.ImportGuildMember(ctx, member)
+}
+
+func (s *SQLiteStore) ImportGuildMember(ctx context.Context, member *structs.GuildMember) error {
+	document, err := marshalDocument(member)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO guild_members (guild_id, user_id, document) VALUES (?, ?, ?)`,
+		int64(member.GuildID), int64(member.UserID), document,
+	)
+	return err
+}
+
+func (s *SQLiteStore) DeleteGuildMember(ctx context.Context, guildID snowflake.ID, userID snowflake.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM guild_members WHERE guild_id = ? AND user_id = ?`, int64(guildID), int64(userID))
+	return err
+}
+
+func (s *SQLiteStore) DeleteGuildMembers(ctx context.Context, guildID snowflake.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM guild_members WHERE guild_id = ?`, int64(guildID))
+	return err
+}
+
+func (s *SQLiteStore) GetGuildMembersSeenBefore(ctx context.Context, guildID snowflake.ID, before time.Time, limit int) ([]snowflake.ID, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_id FROM guild_members
+		WHERE guild_id = @guild_id AND julianday(json_extract(document, '$.seen_at."$date"')) < julianday(@before)
+		ORDER BY julianday(json_extract(document, '$.seen_at."$date"')), user_id LIMIT @limit`,
+		sql.Named("guild_id", int64(guildID)),
+		sql.Named("before", before.UTC().Format(time.RFC3339)),
+		sql.Named("limit", limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []snowflake.ID{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, snowflake.ID(userID))
+	}
+
+	return userIDs, rows.Err()
+}
+
+// The recorded members of the guild @guild_id who don't keep their lists private.
+const sqliteGuildUsers = `SELECT guild_members.user_id FROM guild_members
+	LEFT JOIN user_settings ON user_settings.user_id = guild_members.user_id
+	WHERE guild_members.guild_id = @guild_id AND ifnull(json_extract(user_settings.document, '$.list_privacy'), '') != 'PRIVATE'`
+
+func (s *SQLiteStore) GetGuildLeaderboard(ctx context.Context, guildID snowflake.ID, board structs.Leaderboard, since time.Time, limit int) ([]structs.LeaderboardEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	value, where := `COUNT(*)`, ``
+	switch board {
+	case structs.LeaderboardAnimeCompleted:
+		where = `user_media.media_type = 'ANIME' AND user_media.status = 'COMPLETED'`
+	case structs.LeaderboardMangaCompleted:
+		where = `user_media.media_type = 'MANGA' AND user_media.status = 'COMPLETED'`
+	case structs.LeaderboardEpisodes:
+		value, where = `SUM(`+sqliteEntryProgress(`'$.episodes'`)+`)`, `user_media.media_type = 'ANIME'`
+	case structs.LeaderboardChapters:
+		value, where = `SUM(`+sqliteEntryProgress(`'$.chapters'`)+`)`, `user_media.media_type = 'MANGA'`
+	case structs.LeaderboardActive:
+		where = `julianday(json_extract(user_media.document, '$.updated_at."$date"')) >= julianday(@since)`
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_media.user_id, ifnull(`+value+`, 0) AS value FROM user_media
+		LEFT JOIN media ON media.id = user_media.media_id
+		WHERE user_media.user_id IN (`+sqliteGuildUsers+`) AND `+where+`
+		GROUP BY user_media.user_id HAVING value > 0
+		ORDER BY value DESC, user_media.user_id LIMIT @limit`,
+		sql.Named("guild_id", int64(guildID)),
+		sql.Named("since", since.UTC().Format(time.RFC3339)),
+		sql.Named("limit", limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []structs.LeaderboardEntry{}
+	for rows.Next() {
+		var userID int64
+		var entry structs.LeaderboardEntry
+		if err := rows.Scan(&userID, &entry.Value); err != nil {
+			return nil, err
+		}
+		entry.UserID = snowflake.ID(userID)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) GetGuildTopMedia(ctx context.Context, guildID snowflake.ID, mediaType string, minRatings int, limit int) ([]structs.GuildMediaScore, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT ranked.media_id, ranked.ratings, ranked.score_sum, media.document FROM (
+			SELECT user_media.media_id, COUNT(*) AS ratings, SUM(json_extract(user_media.document, '$.score')) AS score_sum
+			FROM user_media
+			WHERE user_media.user_id IN (`+sqliteGuildUsers+`) AND user_media.media_type = @media_type
+				AND json_extract(user_media.document, '$.score') >= 0
+			GROUP BY user_media.media_id HAVING ratings >= @min_ratings
+		) AS ranked
+		LEFT JOIN media ON media.id = ranked.media_id
+		ORDER BY ranked.score_sum * 1.0 / ranked.ratings DESC, ranked.ratings DESC, ranked.media_id
+		LIMIT @limit`,
+		sql.Named("guild_id", int64(guildID)),
+		sql.Named("media_type", mediaType),
+		sql.Named("min_ratings", minRatings),
+		sql.Named("limit", limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []structs.GuildMediaScore{}
+	for rows.Next() {
+		var mediaID string
+		var mediaDocument sql.NullString
+		var entry structs.GuildMediaScore
+		if err := rows.Scan(&mediaID, &entry.Ratings, &entry.ScoreSum, &mediaDocument); err != nil {
+			return nil, err
+		}
+
+		entry.MediaID, err = primitive.ObjectIDFromHex(mediaID)
+		if err != nil {
+			return nil, err
+		}
+
+		if mediaDocument.Valid {
+			entry.Media = &structs.AnilistMedia{}
+			if err := unmarshalDocument(mediaDocument.String, entry.Media); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
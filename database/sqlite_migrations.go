@@ -0,0 +1,249 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const sqliteMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+);
+`
+
+type sqliteMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, conn *sql.Conn) error
+}
+
+// sqliteMigrations run in version order, each once and in its own transaction.
+var sqliteMigrations = []sqliteMigration{
+	{1, "initial_schema", func(ctx context.Context, conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, sqliteSchema); err != nil {
+			return err
+		}
+
+		// index media saved before the full text table existed
+		backfill := strings.ReplaceAll(mediaFTSValues, "new.", "media.")
+		_, err := conn.ExecContext(ctx, `INSERT INTO media_fts SELECT `+backfill+` FROM media WHERE id NOT IN (SELECT id FROM media_fts)`)
+		return err
+	}},
+	{2, "user_media_unset_scores", func(ctx context.Context, conn *sql.Conn) error {
+		// unrated entries are stored with a score of -1, older ones may have 0 or nothing
+		_, err := conn.ExecContext(ctx, `UPDATE user_media SET document = json_set(document, '$.score', -1)
+			WHERE ifnull(json_extract(document, '$.score'), 0) = 0`)
+		return err
+	}},
+	{3, "unique_user_media_and_search_queries", func(ctx context.Context, conn *sql.Conn) error {
+		// keep the most recently updated copy of entries added twice, and the oldest
+		// copy of repeated searches (the one most messages link to)
+		_, err := conn.ExecContext(ctx, `
+			DELETE FROM user_media WHERE id IN (
+				SELECT id FROM (
+					SELECT id, row_number() OVER (
+						PARTITION BY user_id, media_id ORDER BY json_extract(document, '$.updated_at."$date"') DESC
+					) AS position FROM user_media
+				) WHERE position > 1
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS user_media_user_media ON user_media (user_id, media_id);
+
+			DELETE FROM search_queries WHERE id IN (
+				SELECT id FROM (
+					SELECT id, row_number() OVER (PARTITION BY search_text, media_type ORDER BY id) AS position FROM search_queries
+				) WHERE position > 1
+			);
+
+			DROP INDEX IF EXISTS search_queries_text_type;
+			CREATE UNIQUE INDEX search_queries_text_type ON search_queries (search_text, media_type);
+		`)
+		return err
+	}},
+	{4, "search_queries_snapshots", func(ctx context.Context, conn *sql.Conn) error {
+		// every search is stored on its own now, with its results; searches saved
+		// before results were kept can't be paged anymore
+		_, err := conn.ExecContext(ctx, `
+			DROP INDEX IF EXISTS search_queries_text_type;
+			DELETE FROM search_queries WHERE json_type(document, '$.result_ids') IS NULL;
+
+			ALTER TABLE search_queries ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX search_queries_expires_at ON search_queries (expires_at);
+		`)
+		return err
+	}},
+	{5, "user_settings_and_100_point_scores", func(ctx context.Context, conn *sql.Conn) error {
+		// scores were out of 10 and are stored out of 100 now, whatever format users pick
+		_, err := conn.ExecContext(ctx, `
+			CREATE TABLE user_settings (
+				user_id  INTEGER PRIMARY KEY,
+				document TEXT NOT NULL
+			);
+
+			UPDATE user_media SET document = json_set(document, '$.score', json_extract(document, '$.score') * 10)
+			WHERE json_extract(document, '$.score') > 0;
+		`)
+		return err
+	}},
+	{6, "user_lists", func(ctx context.Context, conn *sql.Conn) error {
+		// name_key is the lowercased name, list names are unique per user and media type ignoring case
+		_, err := conn.ExecContext(ctx, `
+			CREATE TABLE user_lists (
+				id         TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL,
+				media_type TEXT NOT NULL,
+				name_key   TEXT NOT NULL,
+				document   TEXT NOT NULL
+			);
+
+			CREATE UNIQUE INDEX user_lists_user_type_name ON user_lists (user_id, media_type, name_key);
+		`)
+		return err
+	}},
+	{7, "favourites", func(ctx context.Context, conn *sql.Conn) error {
+		// media_id is NULL for favourites that aren't media
+		_, err := conn.ExecContext(ctx, `
+			CREATE TABLE favourites (
+				id         TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL,
+				type       TEXT NOT NULL,
+				id_anilist INTEGER NOT NULL,
+				media_id   TEXT,
+				position   INTEGER NOT NULL,
+				document   TEXT NOT NULL
+			);
+
+			CREATE UNIQUE INDEX favourites_user_type_item ON favourites (user_id, type, id_anilist);
+		`)
+		return err
+	}},
+	{8, "guild_members", func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `
+			CREATE TABLE guild_members (
+				guild_id INTEGER NOT NULL,
+				user_id  INTEGER NOT NULL,
+				document TEXT NOT NULL,
+				PRIMARY KEY (guild_id, user_id)
+			);
+		`)
+		return err
+	}},
+}
+
+func (s *SQLiteStore) MigrateUp(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var applied []MigrationStatus
+	for _, migration := range sqliteMigrations {
+		status, err := applySQLiteMigration(ctx, conn, migration)
+		if err != nil {
+			var sqliteErr *sqlite.Error
+			if errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY {
+				return applied, fmt.Errorf("%w: %v", ErrMigrationLocked, err)
+			}
+			return applied, fmt.Errorf("migration %d (%s): %w", migration.version, migration.name, err)
+		}
+
+		if status != nil {
+			applied = append(applied, *status)
+		}
+	}
+
+	return applied, nil
+}
+
+// applySQLiteMigration runs a migration unless it was already applied. BEGIN IMMEDIATE
+// takes the write lock before checking, so two processes sharing the file can't both
+// run the same migration; the second one waits (busy_timeout) and then skips it.
+func applySQLiteMigration(ctx context.Context, conn *sql.Conn, migration sqliteMigration) (*MigrationStatus, error) {
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		}
+	}()
+
+	var count int
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, migration.version).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	var status *MigrationStatus
+	if count == 0 {
+		log.Printf("Applying migration %d (%s)", migration.version, migration.name)
+
+		if err := migration.up(ctx, conn); err != nil {
+			return nil, err
+		}
+
+		status = &MigrationStatus{Version: migration.version, Name: migration.name, AppliedAt: time.Now()}
+		_, err = conn.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			status.Version, status.Name, status.AppliedAt.UTC().Format(time.RFC3339Nano),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return status, nil
+}
+
+func (s *SQLiteStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAtText string
+		if err := rows.Scan(&version, &appliedAtText); err != nil {
+			return nil, err
+		}
+
+		appliedAt[version], err = time.Parse(time.RFC3339Nano, appliedAtText)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(sqliteMigrations))
+	for i, migration := range sqliteMigrations {
+		statuses[i] = MigrationStatus{Version: migration.version, Name: migration.name, AppliedAt: appliedAt[migration.version]}
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testSQLiteStore opens a migrated SQLite database that lives as long as the test.
+func testSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening the test database: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	if _, err := store.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+
+	return store
+}
+
+func TestSQLiteUserMediaOfOtherUsers(t *testing.T) {
+	const owner, stranger snowflake.ID = 1, 2
+
+	store := testSQLiteStore(t)
+	ctx := context.Background()
+
+	userMedia, err := store.SaveUserMedia(ctx, &structs.UserMedia{UserID: owner, MediaID: primitive.NewObjectID(), MediaType: "ANIME", Status: "CURRENT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every call is made by a user who doesn't own the entry
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"GetUserMediaByObjectID", func() error {
+			_, err := store.GetUserMediaByObjectID(ctx, stranger, userMedia.ID)
+			return err
+		}},
+		{"IncrementUserMediaProgress", func() error {
+			_, err := store.IncrementUserMediaProgress(ctx, stranger, userMedia.ID, 0)
+			return err
+		}},
+		{"SetUserMediaProgress", func() error {
+			_, err := store.SetUserMediaProgress(ctx, stranger, userMedia.ID, 5, 0)
+			return err
+		}},
+		{"SetUserMediaRating", func() error {
+			_, err := store.SetUserMediaRating(ctx, stranger, userMedia.ID, 80, "note", "review")
+			return err
+		}},
+		{"SetUserMediaHistory", func() error {
+			_, err := store.SetUserMediaHistory(ctx, stranger, userMedia.ID, nil, nil, 3)
+			return err
+		}},
+		{"DeleteUserMediaByObjectID", func() error {
+			return store.DeleteUserMediaByObjectID(ctx, stranger, userMedia.ID)
+		}},
+	}
+
+	for _, call := range calls {
+		t.Run(call.name, func(t *testing.T) {
+			if err := call.call(); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s() error = %v, want ErrNotFound", call.name, err)
+			}
+		})
+	}
+
+	// and the owner's entry is as it was
+	got, err := store.GetUserMediaByObjectID(ctx, owner, userMedia.ID)
+	if err != nil {
+		t.Fatalf("GetUserMediaByObjectID() of the owner error = %v", err)
+	}
+	if got.Progress != 0 || got.Score != score.Unscored || got.Note != "" || got.Repeat != 0 || got.StartedAt == nil {
+		t.Errorf("entry = %+v, want it unchanged", got)
+	}
+}
+
+// importTestMedia adds an anime to the database, with episodes episodes of 24 minutes.
+func importTestMedia(t *testing.T, store *SQLiteStore, idAnilist int, title string, episodes int) *structs.AnilistMedia {
+	t.Helper()
+
+	media := &structs.AnilistMedia{
+		ID: primitive.NewObjectID(), IdAnilist: idAnilist, Type: "ANIME", Episodes: episodes, Duration: 24,
+		Title: structs.AnilistMediaTitle{Romaji: title},
+	}
+	media.MediaHash = media.Hash()
+	if err := store.ImportMedia(context.Background(), media); err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+// importTestEntry adds a list entry. A progress of -1 leaves it out of the document, like
+// in entries written by SaveUserMedia of the Mongo store.
+func importTestEntry(t *testing.T, store *SQLiteStore, userMedia structs.UserMedia) {
+	t.Helper()
+
+	ctx := context.Background()
+	userMedia.ID = primitive.NewObjectID()
+	userMedia.UpdatedAt = time.Now()
+
+	noProgress := userMedia.Progress < 0
+	if noProgress {
+		userMedia.Progress = 0
+	}
+
+	if err := store.ImportUserMedia(ctx, &userMedia); err != nil {
+		t.Fatal(err)
+	}
+
+	if noProgress {
+		_, err := store.db.ExecContext(ctx, `UPDATE user_media SET document = json_remove(document, '$.progress') WHERE id = ?`, userMedia.ID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSQLiteUserMediaStatsProgress(t *testing.T) {
+	const userID snowflake.ID = 1
+
+	store := testSQLiteStore(t)
+	ctx := context.Background()
+
+	entries := []struct {
+		status   string
+		progress int
+		repeat   int
+		episodes int
+		want     int
+	}{
+		{"COMPLETED", -1, 0, 12, 12}, // added as completed, progress never set
+		{"COMPLETED", 0, 0, 12, 12},  // progress left at 0
+		{"COMPLETED", 12, 1, 12, 24}, // watched twice
+		{"COMPLETED", 30, 0, 26, 30}, // progress past the episode count
+		{"REPEATING", 5, 1, 10, 15},  // rewatching
+		{"CURRENT", -1, 0, 12, 0},    // started, nothing watched
+		{"CURRENT", 3, 0, 12, 3},     // partly watched
+		{"COMPLETED", 0, 0, 0, 0},    // episode count unknown
+		{"DROPPED", 4, 0, 24, 4},     // dropped
+		{"PLANNING", -1, 0, 12, 0},   // not started
+	}
+
+	wantProgress := 0
+	for i, entry := range entries {
+		media := importTestMedia(t, store, i+1, fmt.Sprintf("Title %d", i+1), entry.episodes)
+		importTestEntry(t, store, structs.UserMedia{
+			UserID: userID, MediaID: media.ID, MediaType: "ANIME", Status: entry.status,
+			Progress: entry.progress, Repeat: entry.repeat, Score: score.Unscored,
+		})
+		wantProgress += entry.want
+	}
+
+	stats, err := store.GetUserMediaStats(ctx, userID, "ANIME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Progress != wantProgress {
+		t.Errorf("Progress = %d, want %d", stats.Progress, wantProgress)
+	}
+	if stats.Minutes != wantProgress*24 {
+		t.Errorf("Minutes = %d, want %d", stats.Minutes, wantProgress*24)
+	}
+}
+
+func TestSQLiteGuildLeaderboardEpisodes(t *testing.T) {
+	const guildID snowflake.ID = 10
+
+	store := testSQLiteStore(t)
+	ctx := context.Background()
+
+	// the same entries as in TestSQLiteUserMediaStatsProgress, one user each
+	entries := []struct {
+		status   string
+		progress int
+		repeat   int
+		episodes int
+		want     int
+	}{
+		{"COMPLETED", -1, 0, 12, 12},
+		{"COMPLETED", 12, 1, 12, 24},
+		{"REPEATING", 5, 1, 10, 15},
+		{"CURRENT", 3, 0, 12, 3},
+		{"CURRENT", -1, 0, 12, 0},
+	}
+
+	want := map[snowflake.ID]int{}
+	for i, entry := range entries {
+		userID := snowflake.ID(i + 1)
+		media := importTestMedia(t, store, i+1, fmt.Sprintf("Title %d", i+1), entry.episodes)
+		importTestEntry(t, store, structs.UserMedia{
+			UserID: userID, MediaID: media.ID, MediaType: "ANIME", Status: entry.status,
+			Progress: entry.progress, Repeat: entry.repeat, Score: score.Unscored,
+		})
+		if err := store.SaveGuildMember(ctx, &structs.GuildMember{GuildID: guildID, UserID: userID, SeenAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if entry.want > 0 {
+			want[userID] = entry.want
+		}
+	}
+
+	got, err := store.GetGuildLeaderboard(ctx, guildID, structs.LeaderboardEpisodes, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetGuildLeaderboard() = %+v, want %d entries", got, len(want))
+	}
+	for i, entry := range got {
+		if entry.Value != want[entry.UserID] {
+			t.Errorf("user %d has %d episodes, want %d", entry.UserID, entry.Value, want[entry.UserID])
+		}
+		if i > 0 && got[i-1].Value < entry.Value {
+			t.Errorf("entry %d has more episodes than the one before it", i)
+		}
+	}
+}
+
+func TestSQLiteGuildMembersSeenBefore(t *testing.T) {
+	const guildID, otherGuildID snowflake.ID = 10, 20
+
+	store := testSQLiteStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	members := []structs.GuildMember{
+		{GuildID: guildID, UserID: 1, SeenAt: now.Add(-time.Hour)},
+		{GuildID: guildID, UserID: 2, SeenAt: now.Add(-72 * time.Hour)},
+		{GuildID: guildID, UserID: 3, SeenAt: now.Add(-48 * time.Hour)},
+		{GuildID: guildID, UserID: 4, SeenAt: now.Add(-96 * time.Hour)},
+		{GuildID: otherGuildID, UserID: 5, SeenAt: now.Add(-96 * time.Hour)},
+	}
+	for i := range members {
+		if err := store.SaveGuildMember(ctx, &members[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		limit int
+		want  []snowflake.ID
+	}{
+		{10, []snowflake.ID{4, 2, 3}},
+		{2, []snowflake.ID{4, 2}},
+	}
+
+	for _, test := range tests {
+		got, err := store.GetGuildMembersSeenBefore(ctx, guildID, now.Add(-24*time.Hour), test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("GetGuildMembersSeenBefore() with a limit of %d = %v, want %v", test.limit, got, test.want)
+		}
+	}
+
+	// seeing a member again leaves them out until they weren't seen in a while
+	if err := store.SaveGuildMember(ctx, &structs.GuildMember{GuildID: guildID, UserID: 4, SeenAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetGuildMembersSeenBefore(ctx, guildID, now.Add(-24*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]snowflake.ID{2, 3}) {
+		t.Errorf("GetGuildMembersSeenBefore() after seeing user 4 = %v, want [2 3]", got)
+	}
+}
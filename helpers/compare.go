@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"fmt"
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+// The lists of /compare, in the order of its select menu.
+const (
+	CompareDisagreements  = "disagreements"
+	compareAgreements     = "agreements"
+	compareUserCompleted  = "user_completed"
+	compareOtherCompleted = "other_completed"
+)
+
+// GetComparisonMessage shows one page of one of the lists comparing user's list with
+// other's, with scores in user's format. Only user can page through it.
+func GetComparisonMessage(user discord.User, other discord.User, comparison *structs.UserMediaComparison, section string, page int, format score.Format) discord.MessageUpdate {
+	kind, title := "anime", "Anime"
+	if comparison.MediaType == "MANGA" {
+		kind, title = "manga", "Manga"
+	}
+
+	sections := []struct {
+		section string
+		label   string
+		entries []structs.SharedMediaEntry
+	}{
+		{CompareDisagreements, "Biggest disagreements", comparison.Disagreements},
+		{compareAgreements, "Agreements", comparison.Agreements},
+		{compareUserCompleted, fmt.Sprintf("%s completed, %s is planning", user.Username, other.Username), comparison.UserCompleted},
+		{compareOtherCompleted, fmt.Sprintf("%s completed, %s is planning", other.Username, user.Username), comparison.OtherCompleted},
+	}
+
+	current := sections[0]
+	for _, s := range sections {
+		if s.section == section {
+			current = s
+		}
+	}
+
+	perPage := database.UserMediaPageSize
+	pages := (len(current.entries) + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		page = pages
+	}
+
+	var sb strings.Builder
+	if comparison.Affinity != nil {
+		sb.WriteString(fmt.Sprintf("**Affinity: %.0f%%** from %d %s you both scored", *comparison.Affinity*100, comparison.Scored, kind))
+	} else {
+		sb.WriteString(fmt.Sprintf("Not enough scores for an affinity yet, it needs %d %s you both scored (%d so far).", database.MinAffinityEntries, kind, comparison.Scored))
+	}
+	sb.WriteString(fmt.Sprintf("\n\n**%s**\n", current.label))
+
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > len(current.entries) {
+		end = len(current.entries)
+	}
+
+	if start >= end {
+		sb.WriteString("Nothing here yet.")
+	}
+
+	for i, entry := range current.entries[start:end] {
+		mediaTitle := "*Unavailable media*"
+		if entry.Media != nil {
+			mediaTitle = entry.Media.GetTitle()
+		}
+
+		// both scores where they are compared, the score of whoever completed it otherwise
+		scoreText := ""
+		switch current.section {
+		case CompareDisagreements, compareAgreements:
+			scoreText = fmt.Sprintf(" - **%s** vs **%s**", format.String(entry.User.Score), format.String(entry.Other.Score))
+		case compareUserCompleted:
+			if entry.User.Scored() {
+				scoreText = fmt.Sprintf(" - **%s**", format.String(entry.User.Score))
+			}
+		case compareOtherCompleted:
+			if entry.Other.Scored() {
+				scoreText = fmt.Sprintf(" - **%s**", format.String(entry.Other.Score))
+			}
+		}
+
+		sb.WriteString(fmt.Sprintf("%d. %s%s\n", start+i+1, mediaTitle, scoreText))
+	}
+
+	embed := discord.NewEmbedBuilder().
+		SetTitle(fmt.Sprintf("%s vs %s: %s", user.Username, other.Username, title)).
+		SetColor(0xFF4081).
+		SetDescription(sb.String()).
+		SetFooterText(fmt.Sprintf("Page %d of %d • %d shared %s", page, pages, comparison.Shared, kind))
+
+	options := []discord.StringSelectMenuOption{}
+	for _, s := range sections {
+		option := discord.NewStringSelectMenuOption(
+			fmt.Sprintf("%s (%d)", s.label, len(s.entries)),
+			customid.Encode(&customid.CompareOption{Section: s.section}),
+		).WithDefault(s.section == current.section)
+		options = append(options, option)
+	}
+
+	msg := discord.NewMessageUpdateBuilder().
+		SetEmbeds(embed.Build()).
+		AddActionRow(discord.NewStringSelectMenu(
+			customid.Encode(&customid.CompareMenu{OwnerID: user.ID, OtherID: other.ID, MediaType: comparison.MediaType}),
+			"Compare something else",
+			options...,
+		))
+
+	navigationComponents := []discord.InteractiveComponent{}
+	if page > 1 {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Prev", customid.Encode(&customid.ComparePage{OwnerID: user.ID, OtherID: other.ID, MediaType: comparison.MediaType, Section: current.section, Page: page - 1})))
+	}
+	if page < pages {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Next", customid.Encode(&customid.ComparePage{OwnerID: user.ID, OtherID: other.ID, MediaType: comparison.MediaType, Section: current.section, Page: page + 1})))
+	}
+	if len(navigationComponents) > 0 {
+		msg.AddActionRow(navigationComponents...)
+	}
+
+	return msg.Build()
+}
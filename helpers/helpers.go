@@ -1,16 +1,44 @@
 package helpers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"ipmanlk/saika/customid"
 	"ipmanlk/saika/database"
+	"ipmanlk/saika/listview"
+	"ipmanlk/saika/score"
 	"ipmanlk/saika/structs"
 	"log"
-	"math"
 	"strings"
+	"time"
 
 	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Discord accepts responses and followups for an interaction for 15 minutes.
+const interactionLifetime = 15 * time.Minute
+
+// InteractionContext returns a context that expires together with the interaction token,
+// so no work outlives the point where its result could still be sent to the user.
+func InteractionContext(interaction discord.Interaction) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(context.Background(), interaction.CreatedAt().Add(interactionLifetime))
+}
+
+// GetScoreFormat returns the format a user picked for scores. Scores are still worth
+// showing when the settings can't be read, so errors give the default format.
+func GetScoreFormat(ctx context.Context, userID snowflake.ID) score.Format {
+	settings, err := database.GetUserSettings(ctx, userID)
+	if err != nil {
+		log.Printf("Error while getting user settings: %v", err)
+		return score.DefaultFormat
+	}
+
+	return settings.ScoreFormat
+}
+
 func GetErrorEmbed(message string) *[]discord.Embed {
 	embed := discord.NewEmbedBuilder()
 	embed.SetColor(0xFF4500)
@@ -21,6 +49,24 @@ func GetErrorEmbed(message string) *[]discord.Embed {
 	}
 }
 
+// GetDatabaseErrorEmbed is GetErrorEmbed for failed database calls; timeouts get their own message.
+func GetDatabaseErrorEmbed(err error, message string) *[]discord.Embed {
+	if errors.Is(err, database.ErrTimeout) {
+		return GetErrorEmbed("The database is taking too long to respond, please try again in a moment.")
+	}
+
+	return GetErrorEmbed(message)
+}
+
+// GetCustomIDErrorEmbed explains why a component's custom ID could not be used.
+func GetCustomIDErrorEmbed(err error) *[]discord.Embed {
+	if errors.Is(err, customid.ErrVersion) {
+		return GetErrorEmbed("This message was made by an older version of the bot, please run the command again.")
+	}
+
+	return GetErrorEmbed("This component is not valid anymore, please run the command again.")
+}
+
 func GetDefaultEmbed(message string) *[]discord.Embed {
 	embed := discord.NewEmbedBuilder()
 	embed.SetColor(0x7B1FA2)
@@ -32,15 +78,14 @@ func GetDefaultEmbed(message string) *[]discord.Embed {
 }
 
 func GetMediaSearchMessage(
-	results *[]structs.AnilistMedia,
+	media *structs.AnilistMedia,
 	page int,
-	searchQueryID string,
-	userID string,
+	pages int,
+	searchQueryID primitive.ObjectID,
+	userID snowflake.ID,
 	mediaType string,
 ) discord.MessageUpdate {
 
-	media := (*results)[page-1]
-	pages := len(*results)
 	isAnime := mediaType == "ANIME"
 
 	msg := discord.NewMessageUpdateBuilder()
@@ -68,7 +113,7 @@ func GetMediaSearchMessage(
 	embed.AddField("Genres", media.GetGenres(), false)
 	embed.AddField("Tags", media.GetTags(), false)
 
-	if len(*results) > 2 {
+	if pages > 2 {
 		embed.SetFooterText(fmt.Sprintf("Page %d of %d", page, pages))
 	}
 
@@ -81,25 +126,25 @@ func GetMediaSearchMessage(
 	}
 
 	selectMenuOptions := []discord.StringSelectMenuOption{}
-	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Planning", fmt.Sprintf("sm_media_action/%d/PLANNING", media.IdAnilist)))
+	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Planning", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "PLANNING"})))
 
 	if isAnime {
-		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Watching", fmt.Sprintf("sm_media_action/%d/CURRENT", media.IdAnilist)))
+		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Watching", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "CURRENT"})))
 	} else {
-		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Reading", fmt.Sprintf("sm_media_action/%d/CURRENT", media.IdAnilist)))
+		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Reading", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "CURRENT"})))
 	}
 
-	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Completed", fmt.Sprintf("sm_media_action/%d/COMPLETED", media.IdAnilist)))
-	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Paused", fmt.Sprintf("sm_media_action/%d/PAUSED", media.IdAnilist)))
-	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Dropped", fmt.Sprintf("sm_media_action/%d/DROPPED", media.IdAnilist)))
+	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Completed", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "COMPLETED"})))
+	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Paused", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "PAUSED"})))
+	selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Dropped", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "DROPPED"})))
 
 	if isAnime {
-		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Repeating", fmt.Sprintf("sm_media_action/%d/REPEATING", media.IdAnilist)))
+		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Repeating", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "REPEATING"})))
 	} else {
-		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Rereading", fmt.Sprintf("sm_media_action/%d/REPEATING", media.IdAnilist)))
+		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption("Add to Rereading", customid.Encode(&customid.MediaActionOption{IdAnilist: media.IdAnilist, Status: "REPEATING"})))
 	}
 
-	selectMenu := discord.NewStringSelectMenu("sm_media_action", selectMenuPlaceholder,
+	selectMenu := discord.NewStringSelectMenu(customid.Encode(&customid.MediaActionMenu{}), selectMenuPlaceholder,
 		selectMenuOptions...,
 	)
 
@@ -107,43 +152,59 @@ func GetMediaSearchMessage(
 		selectMenu,
 	)
 
+	// anyone can favourite the media shown, it goes to the favourites of whoever clicks
+	favouriteButton := discord.NewSecondaryButton("Favourite", customid.Encode(&customid.FavouriteButton{Origin: "search", IdAnilist: media.IdAnilist, Prev: customid.ListPosition{Page: 1}}))
+
 	if pages == 1 {
+		msg.AddActionRow(favouriteButton)
 		return msg.Build()
 	}
 
 	navigationComponents := []discord.InteractiveComponent{}
 
 	if page > 1 {
-		prevButton := discord.NewPrimaryButton("Prev", fmt.Sprintf("btn_media_results/%s/%s/pages/%d", userID, searchQueryID, page-1))
+		prevButton := discord.NewPrimaryButton("Prev", customid.Encode(&customid.MediaResultsPage{OwnerID: userID, SearchQueryID: searchQueryID, Page: page - 1}))
 		navigationComponents = append(navigationComponents, prevButton)
 	}
 
 	if page < pages {
-		prevButton := discord.NewPrimaryButton("Next", fmt.Sprintf("btn_media_results/%s/%s/pages/%d", userID, searchQueryID, page+1))
+		prevButton := discord.NewPrimaryButton("Next", customid.Encode(&customid.MediaResultsPage{OwnerID: userID, SearchQueryID: searchQueryID, Page: page + 1}))
 		navigationComponents = append(navigationComponents, prevButton)
 	}
 
+	navigationComponents = append(navigationComponents, favouriteButton)
 	msg.AddActionRow(navigationComponents...)
 
 	return msg.Build()
 }
 
-func GetInitialMediaListMessage(user discord.User, mediaType string) discord.MessageUpdate {
-	userMedia, err := database.GetAllUserMedia(user.ID, mediaType, "")
+// LoadInitialMediaListMessage loads the status and custom list counts of a user and
+// builds the list overview from them, as seen by viewerID.
+func LoadInitialMediaListMessage(ctx context.Context, user discord.User, viewerID snowflake.ID, mediaType string) (discord.MessageUpdate, error) {
+	mediaCounts, err := database.CountUserMediaByStatus(ctx, user.ID, mediaType)
 	if err != nil {
-		log.Printf("Error getting user media: %s", err.Error())
-		return discord.MessageUpdate{
-			Embeds: GetErrorEmbed("Error getting user media"),
-		}
+		return discord.MessageUpdate{}, err
+	}
+
+	lists, err := database.GetUserLists(ctx, user.ID, mediaType)
+	if err != nil {
+		return discord.MessageUpdate{}, err
 	}
 
-	if userMedia == nil {
-		userMedia = []structs.UserMedia{}
+	listCounts, err := database.CountUserMediaByList(ctx, user.ID, mediaType)
+	if err != nil {
+		return discord.MessageUpdate{}, err
 	}
 
-	mediaCounts := map[string]int{"PLANNING": 0, "CURRENT": 0, "COMPLETED": 0, "PAUSED": 0, "DROPPED": 0, "REPEATING": 0}
-	for _, media := range userMedia {
-		mediaCounts[media.Status]++
+	return GetInitialMediaListMessage(user, viewerID, mediaType, mediaCounts, lists, listCounts), nil
+}
+
+// GetInitialMediaListMessage builds the list overview of user from the entry count of each
+// status and custom list, as seen by viewerID.
+func GetInitialMediaListMessage(user discord.User, viewerID snowflake.ID, mediaType string, mediaCounts map[string]int, lists []structs.UserList, listCounts map[primitive.ObjectID]int) discord.MessageUpdate {
+	totalCount := 0
+	for _, count := range mediaCounts {
+		totalCount += count
 	}
 
 	isAnime := mediaType == "ANIME"
@@ -154,9 +215,14 @@ func GetInitialMediaListMessage(user discord.User, mediaType string) discord.Mes
 
 	readableMediaType := strings.Title(strings.ToLower(mediaType))
 
+	description := fmt.Sprintf("You have %d %s in your lists", totalCount, readableMediaType)
+	if user.ID != viewerID {
+		description = fmt.Sprintf("%s has %d %s in their lists", user.Username, totalCount, readableMediaType)
+	}
+
 	embed := discord.NewEmbedBuilder().
 		SetTitle(fmt.Sprintf("%s's %s List", user.Username, readableMediaType)).
-		SetDescription(fmt.Sprintf("You have %d %s in your lists", len(userMedia), readableMediaType)).
+		SetDescription(description).
 		SetColor(0xFF4081).
 		SetImage("https://i.imgur.com/GArVV8M.jpg").
 		AddField("Planning", fmt.Sprintf("%d", mediaCounts["PLANNING"]), true).
@@ -166,11 +232,19 @@ func GetInitialMediaListMessage(user discord.User, mediaType string) discord.Mes
 		AddField("Dropped", fmt.Sprintf("%d", mediaCounts["DROPPED"]), true).
 		AddField(repeatingStatus, fmt.Sprintf("%d", mediaCounts["REPEATING"]), true)
 
+	if len(lists) > 0 {
+		listLines := make([]string, len(lists))
+		for i, list := range lists {
+			listLines[i] = fmt.Sprintf("%s: %d", list.Name, listCounts[list.ID])
+		}
+		embed.AddField("Custom Lists", strings.Join(listLines, "\n"), false)
+	}
+
 	selectMenuPlaceholder := fmt.Sprintf("View %s lists", strings.ToLower(mediaType))
 	selectMenuOptions := []discord.StringSelectMenuOption{}
 
-	for status, count := range mediaCounts {
-		if count == 0 {
+	for _, status := range []string{"PLANNING", "CURRENT", "COMPLETED", "PAUSED", "DROPPED", "REPEATING"} {
+		if mediaCounts[status] == 0 {
 			continue
 		}
 
@@ -184,44 +258,74 @@ func GetInitialMediaListMessage(user discord.User, mediaType string) discord.Mes
 			menuOptionLabel = fmt.Sprintf("View %s", strings.Title(strings.ToLower(repeatingStatus)))
 		}
 
-		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption(menuOptionLabel, fmt.Sprintf("sm_media_lists/%s/%s", mediaType, status)))
+		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption(menuOptionLabel, customid.Encode(&customid.MediaListsOption{UserID: user.ID, MediaType: mediaType, Status: status})))
+	}
+
+	// custom lists open the same way, empty ones are left out like empty statuses
+	for _, list := range lists {
+		if listCounts[list.ID] == 0 {
+			continue
+		}
+
+		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption(fmt.Sprintf("View %s", list.Name), customid.Encode(&customid.MediaListsOption{UserID: user.ID, MediaType: mediaType, ListID: list.ID})))
 	}
 
 	mb := discord.NewMessageUpdateBuilder().
 		SetEmbeds(embed.Build())
 
 	if len(selectMenuOptions) > 0 {
-		mb.AddActionRow(discord.NewStringSelectMenu("sm_media_lists", selectMenuPlaceholder, selectMenuOptions...))
+		mb.AddActionRow(discord.NewStringSelectMenu(customid.Encode(&customid.MediaListsMenu{}), selectMenuPlaceholder, selectMenuOptions...))
 	}
 
 	return mb.Build()
 }
 
-func GetMediaListMessage(user discord.User, userMedia *[]structs.UserMedia, page int) discord.MessageUpdate {
-	userMediaSlice := *userMedia
-	userMediaType := userMediaSlice[0].MediaType
-	userMediaStatus := userMediaSlice[0].Status
-	userMediaFormattedStatus := userMediaSlice[0].GetStatus()
-	pages := int(math.Ceil(float64(len(userMediaSlice)) / 10))
+// GetMediaListMessage builds one page of a status list of user, or of the custom list list
+// when it isn't nil, with scores in the viewer's format. The page must have its media
+// loaded and be sorted and filtered by view, whose controls are shown under it. Only
+// user's own pages let them open the entries.
+func GetMediaListMessage(user discord.User, viewerID snowflake.ID, mediaType string, status string, list *structs.UserList, listPage *structs.UserMediaPage, view listview.View, format score.Format) discord.MessageUpdate {
+	userMediaSlice := listPage.Entries
+	page := listPage.Page
+	pages := listPage.Pages()
+
+	listEntry := structs.UserMedia{MediaType: mediaType, Status: status}
+	title := fmt.Sprintf("%s's %s %s List", user.Username, listEntry.GetStatus(), listEntry.GetType())
+	listID := primitive.NilObjectID
+
+	if list != nil {
+		title = fmt.Sprintf("%s's %s", user.Username, list.Name)
+		status, listID = "", list.ID
+	}
+
+	footer := fmt.Sprintf("Page %d of %d", page, pages)
+	if view.GetSort() != listview.DefaultSort {
+		footer += " • Sorted by " + view.GetSort().Label()
+	}
+	if view.Filtered() {
+		footer += fmt.Sprintf(" • %d matching", listPage.Total)
+	}
 
 	embed := discord.NewEmbedBuilder().
-		SetTitle(fmt.Sprintf("%s's %s %s List", user.Username, userMediaFormattedStatus, userMediaSlice[0].GetType())).
+		SetTitle(title).
 		SetColor(0xFF4081).
-		SetFooterText(fmt.Sprintf("Page %d of %d", page, pages))
+		SetFooterText(footer)
 
-	selectMenuPlaceholder := map[bool]string{true: "Select anime to view", false: "Select manga to view"}[userMediaType == "ANIME"]
+	selectMenuPlaceholder := map[bool]string{true: "Select anime to view", false: "Select manga to view"}[mediaType == "ANIME"]
 	selectMenuOptions := []discord.StringSelectMenuOption{}
 	var descEntries []string
 
-	for i := (page - 1) * 10; i < page*10 && i < len(userMediaSlice); i++ {
-		u := userMediaSlice[i]
-		media, err := database.GetMediaByObjectID(u.MediaID)
-		if err != nil {
-			log.Printf("Error getting media by ID: %s", err.Error())
+	for i, u := range userMediaSlice {
+		position := (page-1)*listPage.PerPage + i + 1
+		if u.Media == nil {
+			// the entry is kept in the numbering so positions match the other pages
+			descEntries = append(descEntries, fmt.Sprintf("%d. *Unavailable media*", position))
 			continue
 		}
-		scoreText := map[bool]string{true: fmt.Sprintf(" - **%d/10**", u.Score), false: ""}[u.Score > 0]
-		descEntries = append(descEntries, fmt.Sprintf("%d. %s%s", i+1, media.GetTitle(), scoreText))
+		media := u.Media
+
+		scoreText := map[bool]string{true: fmt.Sprintf(" - **%s**", format.String(u.Score)), false: ""}[u.Scored()]
+		descEntries = append(descEntries, fmt.Sprintf("%d. %s%s", position, media.GetTitle(), scoreText))
 
 		selectMenuMediaTitle := func(title string) string {
 			if len(title) > 80 {
@@ -231,35 +335,122 @@ func GetMediaListMessage(user discord.User, userMedia *[]structs.UserMedia, page
 		}(media.GetTitle())
 
 		selectMenuOptions = append(selectMenuOptions, discord.NewStringSelectMenuOption(
-			fmt.Sprintf("%d. %s", i+1, selectMenuMediaTitle),
-			fmt.Sprintf("%s/%d", u.ID.Hex(), page),
+			fmt.Sprintf("%d. %s", position, selectMenuMediaTitle),
+			customid.Encode(&customid.MediaListOption{UserMediaID: u.ID, Prev: customid.ListPosition{ListID: listID, Page: page, View: view}}),
 		))
 	}
 
+	if len(descEntries) == 0 {
+		descEntries = append(descEntries, "No entries match these filters.")
+	}
+
 	msg := discord.NewMessageUpdateBuilder().
-		SetEmbeds(embed.SetDescription(strings.Join(descEntries, "\n")).Build()).
-		AddActionRow(discord.NewStringSelectMenu("sm_media_list", selectMenuPlaceholder, selectMenuOptions...))
+		SetEmbeds(embed.SetDescription(strings.Join(descEntries, "\n")).Build())
+
+	if len(selectMenuOptions) > 0 && user.ID == viewerID {
+		msg.AddActionRow(discord.NewStringSelectMenu(customid.Encode(&customid.MediaListMenu{}), selectMenuPlaceholder, selectMenuOptions...))
+	}
+
+	for _, menu := range getListViewMenus(user.ID, mediaType, status, listID, view) {
+		msg.AddActionRow(menu)
+	}
+
+	// the back button shares the row with the page buttons, the view controls take the others
+	navigationComponents := []discord.InteractiveComponent{}
+	if page > 1 {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Prev", customid.Encode(&customid.MediaListPage{UserID: user.ID, MediaType: mediaType, Status: status, ListID: listID, Page: page - 1, View: view})))
+	}
+	if page < pages {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Next", customid.Encode(&customid.MediaListPage{UserID: user.ID, MediaType: mediaType, Status: status, ListID: listID, Page: page + 1, View: view})))
+	}
+	navigationComponents = append(navigationComponents, discord.NewSecondaryButton("Back to lists", customid.Encode(&customid.MediaListsButton{UserID: user.ID, MediaType: mediaType})))
+	msg.AddActionRow(navigationComponents...)
+
+	return msg.Build()
+}
+
+// getListViewMenus builds the sort, genre and filter select menus of a list page of the
+// user userID. Every option is the view the page changes to when it is picked.
+func getListViewMenus(userID snowflake.ID, mediaType string, status string, listID primitive.ObjectID, view listview.View) []discord.StringSelectMenuComponent {
+	menuID := func(control string) string {
+		return customid.Encode(&customid.MediaListViewMenu{Control: control, UserID: userID, MediaType: mediaType, Status: status, ListID: listID})
+	}
+	option := func(label string, view listview.View) discord.StringSelectMenuOption {
+		return discord.NewStringSelectMenuOption(label, customid.Encode(&customid.MediaListViewOption{View: view}))
+	}
+
+	sortOptions := []discord.StringSelectMenuOption{}
+	for _, sort := range listview.Sorts {
+		sorted := view
+		sorted.Sort = sort
+		sortOptions = append(sortOptions, option("Sort by "+sort.Label(), sorted).WithDefault(sort == view.GetSort()))
+	}
+
+	anyGenre := view
+	anyGenre.Genre = ""
+	genreOptions := []discord.StringSelectMenuOption{option("Any genre", anyGenre)}
+	for _, genre := range listview.Genres {
+		withGenre := view
+		withGenre.Genre = genre
+		genreOptions = append(genreOptions, option(genre, withGenre).WithDefault(genre == view.Genre))
+	}
 
-	if navigationComponents := func() []discord.InteractiveComponent {
-		nc := []discord.InteractiveComponent{}
-		if page > 1 {
-			nc = append(nc, discord.NewPrimaryButton("Prev", fmt.Sprintf("btn_media_list/%s/%s/%d", userMediaType, userMediaStatus, page-1)))
+	// filters are toggled one at a time, the active ones are marked
+	toggleOption := func(label string, active bool, view listview.View) discord.StringSelectMenuOption {
+		if active {
+			return option("✓ "+label, view).WithDescription("Pick again to remove this filter")
 		}
-		if page < pages {
-			nc = append(nc, discord.NewPrimaryButton("Next", fmt.Sprintf("btn_media_list/%s/%s/%d", userMediaType, userMediaStatus, page+1)))
+		return option(label, view)
+	}
+
+	filterOptions := []discord.StringSelectMenuOption{}
+	for _, mediaFormat := range listview.FormatsFor(mediaType) {
+		filterOptions = append(filterOptions, toggleOption("Format: "+structs.GetFormatLabel(mediaFormat), view.HasFormat(mediaFormat), view.ToggleFormat(mediaFormat)))
+	}
+	for _, mediaStatus := range listview.Statuses {
+		filterOptions = append(filterOptions, toggleOption("Status: "+structs.GetMediaStatusLabel(mediaStatus), view.HasStatus(mediaStatus), view.ToggleStatus(mediaStatus)))
+	}
+
+	for _, scored := range []listview.Scored{listview.ScoredYes, listview.ScoredNo} {
+		toggled := view
+		toggled.Scored = scored
+		if view.Scored == scored {
+			toggled.Scored = listview.ScoredAny
 		}
-		return nc
-	}(); len(navigationComponents) > 0 {
-		msg.AddActionRow(navigationComponents...)
+		label := map[listview.Scored]string{listview.ScoredYes: "Scored only", listview.ScoredNo: "Unscored only"}[scored]
+		filterOptions = append(filterOptions, toggleOption(label, view.Scored == scored, toggled))
+	}
+
+	// with a single filter, removing it is the same option as clearing them all
+	if cleared := option("Clear all filters", view.ClearFilters()); view.Filtered() && !hasOptionValue(filterOptions, cleared.Value) {
+		filterOptions = append(filterOptions, cleared)
 	}
 
-	// add back to list button
-	msg.AddActionRow(discord.NewSecondaryButton("Back to lists", fmt.Sprintf("btn_media_lists/%s", userMediaType)))
+	filterPlaceholder := "Filter by format, status or score"
+	if view.Filtered() {
+		filterPlaceholder = "Filters are active"
+	}
 
-	return msg.Build()
+	return []discord.StringSelectMenuComponent{
+		discord.NewStringSelectMenu(menuID("sort"), "Sort by "+view.GetSort().Label(), sortOptions...),
+		discord.NewStringSelectMenu(menuID("genre"), "Filter by genre", genreOptions...),
+		discord.NewStringSelectMenu(menuID("filter"), filterPlaceholder, filterOptions...),
+	}
+}
+
+func hasOptionValue(options []discord.StringSelectMenuOption, value string) bool {
+	for _, option := range options {
+		if option.Value == value {
+			return true
+		}
+	}
+	return false
 }
 
-func GetListMediaMessage(media *structs.AnilistMedia, userMedia *structs.UserMedia, prevPage int) discord.MessageUpdate {
+// GetListMediaMessage shows a list entry opened from the list page prev. lists are the
+// user's custom lists for the media type, the entry can be put on them from here.
+// favourite tells whether the media is one of the user's favourites.
+func GetListMediaMessage(media *structs.AnilistMedia, userMedia *structs.UserMedia, prev customid.ListPosition, format score.Format, lists []structs.UserList, favourite bool) discord.MessageUpdate {
 	userMediaType := userMedia.MediaType
 	userMediaStatus := userMedia.Status
 
@@ -284,20 +475,211 @@ func GetListMediaMessage(media *structs.AnilistMedia, userMedia *structs.UserMed
 
 	embed.AddField("Your Status", userMedia.GetStatus(), true)
 
-	if userMedia.Score > 0 {
-		embed.AddField("Your Score", fmt.Sprintf("%d/10", userMedia.Score), true)
+	if userMedia.Scored() {
+		embed.AddField("Your Score", format.String(userMedia.Score), true)
+	}
+
+	if userMedia.Note != "" {
+		embed.AddField("Your Note", closeSpoilers(userMedia.Note), false)
 	}
 
-	rateButton := discord.NewSuccessButton("Rate", fmt.Sprintf("btn_rate/list/%s/%d/%d", media.Type, media.IdAnilist, prevPage))
-	deleteButton := discord.NewDangerButton("Remove from list", fmt.Sprintf("btn_delete/%s/%s/%s/%d", userMedia.Status, userMedia.ID.Hex(), media.Type, prevPage))
+	if len(userMedia.Tags) > 0 {
+		embed.AddField("Your Tags", strings.Join(userMedia.Tags, ", "), false)
+	}
+
+	total := media.GetProgressTotal()
+	unit := "episode"
+
+	if isAnime {
+		embed.AddField("Your Progress", formatProgress(userMedia.Progress, total, "episodes"), true)
+	} else {
+		unit = "chapter"
+		embed.AddField("Your Progress", formatProgress(userMedia.Progress, total, "chapters"), true)
+		embed.AddField("Volumes Read", formatProgress(userMedia.ProgressVolumes, media.Volumes, "volumes"), true)
+	}
+
+	if userMedia.StartedAt != nil {
+		embed.AddField("Started", userMedia.StartedAt.String(), true)
+	}
+
+	if userMedia.CompletedAt != nil {
+		embed.AddField("Completed", userMedia.CompletedAt.String(), true)
+	}
 
-	backButton := discord.NewSecondaryButton("Back to list", fmt.Sprintf("btn_media_list/%s/%s/%d", userMediaType, userMediaStatus, prevPage))
+	if userMedia.Repeat > 0 {
+		repeatLabel := "Times Rewatched"
+		if !isAnime {
+			repeatLabel = "Times Reread"
+		}
+		embed.AddField(repeatLabel, fmt.Sprintf("%d", userMedia.Repeat), true)
+	}
+
+	finished := total > 0 && userMedia.Progress >= total
+
+	progressButton := discord.NewPrimaryButton("+1", customid.Encode(&customid.ProgressButton{UserMediaID: userMedia.ID, Prev: prev})).
+		WithDisabled(finished)
+	setProgressButton := discord.NewSecondaryButton("Set progress", customid.Encode(&customid.SetProgressButton{UserMediaID: userMedia.ID, MediaType: userMediaType, Prev: prev}))
+
+	progressComponents := []discord.InteractiveComponent{progressButton, setProgressButton}
+
+	// prompt to complete entries that reached the last episode/chapter
+	if finished && userMediaStatus != "COMPLETED" {
+		embed.SetDescription(fmt.Sprintf("You've reached the last %s. Mark it as completed?", unit))
+		completeButton := discord.NewSuccessButton("Mark as completed", customid.Encode(&customid.CompleteButton{UserMediaID: userMedia.ID, Prev: prev}))
+		progressComponents = append(progressComponents, completeButton)
+	}
+
+	rateButton := discord.NewSuccessButton("Rate", customid.Encode(&customid.RateButton{Origin: "list", MediaType: media.Type, IdAnilist: media.IdAnilist, Prev: prev}))
+	favouriteLabel := "Favourite"
+	if favourite {
+		favouriteLabel = "Unfavourite"
+	}
+	favouriteButton := discord.NewSecondaryButton(favouriteLabel, customid.Encode(&customid.FavouriteButton{Origin: "list", IdAnilist: media.IdAnilist, Prev: prev}))
+	historyButton := discord.NewSecondaryButton("Edit dates", customid.Encode(&customid.HistoryButton{UserMediaID: userMedia.ID, Prev: prev}))
+	tagsButton := discord.NewSecondaryButton("Edit tags", customid.Encode(&customid.TagsButton{UserMediaID: userMedia.ID, Prev: prev}))
+	deleteButton := discord.NewDangerButton("Remove from list", customid.Encode(&customid.DeleteButton{Status: userMedia.Status, UserMediaID: userMedia.ID, MediaType: media.Type, Prev: prev}))
+
+	// entries opened from a status list go back to the list of their current status
+	backPage := customid.MediaListPage{UserID: userMedia.UserID, MediaType: userMediaType, Status: userMediaStatus, Page: prev.Page, View: prev.View}
+	if !prev.ListID.IsZero() {
+		backPage.Status, backPage.ListID = "", prev.ListID
+	}
+	backButton := discord.NewSecondaryButton("Back to list", customid.Encode(&backPage))
 
 	msg := discord.NewMessageUpdateBuilder().
 		SetEmbeds(embed.Build()).
-		AddActionRow(rateButton, deleteButton).
-		AddActionRow(backButton).
-		Build()
+		AddActionRow(progressComponents...).
+		AddActionRow(rateButton, favouriteButton, historyButton, tagsButton, deleteButton)
+
+	if len(lists) > 0 {
+		listOptions := make([]discord.StringSelectMenuOption, len(lists))
+		for i, list := range lists {
+			listOptions[i] = discord.NewStringSelectMenuOption(list.Name, customid.Encode(&customid.EntryListsOption{ListID: list.ID})).
+				WithDefault(userMedia.OnList(list.ID))
+		}
+
+		listsMenu := discord.NewStringSelectMenu(customid.Encode(&customid.EntryListsMenu{UserMediaID: userMedia.ID, Prev: prev}), "Add to custom lists", listOptions...).
+			WithMinValues(0).
+			WithMaxValues(len(listOptions))
+		msg.AddActionRow(listsMenu)
+	}
+
+	return msg.AddActionRow(backButton).Build()
+}
+
+// GetFavouritesMessage lists a user's favourites of a media type in their order.
+func GetFavouritesMessage(user discord.User, mediaType string, favourites []structs.FavouriteEntry) discord.MessageUpdate {
+	kind, title := "anime", "Anime"
+	if mediaType == "MANGA" {
+		kind, title = "manga", "Manga"
+	}
+
+	if len(favourites) == 0 {
+		return discord.MessageUpdate{
+			Embeds: GetDefaultEmbed(fmt.Sprintf("%s hasn't added any favourite %s yet.", user.Username, kind)),
+		}
+	}
+
+	var sb strings.Builder
+	for i, favourite := range favourites {
+		if favourite.Media != nil && favourite.Media.SiteUrl != "" {
+			sb.WriteString(fmt.Sprintf("%d. [%s](%s)\n", i+1, favourite.GetTitle(), favourite.Media.SiteUrl))
+		} else {
+			sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, favourite.GetTitle()))
+		}
+	}
+
+	embed := discord.NewEmbedBuilder().
+		SetTitle(fmt.Sprintf("%s's Favourite %s", user.Username, title)).
+		SetColor(0xFF4081).
+		SetDescription(sb.String()).
+		SetFooterText("Reorder them with /favourites move")
+
+	// the first favourite is the cover of the list
+	if favourites[0].Media != nil {
+		embed.SetThumbnail(favourites[0].Media.CoverImage.Large)
+	}
+
+	return discord.MessageUpdate{
+		Embeds: &[]discord.Embed{embed.Build()},
+	}
+}
+
+// formatProgress shows progress out of total (ex, "7/12 episodes"), leaving out
+// totals that aren't known yet.
+func formatProgress(progress int, total int, unit string) string {
+	if total > 0 {
+		return fmt.Sprintf("%d/%d %s", progress, total, unit)
+	}
+	return fmt.Sprintf("%d %s", progress, unit)
+}
+
+// GetReviewsMessage shows one page of a user's reviews, paged by the user who ran /reviews.
+// Scores are shown in that user's format.
+func GetReviewsMessage(user discord.User, ownerID snowflake.ID, reviewsPage *structs.UserMediaPage, format score.Format) discord.MessageUpdate {
+	if reviewsPage.Total == 0 {
+		return discord.MessageUpdate{
+			Embeds:     GetDefaultEmbed(fmt.Sprintf("%s hasn't written any reviews yet.", user.Username)),
+			Components: &[]discord.ContainerComponent{},
+		}
+	}
+
+	entry := reviewsPage.Entries[0]
+	page := reviewsPage.Page
+	pages := reviewsPage.Pages()
+
+	embed := discord.NewEmbedBuilder().
+		SetAuthorName(fmt.Sprintf("%s's Reviews", user.Username)).
+		SetColor(0xFF4081).
+		SetDescription(closeSpoilers(entry.Review)).
+		SetFooterText(fmt.Sprintf("Review %d of %d", page, pages))
+
+	if entry.Media != nil {
+		embed.SetTitle(entry.Media.GetTitle())
+		embed.SetURL(entry.Media.SiteUrl)
+		embed.SetThumbnail(entry.Media.CoverImage.Large)
+	} else {
+		embed.SetTitle("Unavailable media")
+	}
+
+	if entry.Scored() {
+		embed.AddField("Score", format.String(entry.Score), true)
+	}
+
+	embed.AddField("Status", entry.GetStatus(), true)
+	embed.AddField("Written", fmt.Sprintf("<t:%d:D>", entry.ReviewCreatedAt.Unix()), true)
+
+	if entry.ReviewUpdatedAt.After(entry.ReviewCreatedAt) {
+		embed.AddField("Edited", fmt.Sprintf("<t:%d:D>", entry.ReviewUpdatedAt.Unix()), true)
+	}
+
+	msg := discord.NewMessageUpdateBuilder().
+		SetEmbeds(embed.Build())
+
+	navigationComponents := []discord.InteractiveComponent{}
+
+	if page > 1 {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Prev", customid.Encode(&customid.ReviewsPage{OwnerID: ownerID, UserID: user.ID, Page: page - 1})))
+	}
+
+	if page < pages {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Next", customid.Encode(&customid.ReviewsPage{OwnerID: ownerID, UserID: user.ID, Page: page + 1})))
+	}
+
+	if len(navigationComponents) > 0 {
+		msg.AddActionRow(navigationComponents...)
+	} else {
+		msg.ClearContainerComponents()
+	}
 
-	return msg
+	return msg.Build()
+}
+
+// closeSpoilers closes a spoiler tag (||text||) left open at the end of user text, so
+// the rest of the text stays hidden instead of showing the bars.
+func closeSpoilers(text string) string {
+	if strings.Count(text, "||")%2 == 1 {
+		return text + "||"
+	}
+	return text
 }
@@ -0,0 +1,204 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"log"
+	"strings"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Members who left a guild are only noticed when a leaderboard is shown, so more of
+// them are loaded than the leaderboard shows.
+const leaderboardCandidates = 2 * database.LeaderboardSize
+
+var leaderboardMedals = []string{"🥇", "🥈", "🥉"}
+
+// A member's place on a leaderboard.
+type leaderboardPlace struct {
+	member discord.Member
+	value  int
+}
+
+// LoadLeaderboardMessage ranks the members of a guild on a leaderboard. Recorded members
+// who left the guild are forgotten on the way.
+func LoadLeaderboardMessage(ctx context.Context, client bot.Client, guildID snowflake.ID, owner discord.User, board structs.Leaderboard) (discord.MessageUpdate, error) {
+	entries, err := database.GetGuildLeaderboard(ctx, guildID, board, leaderboardCandidates)
+	if err != nil {
+		return discord.MessageUpdate{}, err
+	}
+
+	places := []leaderboardPlace{}
+	for _, entry := range entries {
+		if len(places) == database.LeaderboardSize {
+			break
+		}
+
+		member, err := GetGuildMember(ctx, client, guildID, entry.UserID)
+		if err != nil {
+			return discord.MessageUpdate{}, err
+		}
+
+		if member == nil {
+			if err := database.DeleteGuildMember(ctx, guildID, entry.UserID); err != nil {
+				log.Printf("Error forgetting guild member: %v", err)
+			}
+			continue
+		}
+
+		places = append(places, leaderboardPlace{member: *member, value: entry.Value})
+	}
+
+	return getLeaderboardMessage(GetGuildName(client, guildID), owner, board, places), nil
+}
+
+func getLeaderboardMessage(guildName string, owner discord.User, board structs.Leaderboard, places []leaderboardPlace) discord.MessageUpdate {
+	lines := []string{}
+	for i, place := range places {
+		position := fmt.Sprintf("%d.", i+1)
+		if i < len(leaderboardMedals) {
+			position = leaderboardMedals[i]
+		}
+		lines = append(lines, fmt.Sprintf("%s **%s** - %d %s", position, place.member.EffectiveName(), place.value, board.Unit()))
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, "Nobody here yet. Members show up once they have used the bot in this server.")
+	}
+
+	footer := "Members who keep their lists private are left out"
+	if board == structs.LeaderboardActive {
+		footer = "Counts the list entries changed this month • " + footer
+	}
+
+	embed := discord.NewEmbedBuilder().
+		SetTitle(fmt.Sprintf("%s: %s", guildName, board.Label())).
+		SetColor(0xFF4081).
+		SetDescription(strings.Join(lines, "\n")).
+		SetFooterText(footer)
+
+	options := []discord.StringSelectMenuOption{}
+	for _, leaderboard := range structs.Leaderboards {
+		option := discord.NewStringSelectMenuOption(
+			leaderboard.Label(),
+			customid.Encode(&customid.LeaderboardOption{Board: string(leaderboard)}),
+		).WithDefault(leaderboard == board)
+		options = append(options, option)
+	}
+
+	return discord.NewMessageUpdateBuilder().
+		SetEmbeds(embed.Build()).
+		AddActionRow(discord.NewStringSelectMenu(
+			customid.Encode(&customid.LeaderboardMenu{OwnerID: owner.ID}),
+			"Show another leaderboard",
+			options...,
+		)).
+		Build()
+}
+
+// LoadServerTopMedia ranks the media of a type by the scores of a guild's members. The
+// recorded members who weren't seen in a while are checked first, and those who left the
+// guild are forgotten so their scores don't count.
+func LoadServerTopMedia(ctx context.Context, client bot.Client, guildID snowflake.ID, mediaType string, minRatings int) ([]structs.GuildMediaScore, error) {
+	userIDs, err := database.GetUncheckedGuildMembers(ctx, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range userIDs {
+		member, err := GetGuildMember(ctx, client, guildID, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if member == nil {
+			err = database.DeleteGuildMember(ctx, guildID, userID)
+		} else {
+			err = database.SaveGuildMember(ctx, guildID, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return database.GetGuildTopMedia(ctx, guildID, mediaType, minRatings)
+}
+
+// GetServerTopMessage shows one page of a guild's top media, with scores in the format
+// of owner, who is the only one who can page through it.
+func GetServerTopMessage(guildName string, owner discord.User, mediaType string, entries []structs.GuildMediaScore, minRatings int, page int, format score.Format) discord.MessageUpdate {
+	kind := "Anime"
+	if mediaType == "MANGA" {
+		kind = "Manga"
+	}
+
+	perPage := database.UserMediaPageSize
+	pages := (len(entries) + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		page = pages
+	}
+
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	lines := []string{}
+	for i, entry := range entries[start:end] {
+		mediaTitle := "*Unavailable media*"
+		if entry.Media != nil {
+			mediaTitle = entry.Media.GetTitle()
+		}
+
+		ratings := "ratings"
+		if entry.Ratings == 1 {
+			ratings = "rating"
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s - **%s** from %d %s", start+i+1, mediaTitle, format.String(entry.MeanScore()), entry.Ratings, ratings))
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, fmt.Sprintf("No %s has enough ratings from members here yet.", strings.ToLower(kind)))
+	}
+
+	embed := discord.NewEmbedBuilder().
+		SetTitle(fmt.Sprintf("%s: Top %s", guildName, kind)).
+		SetColor(0xFF4081).
+		SetDescription(strings.Join(lines, "\n")).
+		SetFooterText(fmt.Sprintf("Page %d of %d • At least %d ratings each • Private lists are left out", page, pages, minRatings))
+
+	msg := discord.NewMessageUpdateBuilder().
+		SetEmbeds(embed.Build())
+
+	navigationComponents := []discord.InteractiveComponent{}
+	if page > 1 {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Prev", customid.Encode(&customid.ServerTopPage{OwnerID: owner.ID, MediaType: mediaType, MinRatings: minRatings, Page: page - 1})))
+	}
+	if page < pages {
+		navigationComponents = append(navigationComponents, discord.NewPrimaryButton("Next", customid.Encode(&customid.ServerTopPage{OwnerID: owner.ID, MediaType: mediaType, MinRatings: minRatings, Page: page + 1})))
+	}
+	if len(navigationComponents) > 0 {
+		msg.AddActionRow(navigationComponents...)
+	}
+
+	return msg.Build()
+}
+
+// GetGuildName is the name of a guild, from the cache.
+func GetGuildName(client bot.Client, guildID snowflake.ID) string {
+	if guild, ok := client.Caches().Guild(guildID); ok {
+		return guild.Name
+	}
+	return "This server"
+}
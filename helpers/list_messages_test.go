@@ -0,0 +1,408 @@
+package helpers
+
+import (
+	"fmt"
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/listview"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Discord doesn't accept more action rows than this on a message.
+const maxActionRows = 5
+
+var (
+	listOwner  = discord.User{ID: 1000000000000000001, Username: "alice"}
+	listViewer = discord.User{ID: 1000000000000000002, Username: "bob"}
+)
+
+func actionRows(t *testing.T, msg discord.MessageUpdate) []discord.ActionRowComponent {
+	t.Helper()
+
+	if msg.Components == nil {
+		return nil
+	}
+
+	rows := []discord.ActionRowComponent{}
+	for _, component := range *msg.Components {
+		row, ok := component.(discord.ActionRowComponent)
+		if !ok {
+			t.Fatalf("component %T is not an action row", component)
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) > maxActionRows {
+		t.Errorf("message has %d action rows, Discord allows %d", len(rows), maxActionRows)
+	}
+	return rows
+}
+
+// findComponent returns the first component whose custom ID is for the action named name.
+func findComponent(t *testing.T, msg discord.MessageUpdate, name string) discord.InteractiveComponent {
+	t.Helper()
+
+	for _, row := range actionRows(t, msg) {
+		for _, component := range row.Components() {
+			if strings.HasPrefix(component.ID(), name+"/") {
+				return component
+			}
+		}
+	}
+	return nil
+}
+
+func onlyEmbed(t *testing.T, msg discord.MessageUpdate) discord.Embed {
+	t.Helper()
+
+	if msg.Embeds == nil || len(*msg.Embeds) != 1 {
+		t.Fatalf("message has %v embeds, want 1", msg.Embeds)
+	}
+	return (*msg.Embeds)[0]
+}
+
+func testListEntries(count int) []structs.UserMediaEntry {
+	entries := make([]structs.UserMediaEntry, count)
+	for i := range entries {
+		entries[i] = structs.UserMediaEntry{
+			UserMedia: structs.UserMedia{ID: primitive.NewObjectID(), UserID: listOwner.ID, MediaType: "ANIME", Status: "COMPLETED", Score: score.Unscored},
+			Media:     &structs.AnilistMedia{IdAnilist: i + 1, Type: "ANIME", Title: structs.AnilistMediaTitle{Romaji: fmt.Sprintf("Title %d", i+1)}},
+		}
+	}
+	return entries
+}
+
+func TestGetMediaListMessage(t *testing.T) {
+	list := &structs.UserList{ID: primitive.NewObjectID(), Name: "Favourites of 2023"}
+
+	withUnavailable := testListEntries(3)
+	withUnavailable[1].Media = nil
+
+	scored := testListEntries(2)
+	scored[0].Score = 75
+
+	tests := []struct {
+		name       string
+		viewer     discord.User
+		list       *structs.UserList
+		page       structs.UserMediaPage
+		view       listview.View
+		title      string
+		footer     string
+		lines      []string
+		entryMenu  int // options of the entry select menu, 0 when there is none
+		prev, next bool
+		rowsWanted int
+	}{
+		{
+			name:       "first of two pages",
+			viewer:     listOwner,
+			page:       structs.UserMediaPage{Entries: testListEntries(10), Page: 1, PerPage: 10, Total: 15},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 1 of 2",
+			lines:      []string{"1. Title 1", "10. Title 10"},
+			entryMenu:  10,
+			next:       true,
+			rowsWanted: 5,
+		},
+		{
+			name:       "last page numbers on from the previous ones",
+			viewer:     listOwner,
+			page:       structs.UserMediaPage{Entries: testListEntries(5), Page: 2, PerPage: 10, Total: 15},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 2 of 2",
+			lines:      []string{"11. Title 1", "15. Title 5"},
+			entryMenu:  5,
+			prev:       true,
+			rowsWanted: 5,
+		},
+		{
+			name:       "another member's page has no entry menu",
+			viewer:     listViewer,
+			page:       structs.UserMediaPage{Entries: testListEntries(5), Page: 2, PerPage: 10, Total: 25},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 2 of 3",
+			lines:      []string{"11. Title 1"},
+			prev:       true,
+			next:       true,
+			rowsWanted: 4,
+		},
+		{
+			name:       "unavailable media keep their position",
+			viewer:     listOwner,
+			page:       structs.UserMediaPage{Entries: withUnavailable, Page: 1, PerPage: 10, Total: 3},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 1 of 1",
+			lines:      []string{"1. Title 1", "2. *Unavailable media*", "3. Title 3"},
+			entryMenu:  2,
+			rowsWanted: 5,
+		},
+		{
+			name:       "scores in the viewer's format",
+			viewer:     listOwner,
+			page:       structs.UserMediaPage{Entries: scored, Page: 1, PerPage: 10, Total: 2},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 1 of 1",
+			lines:      []string{"1. Title 1 - **8/10**", "2. Title 2"},
+			entryMenu:  2,
+			rowsWanted: 5,
+		},
+		{
+			name:       "sorted and filtered",
+			viewer:     listOwner,
+			page:       structs.UserMediaPage{Entries: testListEntries(3), Page: 1, PerPage: 10, Total: 3},
+			view:       listview.View{Sort: listview.SortTitle, Genre: "Action"},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 1 of 1 • Sorted by " + listview.SortTitle.Label() + " • 3 matching",
+			lines:      []string{"1. Title 1"},
+			entryMenu:  3,
+			rowsWanted: 5,
+		},
+		{
+			name:       "nothing matches",
+			viewer:     listOwner,
+			page:       structs.UserMediaPage{Page: 1, PerPage: 10},
+			view:       listview.View{Genre: "Action"},
+			title:      "alice's Completed Anime List",
+			footer:     "Page 1 of 1 • 0 matching",
+			lines:      []string{"No entries match these filters."},
+			rowsWanted: 4,
+		},
+		{
+			name:       "custom list",
+			viewer:     listViewer,
+			list:       list,
+			page:       structs.UserMediaPage{Entries: testListEntries(2), Page: 1, PerPage: 10, Total: 2},
+			title:      "alice's Favourites of 2023",
+			footer:     "Page 1 of 1",
+			lines:      []string{"1. Title 1"},
+			rowsWanted: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := GetMediaListMessage(listOwner, test.viewer.ID, "ANIME", "COMPLETED", test.list, &test.page, test.view, score.Point10)
+
+			embed := onlyEmbed(t, msg)
+			if embed.Title != test.title {
+				t.Errorf("title = %q, want %q", embed.Title, test.title)
+			}
+			if embed.Footer == nil || embed.Footer.Text != test.footer {
+				t.Errorf("footer = %+v, want %q", embed.Footer, test.footer)
+			}
+			lines := strings.Split(embed.Description, "\n")
+			for _, line := range test.lines {
+				if !containsString(lines, line) {
+					t.Errorf("description %q has no line %q", embed.Description, line)
+				}
+			}
+
+			if rows := actionRows(t, msg); len(rows) != test.rowsWanted {
+				t.Errorf("message has %d action rows, want %d", len(rows), test.rowsWanted)
+			}
+
+			menu := findComponent(t, msg, (&customid.MediaListMenu{}).Name())
+			switch {
+			case test.entryMenu == 0 && menu != nil:
+				t.Errorf("entry menu shown, want none")
+			case test.entryMenu > 0 && menu == nil:
+				t.Errorf("no entry menu, want one with %d options", test.entryMenu)
+			case menu != nil:
+				if options := menu.(discord.StringSelectMenuComponent).Options; len(options) != test.entryMenu {
+					t.Errorf("entry menu has %d options, want %d", len(options), test.entryMenu)
+				}
+			}
+
+			var prev, next bool
+			for _, row := range actionRows(t, msg) {
+				for _, button := range row.Buttons() {
+					prev = prev || button.Label == "Prev"
+					next = next || button.Label == "Next"
+				}
+			}
+			if prev != test.prev || next != test.next {
+				t.Errorf("prev, next buttons = %t, %t, want %t, %t", prev, next, test.prev, test.next)
+			}
+
+			back := findComponent(t, msg, (&customid.MediaListsButton{}).Name())
+			if back == nil {
+				t.Fatal("no button back to the lists")
+			}
+			var backAction customid.MediaListsButton
+			if err := customid.Decode(back.ID(), &backAction); err != nil || backAction.UserID != listOwner.ID {
+				t.Errorf("back button = %+v, %v, want the lists of %d", backAction, err, listOwner.ID)
+			}
+		})
+	}
+}
+
+func TestGetInitialMediaListMessage(t *testing.T) {
+	lists := []structs.UserList{{ID: primitive.NewObjectID(), Name: "Rewatch"}, {ID: primitive.NewObjectID(), Name: "Empty"}}
+	listCounts := map[primitive.ObjectID]int{lists[0].ID: 2}
+
+	tests := []struct {
+		name        string
+		viewer      discord.User
+		mediaCounts map[string]int
+		lists       []structs.UserList
+		description string
+		options     []string
+	}{
+		{
+			name:        "own lists",
+			viewer:      listOwner,
+			mediaCounts: map[string]int{"COMPLETED": 3, "CURRENT": 1},
+			lists:       lists,
+			description: "You have 4 Anime in your lists",
+			options:     []string{"View Watching", "View Completed", "View Rewatch"},
+		},
+		{
+			name:        "another member's lists",
+			viewer:      listViewer,
+			mediaCounts: map[string]int{"REPEATING": 2},
+			description: "alice has 2 Anime in their lists",
+			options:     []string{"View Repeating"},
+		},
+		{
+			name:        "no entries",
+			viewer:      listOwner,
+			mediaCounts: map[string]int{},
+			description: "You have 0 Anime in your lists",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := GetInitialMediaListMessage(listOwner, test.viewer.ID, "ANIME", test.mediaCounts, test.lists, listCounts)
+
+			if embed := onlyEmbed(t, msg); embed.Description != test.description {
+				t.Errorf("description = %q, want %q", embed.Description, test.description)
+			}
+
+			rows := actionRows(t, msg)
+			if len(test.options) == 0 {
+				if len(rows) != 0 {
+					t.Errorf("message has %d action rows, want none", len(rows))
+				}
+				return
+			}
+
+			menu, ok := findComponent(t, msg, (&customid.MediaListsMenu{}).Name()).(discord.StringSelectMenuComponent)
+			if !ok {
+				t.Fatal("no list select menu")
+			}
+
+			labels := []string{}
+			for _, option := range menu.Options {
+				labels = append(labels, option.Label)
+
+				var action customid.MediaListsOption
+				if err := customid.Decode(option.Value, &action); err != nil || action.UserID != listOwner.ID {
+					t.Errorf("option %q = %+v, %v, want a list of %d", option.Label, action, err, listOwner.ID)
+				}
+			}
+			if strings.Join(labels, ", ") != strings.Join(test.options, ", ") {
+				t.Errorf("options = %v, want %v", labels, test.options)
+			}
+		})
+	}
+}
+
+func TestGetListMediaMessage(t *testing.T) {
+	media := &structs.AnilistMedia{IdAnilist: 1, Type: "ANIME", Title: structs.AnilistMediaTitle{Romaji: "Title"}, Episodes: 12}
+	lists := []structs.UserList{{ID: primitive.NewObjectID(), Name: "Rewatch"}}
+	prevList := customid.ListPosition{ListID: lists[0].ID, Page: 3, View: listview.View{Sort: listview.SortScore}}
+
+	entry := func(status string, progress int) *structs.UserMedia {
+		return &structs.UserMedia{ID: primitive.NewObjectID(), UserID: listOwner.ID, MediaType: "ANIME", Status: status, Progress: progress, Score: score.Unscored}
+	}
+
+	tests := []struct {
+		name       string
+		userMedia  *structs.UserMedia
+		prev       customid.ListPosition
+		lists      []structs.UserList
+		rowsWanted int
+		complete   bool
+		backPage   customid.MediaListPage
+	}{
+		{
+			name:       "opened from a status list",
+			userMedia:  entry("CURRENT", 3),
+			prev:       customid.ListPosition{Page: 2},
+			rowsWanted: 3,
+			backPage:   customid.MediaListPage{UserID: listOwner.ID, MediaType: "ANIME", Status: "CURRENT", Page: 2},
+		},
+		{
+			name:       "opened from a custom list",
+			userMedia:  entry("PLANNING", 0),
+			prev:       prevList,
+			lists:      lists,
+			rowsWanted: 4,
+			backPage:   customid.MediaListPage{UserID: listOwner.ID, MediaType: "ANIME", ListID: lists[0].ID, Page: 3, View: prevList.View},
+		},
+		{
+			name:       "last episode reached",
+			userMedia:  entry("CURRENT", 12),
+			prev:       customid.ListPosition{Page: 1},
+			lists:      lists,
+			rowsWanted: 4,
+			complete:   true,
+			backPage:   customid.MediaListPage{UserID: listOwner.ID, MediaType: "ANIME", Status: "CURRENT", Page: 1},
+		},
+		{
+			name:       "completed entries aren't offered to complete",
+			userMedia:  entry("COMPLETED", 12),
+			prev:       customid.ListPosition{Page: 1},
+			rowsWanted: 3,
+			backPage:   customid.MediaListPage{UserID: listOwner.ID, MediaType: "ANIME", Status: "COMPLETED", Page: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := GetListMediaMessage(media, test.userMedia, test.prev, score.Point10, test.lists, false)
+
+			if rows := actionRows(t, msg); len(rows) != test.rowsWanted {
+				t.Errorf("message has %d action rows, want %d", len(rows), test.rowsWanted)
+			}
+
+			if complete := findComponent(t, msg, (&customid.CompleteButton{}).Name()) != nil; complete != test.complete {
+				t.Errorf("complete button shown = %t, want %t", complete, test.complete)
+			}
+
+			back := findComponent(t, msg, (&customid.MediaListPage{}).Name())
+			if back == nil {
+				t.Fatal("no button back to the list")
+			}
+			var backPage customid.MediaListPage
+			if err := customid.Decode(back.ID(), &backPage); err != nil {
+				t.Fatal(err)
+			}
+			// views are compared encoded, decoding fills in the default sort
+			want := test.backPage
+			if backPage.View.Encode() != want.View.Encode() {
+				t.Errorf("back button view = %+v, want %+v", backPage.View, want.View)
+			}
+			backPage.View, want.View = listview.View{}, listview.View{}
+			if fmt.Sprint(backPage) != fmt.Sprint(want) {
+				t.Errorf("back button = %+v, want %+v", backPage, want)
+			}
+		})
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
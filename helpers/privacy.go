@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/structs"
+	"net/http"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// CanViewUserLists reports whether viewerID may look at the lists of owner, going by
+// owner's list privacy. Server only lists can be seen from servers owner is a member
+// of, guildID being where the interaction happened (nil in DMs).
+func CanViewUserLists(ctx context.Context, client bot.Client, guildID *snowflake.ID, viewerID snowflake.ID, owner discord.User) (bool, error) {
+	if owner.ID == viewerID {
+		return true, nil
+	}
+
+	settings, err := database.GetUserSettings(ctx, owner.ID)
+	if err != nil {
+		return false, err
+	}
+
+	switch settings.ListPrivacy {
+	case structs.ListPublic:
+		return true, nil
+	case structs.ListServerOnly:
+		if guildID == nil {
+			return false, nil
+		}
+		member, err := GetGuildMember(ctx, client, *guildID, owner.ID)
+		return member != nil, err
+	default:
+		return false, nil
+	}
+}
+
+// GetGuildMember returns a member of a guild, or nil when the user isn't one. The cache
+// is checked first, but the bot doesn't get member events so it is usually asked from
+// Discord.
+func GetGuildMember(ctx context.Context, client bot.Client, guildID snowflake.ID, userID snowflake.ID) (*discord.Member, error) {
+	if member, ok := client.Caches().Member(guildID, userID); ok {
+		return &member, nil
+	}
+
+	member, err := client.Rest().GetMember(guildID, userID, rest.WithCtx(ctx))
+
+	var restErr rest.Error
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return member, err
+}
+
+// GetListPrivacyErrorEmbed tells a user that owner's lists aren't visible to them.
+func GetListPrivacyErrorEmbed(owner discord.User) *[]discord.Embed {
+	return GetErrorEmbed(fmt.Sprintf("%s's lists aren't visible to you, they may be private or only shared with their servers.", owner.Username))
+}
@@ -0,0 +1,298 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"ipmanlk/saika/charts"
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/score"
+	"ipmanlk/saika/structs"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+// The pages of /stats, in the order of their buttons.
+const (
+	StatsOverviewPage = "overview"
+	statsScoresPage   = "scores"
+	statsGenresPage   = "genres"
+	statsFormatsPage  = "formats"
+)
+
+var statsPages = []struct {
+	page  string
+	label string
+}{
+	{StatsOverviewPage, "Overview"},
+	{statsScoresPage, "Scores"},
+	{statsGenresPage, "Genres & Tags"},
+	{statsFormatsPage, "Formats & Years"},
+}
+
+// Most genres and tags shown, most genres on the radar chart and most release years
+// before older ones are left out.
+const (
+	maxStatsGenres      = 10
+	maxStatsTags        = 10
+	maxStatsRadarGenres = 8
+	maxStatsYears       = 15
+)
+
+// The colour of each status in the status chart, other statuses get the last colour.
+var statusColours = map[string]charts.Colour{
+	"COMPLETED": charts.Palette[0],
+	"CURRENT":   charts.Palette[1],
+	"PAUSED":    charts.Palette[2],
+	"REPEATING": charts.Palette[3],
+	"DROPPED":   charts.Palette[4],
+	"PLANNING":  charts.Palette[5],
+}
+
+// Name of the chart attached to the stats message.
+const statsChartName = "stats.png"
+
+// Width of the longest bar of a distribution, in blocks.
+const statsBarWidth = 20
+
+// GetStatsMessage shows one page of a user's stats of a media type, with scores in the
+// format of the user who ran /stats. Every page but the empty one comes with a chart.
+func GetStatsMessage(user discord.User, stats *structs.UserMediaStats, page string, format score.Format) discord.MessageUpdate {
+	kind, title, otherType, otherTitle := "anime", "Anime", "MANGA", "Manga"
+	if stats.MediaType == "MANGA" {
+		kind, title, otherType, otherTitle = "manga", "Manga", "ANIME", "Anime"
+	}
+
+	embed := discord.NewEmbedBuilder().
+		SetTitle(fmt.Sprintf("%s's %s Stats", user.Username, title)).
+		SetColor(0xFF4081)
+
+	switchButton := discord.NewSecondaryButton(otherTitle+" stats", customid.Encode(&customid.StatsPage{UserID: user.ID, MediaType: otherType, Page: page}))
+
+	// old charts are dropped, the page's own chart is attached again below
+	msg := discord.NewMessageUpdateBuilder().RetainAttachments()
+
+	if stats.Overall.Count == 0 {
+		embed.SetDescription(fmt.Sprintf("%s hasn't added any %s yet.", user.Username, kind))
+		return msg.
+			SetEmbeds(embed.Build()).
+			AddActionRow(switchButton).
+			Build()
+	}
+
+	var chart image.Image
+
+	switch page {
+	case statsScoresPage:
+		if stats.Overall.Scored == 0 {
+			embed.SetDescription(fmt.Sprintf("%s hasn't scored any %s yet.", user.Username, kind))
+		} else {
+			chart = charts.BarChart(getScoreDistribution(stats.Scores, format))
+		}
+		embed.SetFooterText(fmt.Sprintf("%d of %d scored", stats.Overall.Scored, stats.Overall.Count))
+	case statsGenresPage:
+		embed.AddField("Top Genres", formatStatsRanking(stats.Genres, maxStatsGenres, format), false)
+		embed.AddField("Top Tags", formatStatsRanking(stats.Tags, maxStatsTags, format), false)
+		embed.SetFooterText("Ranked by entries, weighted by their mean score")
+
+		// a radar needs three corners
+		if len(stats.Genres) >= 3 {
+			chart = charts.RadarChart(getGenreAxes(stats.Genres))
+		}
+	case statsFormatsPage:
+		formats := make([]statsBar, len(stats.Formats))
+		for i, group := range stats.Formats {
+			formats[i] = statsBar{structs.GetFormatLabel(group.Key), group.Count}
+		}
+		embed.AddField("Formats", formatStatsBars(formats), false)
+
+		// the newest years, oldest first on the chart
+		years := []charts.Bar{}
+		for i, group := range stats.ReleaseYears {
+			if i == maxStatsYears {
+				break
+			}
+			years = append([]charts.Bar{{Label: group.Key, Value: group.Count}}, years...)
+		}
+		if len(years) > 0 {
+			embed.AddField("Release Years", fmt.Sprintf("%s to %s", years[0].Label, years[len(years)-1].Label), false)
+			chart = charts.BarChart(years)
+		}
+
+		if older := len(stats.ReleaseYears) - maxStatsYears; older > 0 {
+			embed.SetFooterText(fmt.Sprintf("%d earlier years not shown", older))
+		}
+	default:
+		page = StatsOverviewPage
+
+		meanScore := "-"
+		if stats.Overall.Scored > 0 {
+			meanScore = format.String(stats.Overall.MeanScore())
+		}
+
+		embed.AddField("Total "+title, fmt.Sprintf("%d", stats.Overall.Count), true).
+			AddField("Mean Score", meanScore, true).
+			AddField("Scored", fmt.Sprintf("%d", stats.Overall.Scored), true)
+
+		if stats.MediaType == "MANGA" {
+			embed.AddField("Chapters Read", fmt.Sprintf("%d", stats.Progress), true)
+		} else {
+			embed.AddField("Episodes Watched", fmt.Sprintf("%d", stats.Progress), true).
+				AddField("Days Watched", fmt.Sprintf("%.1f", float64(stats.Minutes)/(24*60)), true)
+		}
+
+		statuses := make([]string, len(stats.Statuses))
+		slices := make([]charts.Slice, len(stats.Statuses))
+		for i, group := range stats.Statuses {
+			colour, ok := statusColours[group.Key]
+			if !ok {
+				colour = charts.Palette[len(charts.Palette)-1]
+			}
+
+			userMedia := structs.UserMedia{MediaType: stats.MediaType, Status: group.Key}
+			statuses[i] = fmt.Sprintf("%s %s: %d", colour.Emoji, userMedia.GetStatus(), group.Count)
+			slices[i] = charts.Slice{Value: group.Count, Colour: colour}
+		}
+		embed.AddField("Statuses", strings.Join(statuses, "\n"), false)
+
+		chart = charts.DonutChart(slices, fmt.Sprintf("%d", stats.Overall.Count))
+	}
+
+	if chart != nil {
+		// the page still works without its chart
+		if png, err := charts.PNG(chart); err != nil {
+			log.Printf("Error rendering stats chart: %s", err.Error())
+		} else {
+			embed.SetImage("attachment://" + statsChartName)
+			msg.AddFile(statsChartName, fmt.Sprintf("%s's %s stats chart", user.Username, kind), bytes.NewReader(png))
+		}
+	}
+
+	pageButtons := []discord.InteractiveComponent{}
+	for _, statsPage := range statsPages {
+		customID := customid.Encode(&customid.StatsPage{UserID: user.ID, MediaType: stats.MediaType, Page: statsPage.page})
+		if statsPage.page == page {
+			pageButtons = append(pageButtons, discord.NewPrimaryButton(statsPage.label, customID).WithDisabled(true))
+		} else {
+			pageButtons = append(pageButtons, discord.NewSecondaryButton(statsPage.label, customID))
+		}
+	}
+
+	return msg.
+		SetEmbeds(embed.Build()).
+		AddActionRow(append(pageButtons, switchButton)...).
+		Build()
+}
+
+// A labelled count of a distribution.
+type statsBar struct {
+	label string
+	count int
+}
+
+// getScoreDistribution counts the scores as they are shown in format, with a bar for
+// every score the format has, lowest first. Formats with 100 steps are counted in steps
+// of 10.
+func getScoreDistribution(scores []structs.StatsGroup, format score.Format) []charts.Bar {
+	label := func(storedScore int) string {
+		if format == score.Point100 || format == score.Point10Decimal {
+			storedScore = (storedScore + 5) / 10 * 10
+		}
+
+		// charts can't draw stars, smileys are made of plain characters
+		if format == score.Point3 {
+			return format.String(storedScore)
+		}
+		return format.Value(storedScore)
+	}
+
+	bars := []charts.Bar{}
+	positions := map[string]int{}
+	for storedScore := 0; storedScore <= score.Max; storedScore++ {
+		if _, ok := positions[label(storedScore)]; !ok {
+			positions[label(storedScore)] = len(bars)
+			bars = append(bars, charts.Bar{Label: label(storedScore)})
+		}
+	}
+
+	for _, group := range scores {
+		storedScore, _ := strconv.Atoi(group.Key)
+		bars[positions[label(storedScore)]].Value += group.Count
+	}
+
+	return bars
+}
+
+// getGenreAxes puts the top genres on a radar chart, each as far out as its entry count
+// is of the top genre's.
+func getGenreAxes(genres []structs.StatsGroup) []charts.Axis {
+	maxCount := 0
+	for _, genre := range genres {
+		if genre.Count > maxCount {
+			maxCount = genre.Count
+		}
+	}
+
+	axes := []charts.Axis{}
+	for i, genre := range genres {
+		if i == maxStatsRadarGenres {
+			break
+		}
+		axes = append(axes, charts.Axis{Label: genre.Key, Value: float64(genre.Count) / float64(maxCount)})
+	}
+	return axes
+}
+
+// formatStatsBars draws a distribution as a bar chart in a code block.
+func formatStatsBars(bars []statsBar) string {
+	if len(bars) == 0 {
+		return "Nothing to show yet."
+	}
+
+	labelWidth, maxCount := 0, 0
+	for _, bar := range bars {
+		if width := len([]rune(bar.label)); width > labelWidth {
+			labelWidth = width
+		}
+		if bar.count > maxCount {
+			maxCount = bar.count
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("```\n")
+	for _, bar := range bars {
+		// every count gets at least a sliver of a bar
+		blocks := (bar.count*statsBarWidth + maxCount - 1) / maxCount
+		padding := strings.Repeat(" ", labelWidth-len([]rune(bar.label)))
+		sb.WriteString(fmt.Sprintf("%s%s %s %d\n", bar.label, padding, strings.Repeat("█", blocks), bar.count))
+	}
+	sb.WriteString("```")
+
+	return sb.String()
+}
+
+// formatStatsRanking lists the first limit groups with their entry count and mean score.
+func formatStatsRanking(groups []structs.StatsGroup, limit int, format score.Format) string {
+	if len(groups) == 0 {
+		return "Nothing to show yet."
+	}
+
+	lines := []string{}
+	for i, group := range groups {
+		if i == limit {
+			break
+		}
+
+		line := fmt.Sprintf("%d. **%s**: %d", i+1, group.Key, group.Count)
+		if meanScore := group.MeanScore(); meanScore != score.Unscored {
+			line += ", mean " + format.String(meanScore)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
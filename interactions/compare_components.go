@@ -0,0 +1,100 @@
+package interactions
+
+import (
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func HandleComparePagination(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	var comparePage customid.ComparePage
+	if !decodeCustomID(event, event.Data.CustomID(), &comparePage) {
+		return nil
+	}
+
+	return updateComparison(event, comparePage.OwnerID, comparePage.OtherID, comparePage.MediaType, comparePage.Section, comparePage.Page)
+}
+
+func HandleCompareSelectMenu(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	var compareMenu customid.CompareMenu
+	if !decodeCustomID(event, event.Data.CustomID(), &compareMenu) {
+		return nil
+	}
+
+	var option customid.CompareOption
+	if !decodeCustomID(event, selectedValue(event), &option) {
+		return nil
+	}
+
+	// another list starts from its first page
+	return updateComparison(event, compareMenu.OwnerID, compareMenu.OtherID, compareMenu.MediaType, option.Section, 1)
+}
+
+// updateComparison shows a page of /compare again, comparing the lists as they are now.
+func updateComparison(event *handler.ComponentEvent, ownerID snowflake.ID, otherID snowflake.ID, mediaType string, section string, page int) error {
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	if ownerID != event.User().ID {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("You are not allowed to do that"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	other, err := event.Client().Rest().GetUser(otherID)
+	if err != nil {
+		log.Printf("Error occurred while getting user %s: %v\n", otherID, err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("Unable to find that user"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	// the other user may have made their lists private since
+	allowed, err := helpers.CanViewUserLists(ctx, event.Client(), event.GuildID(), event.User().ID, *other)
+	if err != nil {
+		log.Printf("Error occurred while checking list privacy: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while comparing lists"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	if !allowed {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetListPrivacyErrorEmbed(*other),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	comparison, err := database.CompareUserMedia(ctx, event.User().ID, otherID, mediaType)
+
+	if err != nil {
+		log.Printf("Error occurred while comparing lists from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while comparing lists"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(helpers.GetComparisonMessage(event.User(), *other, comparison, section, page, helpers.GetScoreFormat(ctx, event.User().ID)))
+	return err
+}
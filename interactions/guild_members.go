@@ -0,0 +1,69 @@
+package interactions
+
+import (
+	"context"
+	"ipmanlk/saika/database"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// How often a user is recorded again in the same guild.
+const guildMemberRefresh = 24 * time.Hour
+
+// How long recording or forgetting guild members may take, as nobody waits for it.
+const guildMemberTimeout = 30 * time.Second
+
+// when each guild member was last recorded
+var recordedGuildMembers sync.Map
+
+// RecordGuildMembers remembers the guilds users use the bot in, as the gateway doesn't
+// tell the bot who the members of a guild are. It is recorded in the background so
+// interactions aren't slowed down.
+var RecordGuildMembers handler.Middleware = func(next handler.Handler) handler.Handler {
+	return func(e *events.InteractionCreate) error {
+		if guildID := e.GuildID(); guildID != nil {
+			recordGuildMember(*guildID, e.User().ID)
+		}
+		return next(e)
+	}
+}
+
+func recordGuildMember(guildID snowflake.ID, userID snowflake.ID) {
+	key := [2]snowflake.ID{guildID, userID}
+	if recordedAt, ok := recordedGuildMembers.Load(key); ok && time.Since(recordedAt.(time.Time)) < guildMemberRefresh {
+		return
+	}
+	recordedGuildMembers.Store(key, time.Now())
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), guildMemberTimeout)
+		defer cancel()
+
+		if err := database.SaveGuildMember(ctx, guildID, userID); err != nil {
+			log.Printf("Error recording guild member: %v", err)
+			recordedGuildMembers.Delete(key)
+		}
+	}()
+}
+
+// ForgetGuildMembers forgets the members of a guild the bot was removed from.
+func ForgetGuildMembers(guildID snowflake.ID) {
+	recordedGuildMembers.Range(func(key interface{}, _ interface{}) bool {
+		if key.([2]snowflake.ID)[0] == guildID {
+			recordedGuildMembers.Delete(key)
+		}
+		return true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), guildMemberTimeout)
+	defer cancel()
+
+	if err := database.DeleteGuildMembers(ctx, guildID); err != nil {
+		log.Printf("Error forgetting guild members: %v", err)
+	}
+}
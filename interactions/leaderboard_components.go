@@ -0,0 +1,89 @@
+package interactions
+
+import (
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/structs"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleLeaderboardSelectMenu(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var leaderboardMenu customid.LeaderboardMenu
+	if !decodeCustomID(event, event.Data.CustomID(), &leaderboardMenu) {
+		return nil
+	}
+
+	var option customid.LeaderboardOption
+	if !decodeCustomID(event, selectedValue(event), &option) {
+		return nil
+	}
+
+	guildID := event.GuildID()
+	if leaderboardMenu.OwnerID != event.User().ID || guildID == nil {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("You are not allowed to do that"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	message, err := helpers.LoadLeaderboardMessage(ctx, event.Client(), *guildID, event.User(), structs.Leaderboard(option.Board))
+
+	if err != nil {
+		log.Printf("Error occurred while getting leaderboard from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting the leaderboard"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(message)
+	return err
+}
+
+func HandleServerTopPagination(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var serverTopPage customid.ServerTopPage
+	if !decodeCustomID(event, event.Data.CustomID(), &serverTopPage) {
+		return nil
+	}
+
+	guildID := event.GuildID()
+	if serverTopPage.OwnerID != event.User().ID || guildID == nil {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("You are not allowed to do that"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	entries, err := helpers.LoadServerTopMedia(ctx, event.Client(), *guildID, serverTopPage.MediaType, serverTopPage.MinRatings)
+
+	if err != nil {
+		log.Printf("Error occurred while getting guild top media from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting the server's top media"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	message := helpers.GetServerTopMessage(helpers.GetGuildName(event.Client(), *guildID), event.User(), serverTopPage.MediaType, entries, serverTopPage.MinRatings, serverTopPage.Page, helpers.GetScoreFormat(ctx, event.User().ID))
+	_, err = event.UpdateInteractionResponse(message)
+	return err
+}
@@ -1,24 +1,67 @@
 package interactions
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"ipmanlk/saika/customid"
 	"ipmanlk/saika/database"
 	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/listview"
+	"ipmanlk/saika/score"
 	"ipmanlk/saika/structs"
 	"log"
-	"strconv"
 	"strings"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type followupCreator interface {
+	CreateFollowupMessage(messageCreate discord.MessageCreate, opts ...rest.RequestOpt) (*discord.Message, error)
+}
+
+// decodeCustomID decodes a custom ID or select option value of a deferred interaction,
+// telling the user when it can't be used.
+func decodeCustomID(event followupCreator, value string, action customid.Action) bool {
+	err := customid.Decode(value, action)
+	if err == nil {
+		return true
+	}
+
+	log.Printf("Rejected custom id %q: %v\n", value, err)
+
+	_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+		Embeds: *helpers.GetCustomIDErrorEmbed(err),
+		Flags:  discord.MessageFlagEphemeral,
+	})
+	return false
+}
+
+// selectedValue is the chosen option of a single choice select menu.
+func selectedValue(event *handler.ComponentEvent) string {
+	values := event.StringSelectMenuInteractionData().Values
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
 func HandleMediaResultPagination(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
 
-	ownerID := event.Variables["ownerID"]
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
 
-	if ownerID != event.User().ID.String() {
+	var resultsPage customid.MediaResultsPage
+	if !decodeCustomID(event, event.Data.CustomID(), &resultsPage) {
+		return nil
+	}
+
+	if resultsPage.OwnerID != event.User().ID {
 		_, err := event.CreateFollowupMessage(discord.MessageCreate{
 			Embeds: *helpers.GetErrorEmbed("You are not allowed to do that"),
 			Flags:  discord.MessageFlagEphemeral,
@@ -26,38 +69,33 @@ func HandleMediaResultPagination(event *handler.ComponentEvent) error {
 		return err
 	}
 
-	// log event variables
-	searchQueryId := event.Variables["searchQueryID"]
+	searchQuery, err := database.GetSearchQueryByObjectID(ctx, resultsPage.SearchQueryID)
 
-	// get page and parse it as an int
-	page, _ := strconv.Atoi(event.Variables["page"])
-	searchQuery, err := database.GetSearchQueryByHexID(searchQueryId)
+	if errors.Is(err, database.ErrNotFound) {
+		// the buttons of an expired search can't work anymore, keep the embed and drop them
+		_, err := event.UpdateInteractionResponse(discord.NewMessageUpdateBuilder().ClearContainerComponents().Build())
+		if err != nil {
+			log.Printf("Failed to remove the components of an expired search: %v\n", err)
+		}
 
-	if err != nil || searchQuery == nil {
-		_, err := event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Unable to find search query"),
+		_, err = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("These search results have expired, please search again"),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
-	cachedChannel, _ := event.MessageChannel()
-	isNsfwChannel := cachedChannel.NSFW()
-
-	// get search results
-	results, err := database.SearchMedia(searchQuery.SearchText, searchQuery.MediaType, isNsfwChannel)
-
-	// print results length
 	if err != nil {
 		_, err := event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Failed to get search results"),
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Unable to find search query"),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
 	// if there are no results
-	if len(results) == 0 {
+	pages := len(searchQuery.ResultIDs)
+	if pages == 0 {
 		_, err := event.CreateFollowupMessage(discord.MessageCreate{
 			Embeds: *helpers.GetErrorEmbed("No results found"),
 			Flags:  discord.MessageFlagEphemeral,
@@ -65,8 +103,23 @@ func HandleMediaResultPagination(event *handler.ComponentEvent) error {
 		return err
 	}
 
+	page := resultsPage.Page
+	if page > pages {
+		page = pages
+	}
+
+	media, err := database.GetMediaByObjectID(ctx, searchQuery.ResultIDs[page-1])
+
+	if err != nil {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Failed to get search results"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
 	// update the message with the new embed
-	mediaMsg := helpers.GetMediaSearchMessage(&results, page, searchQueryId, event.User().ID.String(), searchQuery.MediaType)
+	mediaMsg := helpers.GetMediaSearchMessage(media, page, pages, searchQuery.ID, event.User().ID, searchQuery.MediaType)
 	_, err = event.UpdateInteractionResponse(mediaMsg)
 
 	return err
@@ -75,24 +128,27 @@ func HandleMediaResultPagination(event *handler.ComponentEvent) error {
 func HandleMediaResultSelectMenu(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
 
-	// takes the shape: action_anime/269/completed
-	selectedOption := event.StringSelectMenuInteractionData().Values[0]
+	var option customid.MediaActionOption
+	if !decodeCustomID(event, selectedValue(event), &option) {
+		return nil
+	}
+
+	idAnilist := option.IdAnilist
+	status := option.Status
 
-	// get idAnilist and status from the selectedOption string
-	parts := strings.Split(selectedOption, "/")
-	idAnilistStr := parts[1]
-	status := parts[2]
-	idAnilist, _ := strconv.Atoi(idAnilistStr)
+	ctx, cancel := helpers.InteractionContext(event)
 
 	go func() {
+		defer cancel()
+
 		// get media from db
-		media, err := database.GetMediaByIDAnilist(idAnilist)
+		media, err := database.GetMediaByIDAnilist(ctx, idAnilist)
 
 		if err != nil || media == nil {
 			log.Printf("Error occurred while getting media from db: %v\n", err)
 
 			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-				Embeds: *helpers.GetErrorEmbed("Error occurred while updating your list"),
+				Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your list"),
 				Flags:  discord.MessageFlagEphemeral,
 			})
 			return
@@ -101,11 +157,10 @@ func HandleMediaResultSelectMenu(event *handler.ComponentEvent) error {
 		// save in db
 		var userMedia *structs.UserMedia
 
-		userMedia, err = database.SaveUserMedia(&structs.UserMedia{
+		userMedia, err = database.SaveUserMedia(ctx, &structs.UserMedia{
 			MediaID:   media.ID,
 			UserID:    event.User().ID,
 			Status:    status,
-			Score:     -1,
 			MediaType: media.Type,
 		})
 
@@ -113,7 +168,7 @@ func HandleMediaResultSelectMenu(event *handler.ComponentEvent) error {
 			log.Printf("Error occurred while saving user anime: %v\n", err)
 
 			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-				Embeds: *helpers.GetErrorEmbed("Error occurred while updating your list"),
+				Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your list"),
 				Flags:  discord.MessageFlagEphemeral,
 			})
 			return
@@ -142,60 +197,217 @@ func HandleMediaResultSelectMenu(event *handler.ComponentEvent) error {
 }
 
 func HandleMediaRateButton(event *handler.ComponentEvent) error {
-	mediaType := event.Variables["mediaType"]
-	idAnilistStr := event.Variables["idAnilist"]
-	origin := event.Variables["origin"]
-	prevPage := event.Variables["prevPage"]
+	var rateButton customid.RateButton
+	if err := customid.Decode(event.Data.CustomID(), &rateButton); err != nil {
+		// nothing was deferred, the error is the response itself
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *helpers.GetCustomIDErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	// an entry that is already on the user's list starts out with its current
+	// score, note and review, as submitting the form replaces all three
+	userMedia, err := getRatedUserMedia(ctx, event.User().ID, rateButton.IdAnilist)
+
+	if err != nil {
+		log.Printf("Error occurred while getting user media from db: %v\n", err)
+
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Internal error occurred."),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
 
-	// print variables
 	modelTitle := "Rate Anime"
 
-	if mediaType == "MANGA" {
+	if rateButton.MediaType == "MANGA" {
 		modelTitle = "Rate Manga"
 	}
 
+	format := helpers.GetScoreFormat(ctx, event.User().ID)
+
 	model := discord.NewModalCreateBuilder()
-	model.CustomID = fmt.Sprintf("model_rate/%s/%s/%s", origin, idAnilistStr, prevPage)
+	model.CustomID = customid.Encode(&customid.RateModal{Origin: rateButton.Origin, IdAnilist: rateButton.IdAnilist, Prev: rateButton.Prev})
 	model.Title = modelTitle
-	field := discord.NewTextInput("score", discord.TextInputStyleShort, "Your Score")
-	field.Placeholder = "Enter a number between 0 and 10"
-	model.AddActionRow(field)
+	model.AddActionRow(discord.NewTextInput("score", discord.TextInputStyleShort, "Your Score").
+		WithPlaceholder(format.Hint()).WithValue(format.Value(userMedia.Score)).WithRequired(false))
+	model.AddActionRow(discord.NewTextInput("note", discord.TextInputStyleShort, "Note").
+		WithPlaceholder("A short note, shown on your list").WithValue(userMedia.Note).WithMaxLength(maxNoteLength).WithRequired(false))
+	model.AddActionRow(discord.NewTextInput("review", discord.TextInputStyleParagraph, "Review").
+		WithPlaceholder("Your review, wrap spoilers in ||double bars||").WithValue(userMedia.Review).WithMaxLength(maxReviewLength).WithRequired(false))
 
 	return event.CreateModal(model.Build())
 }
 
+// getRatedUserMedia returns the user's entry for a media, or an empty entry when
+// it isn't on any of the user's lists.
+func getRatedUserMedia(ctx context.Context, userID snowflake.ID, idAnilist int) (*structs.UserMedia, error) {
+	media, err := database.GetMediaByIDAnilist(ctx, idAnilist)
+	if err != nil {
+		return nil, err
+	}
+
+	userMedia, err := database.GetUserMediaByMediaID(ctx, userID, media.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		return &structs.UserMedia{Score: score.Unscored}, nil
+	}
+
+	return userMedia, err
+}
+
 func HandleMediaListsSelectMenu(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
 
-	selectedOption := event.StringSelectMenuInteractionData().Values[0]
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
 
-	parts := strings.Split(selectedOption, "/")
-	mediaType := parts[1]
-	status := parts[2]
+	var option customid.MediaListsOption
+	if !decodeCustomID(event, selectedValue(event), &option) {
+		return nil
+	}
 
-	// get media from db
-	media, err := database.GetAllUserMedia(event.User().ID, mediaType, status)
+	owner, ok := getListOwner(ctx, event, option.UserID)
+	if !ok {
+		return nil
+	}
 
-	if err != nil || media == nil {
+	// get the first page of the list from db
+	message, err := getMediaListPageMessage(ctx, *owner, event.User().ID, option.MediaType, option.Status, option.ListID, listview.View{}, 1)
+
+	if err != nil {
 		log.Printf("Error occurred while getting media from db: %v\n", err)
 
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Error occurred while getting your list"),
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting your list"),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
-	message := helpers.GetMediaListMessage(event.User(), &media, 1)
-
 	_, err = event.UpdateInteractionResponse(message)
 
 	return err
 }
 
+// getListOwner finds the user whose lists a component shows, and checks that the user
+// who clicked can still see them. The user is told when not.
+func getListOwner(ctx context.Context, event *handler.ComponentEvent, ownerID snowflake.ID) (*discord.User, bool) {
+	owner := event.User()
+	if ownerID != owner.ID {
+		user, err := event.Client().Rest().GetUser(ownerID)
+		if err != nil {
+			log.Printf("Error occurred while getting user %s: %v\n", ownerID, err)
+
+			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *helpers.GetErrorEmbed("Unable to find that user"),
+				Flags:  discord.MessageFlagEphemeral,
+			})
+			return nil, false
+		}
+		owner = *user
+	}
+
+	allowed, err := helpers.CanViewUserLists(ctx, event.Client(), event.GuildID(), event.User().ID, owner)
+	if err != nil {
+		log.Printf("Error occurred while checking list privacy: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting the list"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return nil, false
+	}
+
+	if !allowed {
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetListPrivacyErrorEmbed(owner),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return nil, false
+	}
+
+	return &owner, true
+}
+
+// getInitialMediaListMessage loads the status counts for the list overview of user, as
+// seen by viewerID. Failures replace the overview with an error, as there is nothing
+// else to show.
+func getInitialMediaListMessage(ctx context.Context, user discord.User, viewerID snowflake.ID, mediaType string) discord.MessageUpdate {
+	message, err := helpers.LoadInitialMediaListMessage(ctx, user, viewerID, mediaType)
+	if err != nil {
+		log.Printf("Error getting user media: %s", err.Error())
+		return discord.MessageUpdate{
+			Embeds: helpers.GetDatabaseErrorEmbed(err, "Error getting user media"),
+		}
+	}
+
+	return message
+}
+
+// getMediaListPageMessage loads a page of a status list of user, or of the custom list
+// listID when status is empty, sorted and filtered by view and with scores in the format
+// of viewerID. Empty and deleted lists show the list overview instead, lists that are
+// only empty because of the filters don't.
+func getMediaListPageMessage(ctx context.Context, user discord.User, viewerID snowflake.ID, mediaType string, status string, listID primitive.ObjectID, view listview.View, page int) (discord.MessageUpdate, error) {
+	var list *structs.UserList
+	var listPage *structs.UserMediaPage
+	var err error
+
+	if status != "" {
+		listPage, err = database.GetUserMediaPage(ctx, user.ID, mediaType, status, view, page)
+	} else if list, err = database.GetUserList(ctx, user.ID, listID); err == nil {
+		listPage, err = database.GetUserListPage(ctx, user.ID, listID, view, page)
+	}
+
+	if errors.Is(err, database.ErrNotFound) || (err == nil && listPage.Total == 0 && !view.Filtered()) {
+		return getInitialMediaListMessage(ctx, user, viewerID, mediaType), nil
+	}
+
+	if err != nil {
+		return discord.MessageUpdate{}, err
+	}
+
+	return helpers.GetMediaListMessage(user, viewerID, mediaType, status, list, listPage, view, helpers.GetScoreFormat(ctx, viewerID)), nil
+}
+
+// getListMediaMessage builds the view of a list entry with the score format, custom
+// lists and favourites of the user who opened it. Lists that can't be loaded are left
+// out, and the media is shown as no favourite when that can't be checked.
+func getListMediaMessage(ctx context.Context, userID snowflake.ID, media *structs.AnilistMedia, userMedia *structs.UserMedia, prev customid.ListPosition) discord.MessageUpdate {
+	lists, err := database.GetUserLists(ctx, userID, userMedia.MediaType)
+	if err != nil {
+		log.Printf("Error getting user lists: %s", err.Error())
+	}
+
+	_, err = database.GetUserFavourite(ctx, userID, media.Type, media.IdAnilist)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error getting user favourite: %s", err.Error())
+	}
+
+	return helpers.GetListMediaMessage(media, userMedia, prev, helpers.GetScoreFormat(ctx, userID), lists, err == nil)
+}
+
 func HandleMediaListButton(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
-	message := helpers.GetInitialMediaListMessage(event.User(), event.Variables["mediaType"])
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var listsButton customid.MediaListsButton
+	if !decodeCustomID(event, event.Data.CustomID(), &listsButton) {
+		return nil
+	}
+
+	owner, ok := getListOwner(ctx, event, listsButton.UserID)
+	if !ok {
+		return nil
+	}
+
+	message := getInitialMediaListMessage(ctx, *owner, event.User().ID, listsButton.MediaType)
 	_, err := event.UpdateInteractionResponse(message)
 	return err
 }
@@ -203,84 +415,155 @@ func HandleMediaListButton(event *handler.ComponentEvent) error {
 func HandleMediaListPagination(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
 
-	// get page and parse it as an int
-	page, _ := strconv.Atoi(event.Variables["page"])
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
 
-	// get media from db
-	media, err := database.GetAllUserMedia(event.User().ID, event.Variables["mediaType"], event.Variables["status"])
+	var pageButton customid.MediaListPage
+	if !decodeCustomID(event, event.Data.CustomID(), &pageButton) {
+		return nil
+	}
 
-	if err != nil || media == nil {
+	owner, ok := getListOwner(ctx, event, pageButton.UserID)
+	if !ok {
+		return nil
+	}
+
+	// get the requested page of the list from db
+	message, err := getMediaListPageMessage(ctx, *owner, event.User().ID, pageButton.MediaType, pageButton.Status, pageButton.ListID, pageButton.View, pageButton.Page)
+
+	if err != nil {
 		log.Printf("Error occurred while getting media from db: %v\n", err)
 
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Error occurred while getting your list"),
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting your list"),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
 	// update the message with the new embed
-	_, err = event.UpdateInteractionResponse(helpers.GetMediaListMessage(event.User(), &media, page))
+	_, err = event.UpdateInteractionResponse(message)
 
 	return err
 }
 
+func HandleMediaListViewSelectMenu(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var viewMenu customid.MediaListViewMenu
+	if !decodeCustomID(event, event.Data.CustomID(), &viewMenu) {
+		return nil
+	}
+
+	var option customid.MediaListViewOption
+	if !decodeCustomID(event, selectedValue(event), &option) {
+		return nil
+	}
+
+	owner, ok := getListOwner(ctx, event, viewMenu.UserID)
+	if !ok {
+		return nil
+	}
+
+	// a new sort order or filter starts over from the first page
+	message, err := getMediaListPageMessage(ctx, *owner, event.User().ID, viewMenu.MediaType, viewMenu.Status, viewMenu.ListID, option.View, 1)
+
+	if err != nil {
+		log.Printf("Error occurred while getting media from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting your list"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(message)
+	return err
+}
+
 func HandleMediaListSelectMenu(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
 
-	selectedOption := event.StringSelectMenuInteractionData().Values[0]
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
 
-	parts := strings.Split(selectedOption, "/")
-	userMediaID := parts[0]
-	prevPage, _ := strconv.Atoi(parts[1])
+	var option customid.MediaListOption
+	if !decodeCustomID(event, selectedValue(event), &option) {
+		return nil
+	}
 
-	// get user media
-	userMedia, err := database.GetUserMediaByHexID(userMediaID)
+	// get user media, only entries of the user who clicked are found
+	userMedia, err := database.GetUserMediaByObjectID(ctx, event.User().ID, option.UserMediaID)
 
 	if err != nil || userMedia == nil {
 		log.Printf("Error occurred while getting user media from db: %v\n", err)
 
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Internal error occurred."),
+			Embeds: *getUserMediaErrorEmbed(err),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
 	// get media from db
-	media, err := database.GetMediaByHexID(userMedia.MediaID.Hex())
+	media, err := database.GetMediaByHexID(ctx, userMedia.MediaID.Hex())
 
 	if err != nil || media == nil {
 		log.Printf("Error occurred while getting media from db: %v\n", err)
 
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Internal error occurred."),
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Internal error occurred."),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
-	message := helpers.GetListMediaMessage(media, userMedia, prevPage)
+	message := getListMediaMessage(ctx, event.User().ID, media, userMedia, option.Prev)
 	_, err = event.UpdateInteractionResponse(message)
 
 	return err
 }
 
+// getUserMediaErrorEmbed explains a failed lookup of a list entry. Entries of other users
+// are reported the same way as missing ones, so their ids reveal nothing.
+func getUserMediaErrorEmbed(err error) *[]discord.Embed {
+	if errors.Is(err, database.ErrNotFound) {
+		return helpers.GetErrorEmbed("That entry isn't on your list. It may have been removed already, or belong to someone else.")
+	}
+
+	return helpers.GetDatabaseErrorEmbed(err, "Internal error occurred.")
+}
+
 func HandleMediaListDeleteButton(event *handler.ComponentEvent) error {
 	event.DeferUpdateMessage()
 
-	userMediaID := event.Variables["userMediaID"]
-	mediaType := event.Variables["mediaType"]
-	status := event.Variables["status"]
-	prevPage, _ := strconv.Atoi(event.Variables["prevPage"])
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var deleteButton customid.DeleteButton
+	if !decodeCustomID(event, event.Data.CustomID(), &deleteButton) {
+		return nil
+	}
+
+	mediaType := deleteButton.MediaType
+	status := deleteButton.Status
+	prev := deleteButton.Prev
+
+	if !prev.ListID.IsZero() {
+		status = ""
+	}
 
-	err := database.DeleteUserMediaByHexID(userMediaID)
+	err := database.DeleteUserMediaByObjectID(ctx, event.User().ID, deleteButton.UserMediaID)
 
 	if err != nil {
 		log.Printf("Error occurred while deleting user media from db: %v\n", err)
 
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Internal error occurred."),
+			Embeds: *getUserMediaErrorEmbed(err),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
@@ -291,27 +574,354 @@ func HandleMediaListDeleteButton(event *handler.ComponentEvent) error {
 		Flags:  discord.MessageFlagEphemeral,
 	})
 
-	userMedia, err := database.GetAllUserMedia(event.User().ID, mediaType, status)
+	// the page the entry was on may be gone now, in which case the last page is shown
+	msg, err := getMediaListPageMessage(ctx, event.User(), event.User().ID, mediaType, status, prev.ListID, prev.View, prev.Page)
 
 	if err != nil {
 		log.Printf("Error occurred while getting user media from db: %v\n", err)
 
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Internal error occurred."),
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Internal error occurred."),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
-	if userMedia != nil && len(userMedia) > 0 {
-		msg := helpers.GetMediaListMessage(event.User(), &userMedia, prevPage)
-		_, err = event.UpdateInteractionResponse(msg)
+	_, err = event.UpdateInteractionResponse(msg)
+
+	return err
+}
+
+type listMediaUpdater interface {
+	followupCreator
+	UpdateInteractionResponse(messageUpdate discord.MessageUpdate, opts ...rest.RequestOpt) (*discord.Message, error)
+}
+
+// getListEntry loads one of the user's list entries with its media, telling the user
+// when either can't be found.
+func getListEntry(ctx context.Context, event listMediaUpdater, userID snowflake.ID, userMediaID primitive.ObjectID) (*structs.UserMedia, *structs.AnilistMedia, bool) {
+	userMedia, err := database.GetUserMediaByObjectID(ctx, userID, userMediaID)
+
+	if err != nil {
+		log.Printf("Error occurred while getting user media from db: %v\n", err)
 
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return nil, nil, false
+	}
+
+	media, err := database.GetMediaByObjectID(ctx, userMedia.MediaID)
+
+	if err != nil {
+		log.Printf("Error occurred while getting media from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Internal error occurred."),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return nil, nil, false
+	}
+
+	return userMedia, media, true
+}
+
+func HandleMediaProgressButton(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var progressButton customid.ProgressButton
+	if !decodeCustomID(event, event.Data.CustomID(), &progressButton) {
+		return nil
+	}
+
+	_, media, ok := getListEntry(ctx, event, event.User().ID, progressButton.UserMediaID)
+	if !ok {
+		return nil
+	}
+
+	// never count past the last episode/chapter, when it is known
+	userMedia, err := database.IncrementUserMediaProgress(ctx, event.User().ID, progressButton.UserMediaID, media.GetProgressTotal())
+
+	if err != nil {
+		log.Printf("Error occurred while updating user media progress: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
 		return err
 	}
 
-	msg := helpers.GetInitialMediaListMessage(event.User(), mediaType)
-	_, err = event.UpdateInteractionResponse(msg)
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, progressButton.Prev))
+	return err
+}
+
+func HandleMediaSetProgressButton(event *handler.ComponentEvent) error {
+	var setProgressButton customid.SetProgressButton
+	if err := customid.Decode(event.Data.CustomID(), &setProgressButton); err != nil {
+		// nothing was deferred, the error is the response itself
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *helpers.GetCustomIDErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
+
+	model := discord.NewModalCreateBuilder()
+	model.CustomID = customid.Encode(&customid.ProgressModal{UserMediaID: setProgressButton.UserMediaID, Prev: setProgressButton.Prev})
+	model.Title = "Set Progress"
+
+	if setProgressButton.MediaType == "MANGA" {
+		model.AddActionRow(discord.NewTextInput("progress", discord.TextInputStyleShort, "Chapters read").WithPlaceholder("Enter a number"))
+		model.AddActionRow(discord.NewTextInput("progress_volumes", discord.TextInputStyleShort, "Volumes read").WithPlaceholder("Enter a number").WithRequired(false))
+	} else {
+		model.AddActionRow(discord.NewTextInput("progress", discord.TextInputStyleShort, "Episodes watched").WithPlaceholder("Enter a number"))
+	}
+
+	return event.CreateModal(model.Build())
+}
+
+func HandleMediaCompleteButton(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var completeButton customid.CompleteButton
+	if !decodeCustomID(event, event.Data.CustomID(), &completeButton) {
+		return nil
+	}
+
+	userMedia, media, ok := getListEntry(ctx, event, event.User().ID, completeButton.UserMediaID)
+	if !ok {
+		return nil
+	}
+
+	userMedia, err := database.SaveUserMedia(ctx, &structs.UserMedia{
+		MediaID:   userMedia.MediaID,
+		UserID:    event.User().ID,
+		Status:    "COMPLETED",
+		MediaType: userMedia.MediaType,
+	})
+
+	if err != nil {
+		log.Printf("Error occurred while saving user media: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your list"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+		Embeds: *helpers.GetDefaultEmbed(fmt.Sprintf("%s has been moved to your completed list.", media.GetTitle())),
+		Flags:  discord.MessageFlagEphemeral,
+	})
+
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, completeButton.Prev))
+	return err
+}
+
+func HandleMediaHistoryButton(event *handler.ComponentEvent) error {
+	var historyButton customid.HistoryButton
+	if err := customid.Decode(event.Data.CustomID(), &historyButton); err != nil {
+		// nothing was deferred, the error is the response itself
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *helpers.GetCustomIDErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	// the form starts out with the current values, so a single date can be changed
+	userMedia, err := database.GetUserMediaByObjectID(ctx, event.User().ID, historyButton.UserMediaID)
+
+	if err != nil {
+		log.Printf("Error occurred while getting user media from db: %v\n", err)
+
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
+
+	repeatLabel := "Times rewatched"
+	if userMedia.MediaType == "MANGA" {
+		repeatLabel = "Times reread"
+	}
+
+	model := discord.NewModalCreateBuilder()
+	model.CustomID = customid.Encode(&customid.HistoryModal{UserMediaID: historyButton.UserMediaID, Prev: historyButton.Prev})
+	model.Title = "Edit Dates"
+	model.AddActionRow(discord.NewTextInput("started_at", discord.TextInputStyleShort, "Started").
+		WithPlaceholder("YYYY-MM-DD, YYYY-MM or YYYY").WithValue(userMedia.StartedAt.String()).WithRequired(false))
+	model.AddActionRow(discord.NewTextInput("completed_at", discord.TextInputStyleShort, "Completed").
+		WithPlaceholder("YYYY-MM-DD, YYYY-MM or YYYY").WithValue(userMedia.CompletedAt.String()).WithRequired(false))
+	model.AddActionRow(discord.NewTextInput("repeat", discord.TextInputStyleShort, repeatLabel).
+		WithPlaceholder("Enter a number").WithValue(fmt.Sprintf("%d", userMedia.Repeat)).WithRequired(false))
+
+	return event.CreateModal(model.Build())
+}
+
+func HandleMediaEntryListsSelectMenu(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var listsMenu customid.EntryListsMenu
+	if !decodeCustomID(event, event.Data.CustomID(), &listsMenu) {
+		return nil
+	}
+
+	// every selected option is a list the entry should be on, none takes it off all of them
+	values := event.StringSelectMenuInteractionData().Values
+	listIDs := make([]primitive.ObjectID, len(values))
+
+	for i, value := range values {
+		var option customid.EntryListsOption
+		if !decodeCustomID(event, value, &option) {
+			return nil
+		}
+		listIDs[i] = option.ListID
+	}
+
+	_, media, ok := getListEntry(ctx, event, event.User().ID, listsMenu.UserMediaID)
+	if !ok {
+		return nil
+	}
+
+	userMedia, err := database.SetUserMediaLists(ctx, event.User().ID, listsMenu.UserMediaID, listIDs)
+
+	if err != nil {
+		log.Printf("Error occurred while updating user media lists: %v\n", err)
+
+		embeds := helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your lists")
+		if errors.Is(err, database.ErrNotFound) {
+			embeds = helpers.GetErrorEmbed("That entry or one of those lists doesn't exist anymore.")
+		}
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *embeds,
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, listsMenu.Prev))
+	return err
+}
+
+func HandleMediaTagsButton(event *handler.ComponentEvent) error {
+	var tagsButton customid.TagsButton
+	if err := customid.Decode(event.Data.CustomID(), &tagsButton); err != nil {
+		// nothing was deferred, the error is the response itself
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *helpers.GetCustomIDErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	// the form starts out with the current tags, so one can be added or removed
+	userMedia, err := database.GetUserMediaByObjectID(ctx, event.User().ID, tagsButton.UserMediaID)
+
+	if err != nil {
+		log.Printf("Error occurred while getting user media from db: %v\n", err)
+
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+	}
+
+	model := discord.NewModalCreateBuilder()
+	model.CustomID = customid.Encode(&customid.TagsModal{UserMediaID: tagsButton.UserMediaID, Prev: tagsButton.Prev})
+	model.Title = "Edit Tags"
+	model.AddActionRow(discord.NewTextInput("tags", discord.TextInputStyleShort, "Tags").
+		WithPlaceholder("Separate tags with commas, ex. comfy, rewatch").
+		WithValue(strings.Join(userMedia.Tags, ", ")).
+		WithMaxLength(maxTags * (maxTagLength + 2)).
+		WithRequired(false))
+
+	return event.CreateModal(model.Build())
+}
+
+func HandleMediaFavouriteButton(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var favouriteButton customid.FavouriteButton
+	if !decodeCustomID(event, event.Data.CustomID(), &favouriteButton) {
+		return nil
+	}
+
+	media, err := database.GetMediaByIDAnilist(ctx, favouriteButton.IdAnilist)
+
+	if err != nil || media == nil {
+		log.Printf("Error occurred while getting media from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your favourites"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	added, err := database.ToggleUserFavourite(ctx, &structs.Favourite{
+		UserID:    event.User().ID,
+		Type:      media.Type,
+		IdAnilist: media.IdAnilist,
+		MediaID:   media.ID,
+	})
+
+	if err != nil {
+		log.Printf("Error occurred while updating favourites: %v\n", err)
+
+		embeds := helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your favourites")
+		if errors.Is(err, database.ErrFavouriteLimit) {
+			embeds = helpers.GetErrorEmbed(fmt.Sprintf("You can have at most %d favourite %s, remove one with /favourites first.", database.MaxFavourites, strings.ToLower(media.Type)))
+		}
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *embeds,
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	confirmation := fmt.Sprintf("%s has been removed from your favourites.", media.GetTitle())
+	if added {
+		confirmation = fmt.Sprintf("%s has been added to your favourites.", media.GetTitle())
+	}
+
+	_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+		Embeds: *helpers.GetDefaultEmbed(confirmation),
+		Flags:  discord.MessageFlagEphemeral,
+	})
+
+	// search results look the same for everyone, only the entry view shows the new state
+	if favouriteButton.Origin != "list" {
+		return nil
+	}
+
+	userMedia, err := database.GetUserMediaByMediaID(ctx, event.User().ID, media.ID)
+
+	if err != nil {
+		log.Printf("Error occurred while getting user media from db: %v\n", err)
+		return err
+	}
 
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, favouriteButton.Prev))
 	return err
 }
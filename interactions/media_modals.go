@@ -1,11 +1,16 @@
 package interactions
 
 import (
+	"errors"
 	"fmt"
+	"ipmanlk/saika/customid"
 	"ipmanlk/saika/database"
 	"ipmanlk/saika/helpers"
+	"ipmanlk/saika/score"
 	"ipmanlk/saika/structs"
+	"log"
 	"strconv"
+	"strings"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/handler"
@@ -14,51 +19,66 @@ import (
 func HandleAnimeRatingModal(event *handler.ModalEvent) error {
 	event.DeferUpdateMessage()
 
-	// print variables
-	idAnilist, _ := strconv.Atoi(event.Variables["idAnilist"])
-	origin := event.Variables["origin"]
-	prevPage, _ := strconv.Atoi(event.Variables["prevPage"])
+	var rateModal customid.RateModal
+	if !decodeCustomID(event, event.Data.CustomID, &rateModal) {
+		return nil
+	}
 
-	scoreStr := event.Data.Text("score")
+	idAnilist := rateModal.IdAnilist
+	origin := rateModal.Origin
+	prev := rateModal.Prev
 
-	score, err := strconv.Atoi(scoreStr)
+	note := strings.TrimSpace(event.Data.Text("note"))
+	review := strings.TrimSpace(event.Data.Text("review"))
 
-	if err != nil {
-		_, err = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Please provide a valid rating!"),
+	if len([]rune(note)) > maxNoteLength || len([]rune(review)) > maxReviewLength {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed(fmt.Sprintf("Notes can be up to %d and reviews up to %d characters long!", maxNoteLength, maxReviewLength)),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 		return err
 	}
 
-	// check if the rating is between 0 and 10
-	if score < 0 || score > 10 {
-		_, err = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetErrorEmbed("Please provide a rating between 0 and 10!"),
-			Flags:  discord.MessageFlagEphemeral,
-		})
-		return err
-	}
+	ctx, cancel := helpers.InteractionContext(event)
 
 	go func() {
+		defer cancel()
+
+		// the score is typed in the user's format, an empty one clears it
+		format := helpers.GetScoreFormat(ctx, event.User().ID)
+		rating, err := format.Parse(event.Data.Text("score"))
+
+		// checked before the media is added to the list, SetUserMediaRating would refuse it
+		// after that
+		if err == nil && (rating < score.Unscored || rating > score.Max) {
+			err = fmt.Errorf("score %d is out of range", rating)
+		}
+
+		if err != nil {
+			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *helpers.GetErrorEmbed("Please provide a score like this: " + format.Hint() + ". You can change the format with /settings."),
+				Flags:  discord.MessageFlagEphemeral,
+			})
+			return
+		}
+
 		// get media from db
-		media, err := database.GetMediaByIDAnilist(idAnilist)
+		media, err := database.GetMediaByIDAnilist(ctx, idAnilist)
 
 		if err != nil || media == nil {
 			fmt.Printf("Error occurred while getting media from db: %v\n", err)
 
 			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-				Embeds: *helpers.GetErrorEmbed("Error occurred while updating your list"),
+				Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your list"),
 				Flags:  discord.MessageFlagEphemeral,
 			})
 			return
 		}
 
 		// save in db
-		userMedia, err := database.SaveUserMedia(&structs.UserMedia{
+		userMedia, err := database.SaveUserMedia(ctx, &structs.UserMedia{
 			MediaID:   media.ID,
 			UserID:    event.User().ID,
-			Score:     score,
 			MediaType: media.Type,
 		})
 
@@ -66,23 +86,279 @@ func HandleAnimeRatingModal(event *handler.ModalEvent) error {
 			fmt.Printf("Error occurred while saving user media: %v\n", err)
 
 			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-				Embeds: *helpers.GetErrorEmbed("Error occurred while updating your list"),
+				Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while updating your list"),
 				Flags:  discord.MessageFlagEphemeral,
 			})
 
 			return
 		}
 
+		userMedia, err = database.SetUserMediaRating(ctx, event.User().ID, userMedia.ID, rating, note, review)
+
+		if err != nil {
+			fmt.Printf("Error occurred while saving user media review: %v\n", err)
+
+			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while saving your review"),
+				Flags:  discord.MessageFlagEphemeral,
+			})
+
+			return
+		}
+
+		confirmation := fmt.Sprintf("Your score for %s has been cleared.", media.GetTitle())
+		if userMedia.Scored() {
+			confirmation = fmt.Sprintf("You have rated %s with a score of %s.", media.GetTitle(), format.String(userMedia.Score))
+		}
+
+		if userMedia.Review != "" {
+			confirmation += " Your review has been saved, see it with /reviews."
+		}
+
 		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
-			Embeds: *helpers.GetDefaultEmbed(fmt.Sprintf("You have rated %s with a score of %d.", media.GetTitle(), userMedia.Score)),
+			Embeds: *helpers.GetDefaultEmbed(confirmation),
 			Flags:  discord.MessageFlagEphemeral,
 		})
 
 		if origin == "list" {
-			msg := helpers.GetListMediaMessage(media, userMedia, prevPage)
+			msg := getListMediaMessage(ctx, event.User().ID, media, userMedia, prev)
 			event.UpdateInteractionResponse(msg)
 		}
 	}()
 
 	return nil
 }
+
+// Limits of the rating form, a review has to fit in an embed description.
+const (
+	maxNoteLength   = 200
+	maxReviewLength = 4000
+)
+
+// Upper bound for progress of media whose length isn't known yet.
+const maxUnknownProgress = 100000
+
+func HandleMediaProgressModal(event *handler.ModalEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var progressModal customid.ProgressModal
+	if !decodeCustomID(event, event.Data.CustomID, &progressModal) {
+		return nil
+	}
+
+	userMedia, media, ok := getListEntry(ctx, event, event.User().ID, progressModal.UserMediaID)
+	if !ok {
+		return nil
+	}
+
+	progress, err := parseProgress(event.Data.Text("progress"), media.GetProgressTotal())
+
+	if err != nil {
+		_, err = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed(err.Error()),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	// volumes are optional and only asked for manga
+	progressVolumes := userMedia.ProgressVolumes
+
+	if volumesStr := strings.TrimSpace(event.Data.Text("progress_volumes")); volumesStr != "" {
+		progressVolumes, err = parseProgress(volumesStr, media.Volumes)
+
+		if err != nil {
+			_, err = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *helpers.GetErrorEmbed(err.Error()),
+				Flags:  discord.MessageFlagEphemeral,
+			})
+			return err
+		}
+	}
+
+	userMedia, err = database.SetUserMediaProgress(ctx, event.User().ID, userMedia.ID, progress, progressVolumes)
+
+	if err != nil {
+		log.Printf("Error occurred while updating user media progress: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, progressModal.Prev))
+	return err
+}
+
+// parseProgress reads a number between 0 and total, total being 0 when it isn't known.
+func parseProgress(value string, total int) (int, error) {
+	progress, err := strconv.Atoi(strings.TrimSpace(value))
+
+	if err != nil || progress < 0 {
+		return 0, errors.New("Please provide a valid number!")
+	}
+
+	if total == 0 {
+		total = maxUnknownProgress
+	}
+
+	if progress > total {
+		return 0, fmt.Errorf("Please provide a number between 0 and %d!", total)
+	}
+
+	return progress, nil
+}
+
+// Upper bound for the number of times something was rewatched or reread.
+const maxRepeat = 1000
+
+func HandleMediaHistoryModal(event *handler.ModalEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var historyModal customid.HistoryModal
+	if !decodeCustomID(event, event.Data.CustomID, &historyModal) {
+		return nil
+	}
+
+	startedAt, err := structs.ParseFuzzyDate(event.Data.Text("started_at"))
+	if err != nil {
+		_, err = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("Please provide the start date as YYYY-MM-DD, YYYY-MM or YYYY!"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	completedAt, err := structs.ParseFuzzyDate(event.Data.Text("completed_at"))
+	if err != nil {
+		_, err = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("Please provide the completion date as YYYY-MM-DD, YYYY-MM or YYYY!"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	// an empty count means never repeated
+	repeat := 0
+	if repeatStr := strings.TrimSpace(event.Data.Text("repeat")); repeatStr != "" {
+		repeat, err = strconv.Atoi(repeatStr)
+
+		if err != nil || repeat < 0 || repeat > maxRepeat {
+			_, err = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *helpers.GetErrorEmbed(fmt.Sprintf("Please provide a repeat count between 0 and %d!", maxRepeat)),
+				Flags:  discord.MessageFlagEphemeral,
+			})
+			return err
+		}
+	}
+
+	userMedia, err := database.SetUserMediaHistory(ctx, event.User().ID, historyModal.UserMediaID, startedAt, completedAt, repeat)
+
+	if err != nil {
+		log.Printf("Error occurred while updating user media history: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	media, err := database.GetMediaByObjectID(ctx, userMedia.MediaID)
+
+	if err != nil {
+		log.Printf("Error occurred while getting media from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Internal error occurred."),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, historyModal.Prev))
+	return err
+}
+
+// Limits of personal tags, they are shown in a single embed field.
+const (
+	maxTags      = 10
+	maxTagLength = 30
+)
+
+func HandleMediaTagsModal(event *handler.ModalEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var tagsModal customid.TagsModal
+	if !decodeCustomID(event, event.Data.CustomID, &tagsModal) {
+		return nil
+	}
+
+	tags, err := parseTags(event.Data.Text("tags"))
+
+	if err != nil {
+		_, err = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed(err.Error()),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, media, ok := getListEntry(ctx, event, event.User().ID, tagsModal.UserMediaID)
+	if !ok {
+		return nil
+	}
+
+	userMedia, err := database.SetUserMediaTags(ctx, event.User().ID, tagsModal.UserMediaID, tags)
+
+	if err != nil {
+		log.Printf("Error occurred while updating user media tags: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *getUserMediaErrorEmbed(err),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(getListMediaMessage(ctx, event.User().ID, media, userMedia, tagsModal.Prev))
+	return err
+}
+
+// parseTags reads a comma separated list of tags. Tags are lowercased with their
+// whitespace collapsed, and repeated or empty ones are dropped.
+func parseTags(value string) ([]string, error) {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		if len([]rune(tag)) > maxTagLength {
+			return nil, fmt.Errorf("Tags can be at most %d characters long!", maxTagLength)
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("You can add at most %d tags to an entry!", maxTags)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,82 @@
+package interactions
+
+import (
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleReviewsPagination(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var reviewsPage customid.ReviewsPage
+	if !decodeCustomID(event, event.Data.CustomID(), &reviewsPage) {
+		return nil
+	}
+
+	if reviewsPage.OwnerID != event.User().ID {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("You are not allowed to do that"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	// the title needs the reviewer's name, which only has to be fetched for other users
+	user := event.User()
+	if reviewsPage.UserID != user.ID {
+		reviewer, err := event.Client().Rest().GetUser(reviewsPage.UserID)
+		if err != nil {
+			log.Printf("Error occurred while getting user %s: %v\n", reviewsPage.UserID, err)
+
+			_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+				Embeds: *helpers.GetErrorEmbed("Unable to find that user"),
+				Flags:  discord.MessageFlagEphemeral,
+			})
+			return err
+		}
+		user = *reviewer
+	}
+
+	// the reviewer may have made their lists private since
+	allowed, err := helpers.CanViewUserLists(ctx, event.Client(), event.GuildID(), event.User().ID, user)
+	if err != nil {
+		log.Printf("Error occurred while checking list privacy: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting reviews"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	if !allowed {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetListPrivacyErrorEmbed(user),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	page, err := database.GetUserReviewsPage(ctx, user.ID, reviewsPage.Page)
+
+	if err != nil {
+		log.Printf("Error occurred while getting reviews from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting reviews"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(helpers.GetReviewsMessage(user, event.User().ID, page, helpers.GetScoreFormat(ctx, event.User().ID)))
+	return err
+}
@@ -0,0 +1,46 @@
+package interactions
+
+import (
+	"ipmanlk/saika/customid"
+	"ipmanlk/saika/database"
+	"ipmanlk/saika/helpers"
+	"log"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+)
+
+func HandleStatsPagination(event *handler.ComponentEvent) error {
+	event.DeferUpdateMessage()
+
+	ctx, cancel := helpers.InteractionContext(event)
+	defer cancel()
+
+	var statsPage customid.StatsPage
+	if !decodeCustomID(event, event.Data.CustomID(), &statsPage) {
+		return nil
+	}
+
+	if statsPage.UserID != event.User().ID {
+		_, err := event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetErrorEmbed("You are not allowed to do that"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	stats, err := database.GetUserMediaStats(ctx, event.User().ID, statsPage.MediaType)
+
+	if err != nil {
+		log.Printf("Error occurred while getting stats from db: %v\n", err)
+
+		_, _ = event.CreateFollowupMessage(discord.MessageCreate{
+			Embeds: *helpers.GetDatabaseErrorEmbed(err, "Error occurred while getting stats"),
+			Flags:  discord.MessageFlagEphemeral,
+		})
+		return err
+	}
+
+	_, err = event.UpdateInteractionResponse(helpers.GetStatsMessage(event.User(), stats, statsPage.Page, helpers.GetScoreFormat(ctx, event.User().ID)))
+	return err
+}
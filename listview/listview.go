@@ -0,0 +1,257 @@
+// Package listview describes how a list page is sorted and filtered. A view travels
+// with the page in custom IDs, so it is encoded in a few characters.
+package listview
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type Sort string
+
+const (
+	SortAdded    Sort = "a"
+	SortTitle    Sort = "t"
+	SortScore    Sort = "s"
+	SortUpdated  Sort = "u"
+	SortYear     Sort = "y"
+	SortProgress Sort = "p"
+)
+
+// Sorts lists every sort order, in the order they are offered to users.
+var Sorts = []Sort{SortAdded, SortTitle, SortScore, SortUpdated, SortYear, SortProgress}
+
+// DefaultSort keeps entries in the order they were added, as lists always were.
+const DefaultSort = SortAdded
+
+// Label names the sort order in menus.
+func (sort Sort) Label() string {
+	switch sort {
+	case SortTitle:
+		return "Title"
+	case SortScore:
+		return "Score"
+	case SortUpdated:
+		return "Last updated"
+	case SortYear:
+		return "Release year"
+	case SortProgress:
+		return "Progress"
+	default:
+		return "Date added"
+	}
+}
+
+func (sort Sort) valid() bool {
+	for _, known := range Sorts {
+		if sort == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Scored filters entries by whether they have a score, the empty value keeps all of them.
+type Scored string
+
+const (
+	ScoredAny Scored = ""
+	ScoredYes Scored = "y"
+	ScoredNo  Scored = "n"
+)
+
+// AniList media formats, statuses and genres a list can be filtered by. Views store
+// positions in these, so new values only ever go at the end.
+var (
+	Formats  = []string{"TV", "TV_SHORT", "MOVIE", "SPECIAL", "OVA", "ONA", "MUSIC", "MANGA", "NOVEL", "ONE_SHOT"}
+	Statuses = []string{"FINISHED", "RELEASING", "NOT_YET_RELEASED", "CANCELLED", "HIATUS"}
+	Genres   = []string{
+		"Action", "Adventure", "Comedy", "Drama", "Ecchi", "Fantasy", "Hentai", "Horror", "Mahou Shoujo", "Mecha",
+		"Music", "Mystery", "Psychological", "Romance", "Sci-Fi", "Slice of Life", "Sports", "Supernatural", "Thriller",
+	}
+)
+
+// FormatsFor returns the formats media of a type (ANIME or MANGA) can have.
+func FormatsFor(mediaType string) []string {
+	if mediaType == "MANGA" {
+		return Formats[7:]
+	}
+	return Formats[:7]
+}
+
+// View is the sort order and filters of a list page. Entries have to match every
+// filter, and one of the values of filters that have several. The zero View is the
+// unfiltered list in the default order.
+type View struct {
+	Sort     Sort
+	Formats  []string
+	Statuses []string
+	Genre    string
+	Scored   Scored
+}
+
+// ErrInvalid is returned by Decode for text that isn't an encoded view.
+var ErrInvalid = errors.New("invalid list view")
+
+// Length of an encoded view: the sort, the formats and statuses as bit sets (two and
+// one base 36 digits), the genre's position and the scored filter.
+const encodedLength = 6
+
+// none marks an unset genre or scored filter.
+const none = "-"
+
+// GetSort is the view's sort order, DefaultSort when none was picked.
+func (view View) GetSort() Sort {
+	if view.Sort == "" {
+		return DefaultSort
+	}
+	return view.Sort
+}
+
+// Filtered reports whether any filter is set.
+func (view View) Filtered() bool {
+	return len(view.Formats) > 0 || len(view.Statuses) > 0 || view.Genre != "" || view.Scored != ScoredAny
+}
+
+// NeedsMedia reports whether sorting or filtering looks at the media of the entries,
+// not just the entries themselves.
+func (view View) NeedsMedia() bool {
+	sort := view.GetSort()
+	return sort == SortTitle || sort == SortYear || len(view.Formats) > 0 || len(view.Statuses) > 0 || view.Genre != ""
+}
+
+// HasFormat reports whether the view keeps entries of format, out of several.
+func (view View) HasFormat(format string) bool {
+	return contains(view.Formats, format)
+}
+
+// HasStatus reports whether the view keeps entries of the media status status.
+func (view View) HasStatus(status string) bool {
+	return contains(view.Statuses, status)
+}
+
+// ToggleFormat returns the view with format added to the format filter, or removed
+// when it is already in it.
+func (view View) ToggleFormat(format string) View {
+	view.Formats = toggle(view.Formats, format, Formats)
+	return view
+}
+
+// ToggleStatus is ToggleFormat for media statuses.
+func (view View) ToggleStatus(status string) View {
+	view.Statuses = toggle(view.Statuses, status, Statuses)
+	return view
+}
+
+// ClearFilters returns the view without filters, keeping its sort order.
+func (view View) ClearFilters() View {
+	return View{Sort: view.Sort}
+}
+
+// Encode returns the view as the few characters Decode reads.
+func (view View) Encode() string {
+	var sb strings.Builder
+
+	sb.WriteString(string(view.GetSort()))
+	sb.WriteString(padLeft(strconv.FormatUint(mask(view.Formats, Formats), 36), 2))
+	sb.WriteString(strconv.FormatUint(mask(view.Statuses, Statuses), 36))
+
+	if genre := indexOf(Genres, view.Genre); genre >= 0 {
+		sb.WriteString(strconv.FormatInt(int64(genre), 36))
+	} else {
+		sb.WriteString(none)
+	}
+
+	if view.Scored != ScoredAny {
+		sb.WriteString(string(view.Scored))
+	} else {
+		sb.WriteString(none)
+	}
+
+	return sb.String()
+}
+
+// Decode reads a view written by Encode.
+func Decode(value string) (View, error) {
+	if len(value) != encodedLength {
+		return View{}, ErrInvalid
+	}
+
+	view := View{Sort: Sort(value[0:1])}
+	if !view.Sort.valid() {
+		return View{}, ErrInvalid
+	}
+
+	formats, err := strconv.ParseUint(value[1:3], 36, 64)
+	if err != nil || formats >= 1<<len(Formats) {
+		return View{}, ErrInvalid
+	}
+	view.Formats = unmask(formats, Formats)
+
+	statuses, err := strconv.ParseUint(value[3:4], 36, 64)
+	if err != nil || statuses >= 1<<len(Statuses) {
+		return View{}, ErrInvalid
+	}
+	view.Statuses = unmask(statuses, Statuses)
+
+	if genre := value[4:5]; genre != none {
+		index, err := strconv.ParseUint(genre, 36, 64)
+		if err != nil || index >= uint64(len(Genres)) {
+			return View{}, ErrInvalid
+		}
+		view.Genre = Genres[index]
+	}
+
+	switch scored := Scored(value[5:6]); scored {
+	case ScoredYes, ScoredNo:
+		view.Scored = scored
+	case none:
+	default:
+		return View{}, ErrInvalid
+	}
+
+	return view, nil
+}
+
+func contains(values []string, value string) bool {
+	return indexOf(values, value) >= 0
+}
+
+func indexOf(values []string, value string) int {
+	for i, known := range values {
+		if known == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// toggle adds or removes value, keeping values in the order of all.
+func toggle(values []string, value string, all []string) []string {
+	return unmask(mask(values, all)^mask([]string{value}, all), all)
+}
+
+func mask(values []string, all []string) uint64 {
+	var bits uint64
+	for _, value := range values {
+		if i := indexOf(all, value); i >= 0 {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+func unmask(bits uint64, all []string) []string {
+	var values []string
+	for i, value := range all {
+		if bits&(1<<i) != 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func padLeft(value string, length int) string {
+	return strings.Repeat("0", length-len(value)) + value
+}
@@ -0,0 +1,198 @@
+// Package score converts list entry scores between the 100 point scale they are
+// stored on and the formats users can pick, the same ones AniList offers.
+package score
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unscored is the stored score of entries that were never rated (or had their score
+// cleared). 0 is a real score.
+const Unscored = -1
+
+// Max is the highest stored score.
+const Max = 100
+
+type Format string
+
+const (
+	Point100       Format = "POINT_100"
+	Point10Decimal Format = "POINT_10_DECIMAL"
+	Point10        Format = "POINT_10"
+	Point5         Format = "POINT_5"
+	Point3         Format = "POINT_3"
+)
+
+// DefaultFormat is used for users who haven't picked a format, scores used to be 0-10.
+const DefaultFormat = Point10
+
+// Formats lists every format, in the order they are offered to users.
+var Formats = []Format{Point100, Point10Decimal, Point10, Point5, Point3}
+
+// ErrInvalid is returned by Parse for input that doesn't fit the format.
+var ErrInvalid = errors.New("invalid score")
+
+// Stored scores the three smileys of Point3 stand for, and the highest score each
+// smiley is shown for.
+const (
+	sadScore     = 35
+	neutralScore = 60
+	happyScore   = 85
+)
+
+var smileys = []string{":(", ":|", ":)"}
+
+func (format Format) Valid() bool {
+	for _, known := range Formats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Label names the format in menus (ex, "10 Point Decimal (5.5/10)").
+func (format Format) Label() string {
+	switch format {
+	case Point100:
+		return "100 Point (55/100)"
+	case Point10Decimal:
+		return "10 Point Decimal (5.5/10)"
+	case Point5:
+		return "5 Star (3/5)"
+	case Point3:
+		return "3 Point Smiley :)"
+	default:
+		return "10 Point (5/10)"
+	}
+}
+
+// Hint describes the input Parse accepts, for form placeholders.
+func (format Format) Hint() string {
+	switch format {
+	case Point100:
+		return "A number between 0 and 100"
+	case Point10Decimal:
+		return "A number between 0 and 10, like 7.5"
+	case Point5:
+		return "Between 0 and 5 stars, like 4"
+	case Point3:
+		return "1 :(, 2 :| or 3 :)"
+	default:
+		return "A number between 0 and 10"
+	}
+}
+
+// Parse reads a score written in the format and returns it on the 100 point scale.
+// Empty input gives Unscored.
+func (format Format) Parse(input string) (int, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return Unscored, nil
+	}
+
+	switch format {
+	case Point100:
+		return parseInt(input, 100, 1)
+	case Point10Decimal:
+		input = strings.Replace(input, ",", ".", 1)
+		value, err := strconv.ParseFloat(input, 64)
+		// plain decimals with at most one digit after the point, the scale has no room for more
+		if err != nil || strings.Trim(input, "0123456789.") != "" || value > 10 || math.Abs(value*10-math.Round(value*10)) > 1e-9 {
+			return 0, fmt.Errorf("%w: %q", ErrInvalid, input)
+		}
+		return int(math.Round(value * 10)), nil
+	case Point5:
+		if stars := strings.Count(input, "★"); stars > 0 && strings.Trim(input, "★☆ ") == "" {
+			if stars+strings.Count(input, "☆") > 5 {
+				return 0, fmt.Errorf("%w: %q", ErrInvalid, input)
+			}
+			return stars * 20, nil
+		}
+		return parseInt(input, 5, 20)
+	case Point3:
+		for i, smiley := range smileys {
+			if input == smiley {
+				return []int{sadScore, neutralScore, happyScore}[i], nil
+			}
+		}
+		value, err := strconv.Atoi(input)
+		if err != nil || value < 1 || value > 3 {
+			return 0, fmt.Errorf("%w: %q", ErrInvalid, input)
+		}
+		return []int{sadScore, neutralScore, happyScore}[value-1], nil
+	default:
+		return parseInt(input, 10, 10)
+	}
+}
+
+func parseInt(input string, max int, scale int) (int, error) {
+	value, err := strconv.Atoi(input)
+	if err != nil || value < 0 || value > max {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, input)
+	}
+	return value * scale, nil
+}
+
+// Value is a stored score as it would be typed in the format, used to fill in forms.
+// Unscored gives an empty value.
+func (format Format) Value(score int) string {
+	if score < 0 {
+		return ""
+	}
+
+	switch format {
+	case Point100:
+		return strconv.Itoa(score)
+	case Point10Decimal:
+		return strconv.FormatFloat(float64(score)/10, 'f', 1, 64)
+	case Point5:
+		return strconv.Itoa(roundDiv(score, 20))
+	case Point3:
+		return strconv.Itoa(smiley(score) + 1)
+	default:
+		return strconv.Itoa(roundDiv(score, 10))
+	}
+}
+
+// String renders a stored score in the format (ex, "7.5/10" or "★★★☆☆"). Unscored
+// gives an empty string.
+func (format Format) String(score int) string {
+	if score < 0 {
+		return ""
+	}
+
+	switch format {
+	case Point100:
+		return fmt.Sprintf("%d/100", score)
+	case Point10Decimal:
+		return format.Value(score) + "/10"
+	case Point5:
+		stars := roundDiv(score, 20)
+		return strings.Repeat("★", stars) + strings.Repeat("☆", 5-stars)
+	case Point3:
+		return smileys[smiley(score)]
+	default:
+		return format.Value(score) + "/10"
+	}
+}
+
+func smiley(score int) int {
+	switch {
+	case score <= sadScore:
+		return 0
+	case score <= neutralScore:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// roundDiv divides rounding halves up, so 75 is 8/10 and 4 stars.
+func roundDiv(score int, divisor int) int {
+	return (score + divisor/2) / divisor
+}
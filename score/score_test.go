@@ -0,0 +1,231 @@
+package score
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+		want   int
+	}{
+		{Point100, "", Unscored},
+		{Point100, "  ", Unscored},
+		{Point100, "0", 0},
+		{Point100, " 85 ", 85},
+		{Point100, "100", 100},
+
+		{Point10Decimal, "", Unscored},
+		{Point10Decimal, "0", 0},
+		{Point10Decimal, "7.5", 75},
+		{Point10Decimal, "7,5", 75},
+		{Point10Decimal, ".5", 5},
+		{Point10Decimal, "10", 100},
+		{Point10Decimal, "10.0", 100},
+		{Point10Decimal, "0.1", 1},
+
+		{Point10, "", Unscored},
+		{Point10, "0", 0},
+		{Point10, "8", 80},
+		{Point10, "10", 100},
+
+		{Point5, "", Unscored},
+		{Point5, "0", 0},
+		{Point5, "4", 80},
+		{Point5, "5", 100},
+		{Point5, "★★★", 60},
+		{Point5, "★★★☆☆", 60},
+		{Point5, "★ ★", 40},
+
+		{Point3, "", Unscored},
+		{Point3, ":(", sadScore},
+		{Point3, ":|", neutralScore},
+		{Point3, ":)", happyScore},
+		{Point3, "1", sadScore},
+		{Point3, "2", neutralScore},
+		{Point3, "3", happyScore},
+
+		// formats nobody picked are read as the default
+		{Format("UNKNOWN"), "7", 70},
+	}
+
+	for _, test := range tests {
+		got, err := test.format.Parse(test.input)
+		if err != nil {
+			t.Errorf("%s.Parse(%q) error = %v", test.format, test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s.Parse(%q) = %d, want %d", test.format, test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{Point100, "101"},
+		{Point100, "-1"},
+		{Point100, "8.5"},
+		{Point100, "eighty"},
+
+		{Point10Decimal, "10.1"},
+		{Point10Decimal, "11"},
+		{Point10Decimal, "-1"},
+		{Point10Decimal, "7.55"},
+		{Point10Decimal, "7.5.5"},
+		{Point10Decimal, "1e1"},
+		{Point10Decimal, "NaN"},
+		{Point10Decimal, "Inf"},
+		{Point10Decimal, "0x5"},
+
+		{Point10, "11"},
+		{Point10, "-1"},
+		{Point10, "7.5"},
+
+		{Point5, "6"},
+		{Point5, "4.5"},
+		{Point5, "☆☆"},
+		{Point5, "★★x"},
+		{Point5, "★★★★★★"},
+		{Point5, "★★★☆☆☆"},
+
+		{Point3, "0"},
+		{Point3, "4"},
+		{Point3, ":D"},
+	}
+
+	for _, test := range tests {
+		if got, err := test.format.Parse(test.input); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s.Parse(%q) = %d, %v, want ErrInvalid", test.format, test.input, got, err)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		format Format
+		score  int
+		want   string
+	}{
+		{Point100, 0, "0"},
+		{Point100, 85, "85"},
+
+		{Point10Decimal, 0, "0.0"},
+		{Point10Decimal, 5, "0.5"},
+		{Point10Decimal, 75, "7.5"},
+		{Point10Decimal, 100, "10.0"},
+
+		// halves round up
+		{Point10, 4, "0"},
+		{Point10, 5, "1"},
+		{Point10, 74, "7"},
+		{Point10, 75, "8"},
+		{Point10, 100, "10"},
+
+		{Point5, 9, "0"},
+		{Point5, 10, "1"},
+		{Point5, 69, "3"},
+		{Point5, 70, "4"},
+		{Point5, 100, "5"},
+
+		// the smileys cover everything up to their score
+		{Point3, 0, "1"},
+		{Point3, sadScore, "1"},
+		{Point3, sadScore + 1, "2"},
+		{Point3, neutralScore, "2"},
+		{Point3, neutralScore + 1, "3"},
+		{Point3, 100, "3"},
+	}
+
+	for _, test := range tests {
+		if got := test.format.Value(test.score); got != test.want {
+			t.Errorf("%s.Value(%d) = %q, want %q", test.format, test.score, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		format Format
+		score  int
+		want   string
+	}{
+		{Point100, 0, "0/100"},
+		{Point100, 85, "85/100"},
+
+		{Point10Decimal, 75, "7.5/10"},
+		{Point10Decimal, 100, "10.0/10"},
+
+		{Point10, 75, "8/10"},
+		{Point10, 0, "0/10"},
+
+		{Point5, 0, "☆☆☆☆☆"},
+		{Point5, 50, "★★★☆☆"},
+		{Point5, 70, "★★★★☆"},
+		{Point5, 100, "★★★★★"},
+
+		{Point3, 20, ":("},
+		{Point3, sadScore, ":("},
+		{Point3, neutralScore, ":|"},
+		{Point3, happyScore, ":)"},
+		{Point3, 100, ":)"},
+	}
+
+	for _, test := range tests {
+		if got := test.format.String(test.score); got != test.want {
+			t.Errorf("%s.String(%d) = %q, want %q", test.format, test.score, got, test.want)
+		}
+	}
+}
+
+func TestUnscored(t *testing.T) {
+	for _, format := range Formats {
+		if got := format.Value(Unscored); got != "" {
+			t.Errorf("%s.Value(Unscored) = %q, want \"\"", format, got)
+		}
+		if got := format.String(Unscored); got != "" {
+			t.Errorf("%s.String(Unscored) = %q, want \"\"", format, got)
+		}
+	}
+}
+
+// Every value a format shows has to be accepted back by Parse, and give the same value.
+func TestValueRoundTrip(t *testing.T) {
+	for _, format := range Formats {
+		for score := 0; score <= Max; score++ {
+			value := format.Value(score)
+
+			parsed, err := format.Parse(value)
+			if err != nil {
+				t.Errorf("%s.Parse(%s.Value(%d) = %q) error = %v", format, format, score, value, err)
+				continue
+			}
+
+			// the 100 point scales keep every score, the others round to their steps
+			if (format == Point100 || format == Point10Decimal) && parsed != score {
+				t.Errorf("%s: %d became %d", format, score, parsed)
+			}
+			if again := format.Value(parsed); again != value {
+				t.Errorf("%s: %d shows as %q, but as %q after parsing it", format, score, value, again)
+			}
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, format := range Formats {
+		if !format.Valid() {
+			t.Errorf("%s.Valid() = false", format)
+		}
+	}
+	for _, format := range []Format{"", "POINT_7", "point_10"} {
+		if format.Valid() {
+			t.Errorf("%q.Valid() = true", format)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed /anime or /manga search. Free text is kept as plain words
+// and phrases; nothing the user types is ever used as a regular expression.
+//
+// Supported syntax:
+//
+//	naruto "hidden leaf"   words and quoted phrases
+//	-isekai -"time skip"   exclude a word or phrase
+//	genre:Action           genre (repeatable)
+//	tag:Isekai             tag (repeatable)
+//	year:2020              start year
+//	format:movie           format (tv, tv-short, movie, special, ova, ona, music, manga, novel, one-shot)
+//	score>80 score<95      average score bounds (>=, <= also work)
+type Query struct {
+	Words        []string
+	Phrases      []string
+	Excludes     []string
+	Genres       []string
+	Tags         []string
+	Year         int
+	Format       string
+	ScoreGreater int
+	ScoreLesser  int
+}
+
+// ParseError describes why a search could not be parsed, in words that can be shown to the user.
+type ParseError struct {
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
+func parseErrorf(format string, args ...interface{}) error {
+	return &ParseError{Message: fmt.Sprintf(format, args...)}
+}
+
+var genres = []string{
+	"Action", "Adventure", "Comedy", "Drama", "Ecchi", "Fantasy", "Hentai", "Horror", "Mahou Shoujo", "Mecha",
+	"Music", "Mystery", "Psychological", "Romance", "Sci-Fi", "Slice of Life", "Sports", "Supernatural", "Thriller",
+}
+
+var formats = map[string]string{
+	"tv":       "TV",
+	"tv_short": "TV_SHORT",
+	"movie":    "MOVIE",
+	"special":  "SPECIAL",
+	"ova":      "OVA",
+	"ona":      "ONA",
+	"music":    "MUSIC",
+	"manga":    "MANGA",
+	"novel":    "NOVEL",
+	"one_shot": "ONE_SHOT",
+}
+
+// Parse reads a search typed by the user. A *ParseError is returned for input
+// that looks like a filter but can't be understood.
+func Parse(input string) (*Query, error) {
+	query := &Query{ScoreGreater: -1, ScoreLesser: -1}
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		if token.quoted {
+			if token.exclude {
+				query.Excludes = append(query.Excludes, token.text)
+			} else {
+				query.Phrases = append(query.Phrases, token.text)
+			}
+			continue
+		}
+
+		if token.exclude {
+			if handled, _ := (&Query{}).parseFilter(token.text); handled {
+				return nil, parseErrorf("`-%s`: filters can't be excluded, only words and phrases can.", token.text)
+			}
+		} else {
+			handled, err := query.parseFilter(token.text)
+			if err != nil {
+				return nil, err
+			}
+			if handled {
+				continue
+			}
+		}
+
+		for _, word := range splitWords(token.text) {
+			if token.exclude {
+				query.Excludes = append(query.Excludes, word)
+			} else {
+				query.Words = append(query.Words, word)
+			}
+		}
+	}
+
+	if query.ScoreGreater >= 0 && query.ScoreLesser >= 0 && query.ScoreGreater >= query.ScoreLesser-1 {
+		return nil, parseErrorf("No score can be above %d and below %d.", query.ScoreGreater, query.ScoreLesser)
+	}
+
+	if query.IsEmpty() {
+		return nil, parseErrorf("Please provide a name or at least one filter to search for.")
+	}
+
+	return query, nil
+}
+
+// Text is the free text part of the query (words and phrases), as sent to AniList.
+func (query *Query) Text() string {
+	return strings.Join(append(append([]string{}, query.Words...), query.Phrases...), " ")
+}
+
+// HasText reports whether the query has words or phrases to rank results by.
+func (query *Query) HasText() bool {
+	return len(query.Words) > 0 || len(query.Phrases) > 0
+}
+
+// IsEmpty reports whether the query would match everything.
+func (query *Query) IsEmpty() bool {
+	return !query.HasText() && len(query.Excludes) == 0 && len(query.Genres) == 0 && len(query.Tags) == 0 &&
+		query.Year == 0 && query.Format == "" && query.ScoreGreater < 0 && query.ScoreLesser < 0
+}
+
+func (query *Query) parseFilter(text string) (bool, error) {
+	lower := strings.ToLower(text)
+
+	if strings.HasPrefix(lower, "score") {
+		rest := lower[len("score"):]
+		for _, operator := range []string{">=", "<=", ">", "<"} {
+			if !strings.HasPrefix(rest, operator) {
+				continue
+			}
+
+			score, err := strconv.Atoi(rest[len(operator):])
+			if err != nil || score < 0 || score > 100 {
+				return false, parseErrorf("`%s`: scores are whole numbers between 0 and 100, ex `score>80`.", text)
+			}
+
+			switch operator {
+			case ">":
+				query.ScoreGreater = score
+			case ">=":
+				query.ScoreGreater = score - 1
+			case "<":
+				query.ScoreLesser = score
+			case "<=":
+				query.ScoreLesser = score + 1
+			}
+			return true, nil
+		}
+	}
+
+	key, value, found := strings.Cut(text, ":")
+	if !found {
+		return false, nil
+	}
+
+	// anything that isn't one of our keys is plain text, titles like "Re:Zero" included
+	switch strings.ToLower(key) {
+	case "genre":
+		if value == "" {
+			return false, parseErrorf("`genre:` needs a genre, ex `genre:Action`.")
+		}
+		genre, ok := lookupGenre(value)
+		if !ok {
+			return false, parseErrorf("Unknown genre `%s`. Genres are: %s.", value, strings.Join(genres, ", "))
+		}
+		query.Genres = append(query.Genres, genre)
+	case "tag":
+		if value == "" {
+			return false, parseErrorf("`tag:` needs a tag, ex `tag:Isekai`.")
+		}
+		query.Tags = append(query.Tags, titleCase(value))
+	case "year":
+		year, err := strconv.Atoi(value)
+		if err != nil || year < 1900 || year > 2100 {
+			return false, parseErrorf("`%s`: years look like `year:2020`.", text)
+		}
+		query.Year = year
+	case "format":
+		format, ok := formats[strings.ReplaceAll(strings.ToLower(value), "-", "_")]
+		if !ok {
+			return false, parseErrorf("Unknown format `%s`. Formats are: tv, tv-short, movie, special, ova, ona, music, manga, novel, one-shot.", value)
+		}
+		query.Format = format
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func lookupGenre(value string) (string, bool) {
+	for _, genre := range genres {
+		if strings.EqualFold(genre, value) {
+			return genre, true
+		}
+	}
+	return "", false
+}
+
+// titleCase matches AniList's tag naming (ex, "time skip" -> "Time Skip").
+func titleCase(value string) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// splitWords breaks plain text into the words the text indexes know about.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+type token struct {
+	text    string
+	quoted  bool
+	exclude bool
+}
+
+// tokenize splits input on whitespace, keeping "quoted phrases" (and key:"quoted values") together.
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		current := token{}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			current.exclude = true
+			i++
+		}
+
+		var text strings.Builder
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			if runes[i] != '"' {
+				text.WriteRune(runes[i])
+				i++
+				continue
+			}
+
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, parseErrorf("Missing closing quote in `%s`.", string(runes[i:]))
+			}
+
+			phrase := strings.Join(strings.Fields(string(runes[i+1:end])), " ")
+			if text.Len() == 0 {
+				// a whole token in quotes is a phrase
+				current.quoted = true
+			}
+			text.WriteString(phrase)
+			i = end + 1
+		}
+
+		current.text = text.String()
+		if current.text == "" {
+			continue
+		}
+		tokens = append(tokens, current)
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,127 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Query
+	}{
+		{"words", "naruto  shippuden", Query{Words: []string{"naruto", "shippuden"}}},
+		{"phrase", `naruto "hidden   leaf"`, Query{Words: []string{"naruto"}, Phrases: []string{"hidden leaf"}}},
+		{"excluded words and phrases", `-isekai -"time skip" slime`, Query{Words: []string{"slime"}, Excludes: []string{"isekai", "time skip"}}},
+		{"lone dash", "one - piece", Query{Words: []string{"one", "piece"}}},
+		{"genres", "genre:action GENRE:Sci-fi", Query{Genres: []string{"Action", "Sci-Fi"}}},
+		{"quoted genre", `genre:"slice  of life"`, Query{Genres: []string{"Slice of Life"}}},
+		{"tag", `tag:"time skip"`, Query{Tags: []string{"Time Skip"}}},
+		{"year and format", "year:2020 format:tv-short", Query{Year: 2020, Format: "TV_SHORT"}},
+		{"score greater", "score>80", Query{ScoreGreater: 80}},
+		{"score greater or equal", "score>=80", Query{ScoreGreater: 79}},
+		{"score lesser", "score<50", Query{ScoreLesser: 50}},
+		{"score lesser or equal", "score<=50", Query{ScoreLesser: 51}},
+		{"score range", "score>=80 score<=90", Query{ScoreGreater: 79, ScoreLesser: 91}},
+		{"unknown key is text", "Re:Zero", Query{Words: []string{"Re", "Zero"}}},
+		{"regex metacharacters", "(a+)+$ .* [b]", Query{Words: []string{"a", "b"}}},
+		{"regex metacharacters in a phrase", `"(a+)+$"`, Query{Phrases: []string{"(a+)+$"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+
+			want := test.want
+			if want.ScoreGreater == 0 {
+				want.ScoreGreater = -1
+			}
+			if want.ScoreLesser == 0 {
+				want.ScoreLesser = -1
+			}
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", test.input, *got, want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"only spaces", "   "},
+		{"unmatched quote", `naruto "hidden leaf`},
+		{"unmatched quote in a value", `genre:"slice of`},
+		{"nothing but symbols", "["},
+		{"regex metacharacters only", "(.*)+$"},
+		{"missing genre", "genre:"},
+		{"unknown genre", "genre:cooking"},
+		{"missing tag", "tag:"},
+		{"bad year", "year:20"},
+		{"unknown format", "format:vhs"},
+		{"score above 100", "score>101"},
+		{"score not a number", "score>=abc"},
+		{"negative score", "score<-5"},
+		{"empty score range", "score>80 score<81"},
+		{"excluded filter", "naruto -genre:action"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := Parse(test.input)
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q) = %+v, %v, want a *ParseError", test.input, query, err)
+			}
+			if parseErr.Message == "" {
+				t.Errorf("Parse(%q) error has no message", test.input)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []token
+	}{
+		{"empty", "", nil},
+		{"words", " a  b ", []token{{text: "a"}, {text: "b"}}},
+		{"phrase", `"a  b"`, []token{{text: "a b", quoted: true}}},
+		{"empty phrase", `"" a`, []token{{text: "a"}}},
+		{"excluded", `-a -"b c"`, []token{{text: "a", exclude: true}, {text: "b c", quoted: true, exclude: true}}},
+		{"quoted value", `tag:"time skip"`, []token{{text: "tag:time skip"}}},
+		{"quotes inside a word", `a"b c"d`, []token{{text: "ab cd"}}},
+		{"dash on its own", "- a", []token{{text: "-"}, {text: "a"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := tokenize(test.input)
+			if err != nil {
+				t.Fatalf("tokenize(%q) error = %v", test.input, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tokenize(%q) = %+v, want %+v", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeUnmatchedQuote(t *testing.T) {
+	for _, input := range []string{`"`, `a "b`, `-"b c`, `a"b`} {
+		if tokens, err := tokenize(input); err == nil {
+			t.Errorf("tokenize(%q) = %+v, want an error", input, tokens)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package structs
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"ipmanlk/saika/score"
 	"sort"
 	"strconv"
 	"strings"
@@ -99,6 +101,64 @@ func (media *AnilistMedia) GetTitle() string {
 	return mediaTitle
 }
 
+// NewFuzzyDate is the (complete) date of t.
+func NewFuzzyDate(t time.Time) AnilistFuzzyDate {
+	return AnilistFuzzyDate{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+}
+
+// ParseFuzzyDate reads a date that may leave out the day or the month, as in
+// "2023-04-01", "2023-04" or "2023". An empty value gives nil.
+func ParseFuzzyDate(value string) (*AnilistFuzzyDate, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, "-")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid date %q", value)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", value)
+		}
+		numbers[i] = number
+	}
+
+	date := AnilistFuzzyDate{Year: numbers[0], Month: numbers[1], Day: numbers[2]}
+
+	if date.Year < 1900 || date.Year > 9999 || (len(parts) > 1 && (date.Month < 1 || date.Month > 12)) {
+		return nil, fmt.Errorf("invalid date %q", value)
+	}
+
+	// the day has to exist in that month, time.Date would roll it over otherwise
+	if len(parts) > 2 {
+		lastDay := time.Date(date.Year, time.Month(date.Month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if date.Day < 1 || date.Day > lastDay {
+			return nil, fmt.Errorf("invalid date %q", value)
+		}
+	}
+
+	return &date, nil
+}
+
+// String formats the known parts of the date, the opposite of ParseFuzzyDate.
+func (date *AnilistFuzzyDate) String() string {
+	switch {
+	case date == nil || date.Year == 0:
+		return ""
+	case date.Month == 0:
+		return fmt.Sprintf("%04d", date.Year)
+	case date.Day == 0:
+		return fmt.Sprintf("%04d-%02d", date.Year, date.Month)
+	default:
+		return fmt.Sprintf("%04d-%02d-%02d", date.Year, date.Month, date.Day)
+	}
+}
+
 func (date *AnilistFuzzyDate) Hash() string {
 	if date == nil {
 		return ""
@@ -182,8 +242,21 @@ func (media *AnilistMedia) GetVolumeStr() string {
 	return strconv.Itoa(media.Volumes)
 }
 
+// GetProgressTotal is the number of episodes (anime) or chapters (manga), 0 when unknown.
+func (media *AnilistMedia) GetProgressTotal() int {
+	if media.Type == "MANGA" {
+		return media.Chapters
+	}
+	return media.Episodes
+}
+
 func (media *AnilistMedia) GetStatus() string {
-	switch media.Status {
+	return GetMediaStatusLabel(media.Status)
+}
+
+// GetMediaStatusLabel names an AniList media status (ex, "Not yet released").
+func GetMediaStatusLabel(status string) string {
+	switch status {
 	case "FINISHED":
 		return "Finished"
 	case "RELEASING":
@@ -237,7 +310,12 @@ func (media *AnilistMedia) GetSource() string {
 }
 
 func (media *AnilistMedia) GetFormat() string {
-	switch media.Format {
+	return GetFormatLabel(media.Format)
+}
+
+// GetFormatLabel names an AniList media format (ex, "TV short").
+func GetFormatLabel(format string) string {
+	switch format {
 	case "TV":
 		return "TV"
 	case "TV_SHORT":
@@ -307,25 +385,321 @@ func (media *AnilistMedia) Hash() string {
 }
 
 // Structs for storing media search query for maintaining state
-// for discord embed navigation
+// for discord embed navigation. The results are a snapshot taken when the
+// search was made, so every page keeps showing the same media until it expires.
 type AnilistSearchQuery struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"`
-	SearchText string             `bson:"search_text"`
-	MediaType  string             `bson:"media_type"`
-	CreatedAt  time.Time          `bson:"created_at,omitempty"`
-	LastUsedAt time.Time          `bson:"last_used_at,omitempty"`
+	ID         primitive.ObjectID   `bson:"_id,omitempty"`
+	SearchText string               `bson:"search_text"`
+	MediaType  string               `bson:"media_type"`
+	NSFW       bool                 `bson:"nsfw"`
+	ResultIDs  []primitive.ObjectID `bson:"result_ids"`
+	CreatedAt  time.Time            `bson:"created_at,omitempty"`
+	ExpiresAt  time.Time            `bson:"expires_at,omitempty"`
 }
 
-// User media tracking
+// User media tracking. Score is out of 100, or score.Unscored. Progress is the
+// number of episodes watched or chapters read; volumes are only tracked for manga.
+// StartedAt and CompletedAt are nil until known, Repeat counts finished rewatches
+// (rereads). Note and Review are written by the user, each with the time it last
+// changed. Lists holds the IDs of the user's custom lists the entry is on, Tags the
+// user's own tags.
 type UserMedia struct {
+	ID              primitive.ObjectID   `bson:"_id,omitempty"`
+	MediaID         primitive.ObjectID   `bson:"media_id"`
+	MediaType       string               `bson:"media_type"`
+	UserID          snowflake.ID         `bson:"user_id"`
+	Status          string               `bson:"status"`
+	Score           int                  `bson:"score"`
+	Progress        int                  `bson:"progress"`
+	ProgressVolumes int                  `bson:"progress_volumes,omitempty"`
+	StartedAt       *AnilistFuzzyDate    `bson:"started_at,omitempty"`
+	CompletedAt     *AnilistFuzzyDate    `bson:"completed_at,omitempty"`
+	Repeat          int                  `bson:"repeat,omitempty"`
+	Note            string               `bson:"note,omitempty"`
+	NoteUpdatedAt   time.Time            `bson:"note_updated_at,omitempty"`
+	Review          string               `bson:"review,omitempty"`
+	ReviewCreatedAt time.Time            `bson:"review_created_at,omitempty"`
+	ReviewUpdatedAt time.Time            `bson:"review_updated_at,omitempty"`
+	Lists           []primitive.ObjectID `bson:"lists,omitempty"`
+	Tags            []string             `bson:"tags,omitempty"`
+	CreatedAt       time.Time            `bson:"created_at,omitempty"`
+	UpdatedAt       time.Time            `bson:"updated_at,omitempty"`
+}
+
+// A list a user made in addition to the status lists, holding media of one type.
+type UserList struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	MediaID   primitive.ObjectID `bson:"media_id"`
+	UserID    snowflake.ID       `bson:"user_id"`
 	MediaType string             `bson:"media_type"`
+	Name      string             `bson:"name"`
+	CreatedAt time.Time          `bson:"created_at,omitempty"`
+}
+
+// A list entry together with the media it points to. Media is nil when
+// the media document no longer exists.
+type UserMediaEntry struct {
+	UserMedia `bson:",inline"`
+	Media     *AnilistMedia `bson:"media,omitempty"`
+}
+
+// An item a user marked as a favourite. Type is ANIME or MANGA, characters and staff
+// are meant to share the collection under their own types and AniList ids once they
+// can be looked up. MediaID is only set for media. Favourites of a type are ordered by
+// Position, which can have gaps.
+type Favourite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	UserID    snowflake.ID       `bson:"user_id"`
-	Status    string             `bson:"status"`
-	Score     int                `bson:"score"`
+	Type      string             `bson:"type"`
+	IdAnilist int                `bson:"id_anilist"`
+	MediaID   primitive.ObjectID `bson:"media_id,omitempty"`
+	Position  int                `bson:"position"`
 	CreatedAt time.Time          `bson:"created_at,omitempty"`
-	UpdatedAt time.Time          `bson:"updated_at,omitempty"`
+}
+
+// A favourite together with the media it points to. Media is nil for other kinds
+// of favourites and when the media document no longer exists.
+type FavouriteEntry struct {
+	Favourite `bson:",inline"`
+	Media     *AnilistMedia `bson:"media,omitempty"`
+}
+
+// Preferences of a user, created when the user first changes one. Users without
+// a document use the defaults.
+type UserSettings struct {
+	UserID      snowflake.ID `bson:"_id"`
+	ScoreFormat score.Format `bson:"score_format,omitempty"`
+	ListPrivacy ListPrivacy  `bson:"list_privacy,omitempty"`
+	UpdatedAt   time.Time    `bson:"updated_at,omitempty"`
+}
+
+// Who can look at a user's lists besides the user.
+type ListPrivacy string
+
+const (
+	ListPublic ListPrivacy = "PUBLIC"
+	// members of a server the user is in, from inside that server
+	ListServerOnly ListPrivacy = "SERVER"
+	ListPrivate    ListPrivacy = "PRIVATE"
+)
+
+// DefaultListPrivacy is used for users who haven't picked one.
+const DefaultListPrivacy = ListServerOnly
+
+// ListPrivacies lists every privacy, in the order they are offered to users.
+var ListPrivacies = []ListPrivacy{ListPublic, ListServerOnly, ListPrivate}
+
+func (privacy ListPrivacy) Valid() bool {
+	for _, known := range ListPrivacies {
+		if privacy == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Label names the privacy in menus.
+func (privacy ListPrivacy) Label() string {
+	switch privacy {
+	case ListPublic:
+		return "Public"
+	case ListPrivate:
+		return "Private"
+	default:
+		return "Server members only"
+	}
+}
+
+// GetTitle is the title of the favourite's media, or its AniList ID when the media
+// can't be shown.
+func (entry *FavouriteEntry) GetTitle() string {
+	if entry.Media != nil {
+		if title := entry.Media.GetTitle(); title != "" {
+			return title
+		}
+	}
+	return fmt.Sprintf("AniList #%d", entry.IdAnilist)
+}
+
+// OnList reports whether the entry is on the custom list listID.
+func (userMedia *UserMedia) OnList(listID primitive.ObjectID) bool {
+	for _, id := range userMedia.Lists {
+		if id == listID {
+			return true
+		}
+	}
+	return false
+}
+
+// Scored is false for entries that were never rated, see score.Unscored.
+func (userMedia *UserMedia) Scored() bool {
+	return userMedia.Score != score.Unscored
+}
+
+// One page of a user's media list, along with the size of the whole list
+type UserMediaPage struct {
+	Entries []UserMediaEntry
+	Page    int
+	PerPage int
+	Total   int
+}
+
+func (page *UserMediaPage) Pages() int {
+	if page.Total == 0 {
+		return 1
+	}
+	return (page.Total + page.PerPage - 1) / page.PerPage
+}
+
+// A media two users both have on their lists, with each one's entry. Media is nil when
+// the media document no longer exists.
+type SharedMediaEntry struct {
+	Media *AnilistMedia
+	User  UserMedia
+	Other UserMedia
+}
+
+// ScoreDifference is how far apart the two scores are, whichever is higher.
+func (entry *SharedMediaEntry) ScoreDifference() int {
+	if entry.User.Score > entry.Other.Score {
+		return entry.User.Score - entry.Other.Score
+	}
+	return entry.Other.Score - entry.User.Score
+}
+
+// How a user's list of one media type compares to another user's, see
+// database.CompareUserMedia. Affinity is the correlation of the scores both gave to the
+// same media, from -1 to 1, or nil when too few were scored by both to tell. Scored
+// counts those media.
+type UserMediaComparison struct {
+	MediaType      string
+	Shared         int
+	Scored         int
+	Affinity       *float64
+	Agreements     []SharedMediaEntry
+	Disagreements  []SharedMediaEntry
+	UserCompleted  []SharedMediaEntry
+	OtherCompleted []SharedMediaEntry
+}
+
+// Numbers about all of a user's entries of one media type. Progress counts the
+// episodes watched or chapters read, finished rewatches (rereads) included, and Minutes
+// the time spent watching them. The groups are unordered, see database.GetUserMediaStats.
+type UserMediaStats struct {
+	MediaType    string
+	Overall      StatsGroup
+	Progress     int
+	Minutes      int
+	Statuses     []StatsGroup
+	Scores       []StatsGroup
+	Genres       []StatsGroup
+	Tags         []StatsGroup
+	Formats      []StatsGroup
+	ReleaseYears []StatsGroup
+}
+
+// The entries sharing something, like a genre or a release year, and the sum of the
+// scores of those that are scored.
+type StatsGroup struct {
+	Key      string `bson:"_id"`
+	Count    int    `bson:"count"`
+	Scored   int    `bson:"scored"`
+	ScoreSum int    `bson:"score_sum"`
+}
+
+// MeanScore is the rounded mean of the group's scores, or score.Unscored when none
+// of its entries are scored.
+func (group *StatsGroup) MeanScore() int {
+	if group.Scored == 0 {
+		return score.Unscored
+	}
+	return (group.ScoreSum + group.Scored/2) / group.Scored
+}
+
+// A user the bot has seen in a guild. The bot isn't told who the members of a guild
+// are, users are recorded when they use it there.
+type GuildMember struct {
+	GuildID snowflake.ID `bson:"guild_id"`
+	UserID  snowflake.ID `bson:"user_id"`
+	SeenAt  time.Time    `bson:"seen_at"`
+}
+
+// A ranking of the members of a guild, see database.GetGuildLeaderboard.
+type Leaderboard string
+
+const (
+	LeaderboardAnimeCompleted Leaderboard = "ANIME_COMPLETED"
+	LeaderboardMangaCompleted Leaderboard = "MANGA_COMPLETED"
+	// episodes watched, finished rewatches included
+	LeaderboardEpisodes Leaderboard = "EPISODES"
+	// chapters read, finished rereads included
+	LeaderboardChapters Leaderboard = "CHAPTERS"
+	// list entries changed since the start of the month
+	LeaderboardActive Leaderboard = "ACTIVE"
+)
+
+// Leaderboards lists every leaderboard, in the order they are offered to users.
+var Leaderboards = []Leaderboard{LeaderboardAnimeCompleted, LeaderboardMangaCompleted, LeaderboardEpisodes, LeaderboardChapters, LeaderboardActive}
+
+func (board Leaderboard) Valid() bool {
+	for _, known := range Leaderboards {
+		if board == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Label names the leaderboard in menus.
+func (board Leaderboard) Label() string {
+	switch board {
+	case LeaderboardMangaCompleted:
+		return "Most manga completed"
+	case LeaderboardEpisodes:
+		return "Most episodes watched"
+	case LeaderboardChapters:
+		return "Most chapters read"
+	case LeaderboardActive:
+		return "Most active this month"
+	default:
+		return "Most anime completed"
+	}
+}
+
+// Unit is what the values of the leaderboard count.
+func (board Leaderboard) Unit() string {
+	switch board {
+	case LeaderboardEpisodes:
+		return "episodes"
+	case LeaderboardChapters:
+		return "chapters"
+	case LeaderboardActive:
+		return "updates"
+	default:
+		return "completed"
+	}
+}
+
+// A member's place on a leaderboard.
+type LeaderboardEntry struct {
+	UserID snowflake.ID `bson:"_id"`
+	Value  int          `bson:"value"`
+}
+
+// A media with the scores the members of a guild gave it, see database.GetGuildTopMedia.
+// Media is nil when the media document no longer exists.
+type GuildMediaScore struct {
+	MediaID  primitive.ObjectID `bson:"_id"`
+	Media    *AnilistMedia      `bson:"media,omitempty"`
+	Ratings  int                `bson:"ratings"`
+	ScoreSum int                `bson:"score_sum"`
+}
+
+// MeanScore is the rounded mean of the scores the media got.
+func (entry *GuildMediaScore) MeanScore() int {
+	if entry.Ratings == 0 {
+		return score.Unscored
+	}
+	return (entry.ScoreSum + entry.Ratings/2) / entry.Ratings
 }
 
 func (userMedia *UserMedia) GetStatus() string {